@@ -7,8 +7,11 @@ import (
 	"github.com/BrosSquad/vaulguard/handlers"
 	"github.com/BrosSquad/vaulguard/log"
 	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/invalidation"
+	"github.com/BrosSquad/vaulguard/services/seal"
 	"github.com/BrosSquad/vaulguard/services/secret"
 	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/BrosSquad/vaulguard/services/transit"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -32,25 +35,63 @@ type Fiber struct {
 	TokenService       token.Service
 	ApplicationService application.Service
 	SecretService      secret.Service
+	TransitService     transit.Service
+	TokenCache         *token.Cache
+	SecretCache        *secret.Cache
 	Logger             *log.Logger
 	Validator          *validator.Validate
 	Session            *session.Session
+	// Invalidator - Drops caches of renamed and deleted applications in every process
+	Invalidator *invalidation.Invalidator
+	// Sealer - Nil unless the secret key is unsealed with shamir shares
+	Sealer *seal.Sealer
 }
 
 func (f Fiber) RegisterHandlers() {
 	f.registerSecrets()
+	f.registerTransit()
 	f.registerApplications()
+	f.registerTokens()
+	f.registerSys()
+}
+
+// sealed - Nil when the server cannot be sealed
+func (f Fiber) sealed() func() bool {
+	if f.Sealer == nil {
+		return nil
+	}
+
+	return f.Sealer.Sealed
+}
+
+func (f Fiber) registerSys() {
+	f.Logger.Debug("Starting to add SYS routes.")
+	sysGroup := f.App.Group("/sys")
+	sysGroup.Use(middleware.AdminAuth(f.Cfg.Http.AdminToken))
+	handlers.RegisterSysHandlers(f.TokenCache, f.SecretCache, f.Sealer, sysGroup)
+	f.Logger.Debug("SYS routes added.")
+}
+
+func (f Fiber) registerTokens() {
+	f.Logger.Debug("Starting to add TOKEN routes.")
+	tokensGroup := f.App.Group("/tokens")
+	tokensGroup.Use(middleware.AdminAuth(f.Cfg.Http.AdminToken))
+	handlers.RegisterTokenHandlers(f.TokenService, f.ApplicationService, tokensGroup)
+	f.Logger.Debug("TOKEN routes added.")
 }
 
 func (f Fiber) registerApplications() {
 	f.Logger.Debug("Starting to add APPLICATION routes.")
-	handlers.RegisterApplicationHandlers(f.ApplicationService, f.App.Group("/applications"))
+	applicationsGroup := f.App.Group("/applications")
+	applicationsGroup.Use(middleware.AdminAuth(f.Cfg.Http.AdminToken))
+	handlers.RegisterApplicationHandlers(f.Validator, f.ApplicationService, f.Invalidator, applicationsGroup)
 	f.Logger.Debug("APPLICATION routes added.")
 }
 
 func (f Fiber) registerSecrets() {
 	f.Logger.Debug("Starting to add SECRET routes.")
 	secretsGroup := f.App.Group("/secrets")
+	secretsGroup.Use(middleware.Unsealed(f.sealed()))
 
 	secretsGroup.Use(middleware.TokenAuth(middleware.TokenAuthConfig{
 		TokenServices:  []token.Service{f.TokenService},
@@ -63,3 +104,19 @@ func (f Fiber) registerSecrets() {
 	f.Logger.Debug("SECRET routes added.")
 
 }
+
+func (f Fiber) registerTransit() {
+	f.Logger.Debug("Starting to add TRANSIT routes.")
+	transitGroup := f.App.Group("/transit")
+	transitGroup.Use(middleware.Unsealed(f.sealed()))
+
+	transitGroup.Use(middleware.TokenAuth(middleware.TokenAuthConfig{
+		TokenServices:  []token.Service{f.TokenService},
+		Headers:        []string{"authorization"},
+		HeaderPrefixes: []string{"token "},
+	}))
+
+	handlers.RegisterTransitHandlers(f.Validator, f.TransitService, transitGroup)
+
+	f.Logger.Debug("TRANSIT routes added.")
+}
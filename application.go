@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/token"
 	"github.com/spf13/cobra"
 )
 
@@ -27,7 +28,7 @@ func applicationCommands(ctx context.Context) *cobra.Command {
 
 				return nil
 			}
-			err := applicationService.List(ctx, iterate)
+			err := applicationService.List(ctx, 100, iterate)
 
 			if err != nil {
 				log.Fatal(err)
@@ -61,7 +62,7 @@ func applicationCommands(ctx context.Context) *cobra.Command {
 				log.Fatal(err.Error())
 			}
 
-			tokenStr := tokenService.Generate(ctx, app.ID)
+			tokenStr := tokenService.Generate(ctx, app.ID, token.GenerateOptions{})
 
 			if tokenStr == "" {
 				log.Fatal("Error while generating Auth Token")
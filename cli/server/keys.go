@@ -1,120 +1,107 @@
 package main
 
 import (
-	"errors"
-	"io"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"github.com/BrosSquad/vaulguard/config"
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/kms"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/BrosSquad/vaulguard/services/seal"
 	"github.com/BrosSquad/vaulguard/utils"
 )
 
 const DefaultKeysPermission = 0700
 
-func generateKeyPair(privateKeyPath, publicKeyPath string, create bool) (services.Encryption, error) {
-	if err := utils.CreateDirs(DefaultKeysPermission, filepath.Dir(privateKeyPath), filepath.Dir(publicKeyPath)); err != nil {
-		return nil, err
-	}
-	flags := os.O_RDWR | os.O_CREATE
+func getSecretKey(ctx context.Context, manager kms.KeyManager, secretKeyPath string) ([]byte, error) {
+	if utils.FileExists(secretKeyPath) {
+		wrapped, err := ioutil.ReadFile(secretKeyPath)
 
-	privateKeyFile, err := os.OpenFile(privateKeyPath, flags, DefaultKeysPermission)
-	if err != nil {
-		return nil, err
-	}
-	defer privateKeyFile.Close()
-
-	publicKeyFile, err := os.OpenFile(publicKeyPath, flags, DefaultKeysPermission)
-	if err != nil {
-		return nil, err
-	}
-	defer publicKeyFile.Close()
-	if create {
-		keyGenerator := services.NewKeyPairGenerator(publicKeyFile, privateKeyFile)
-		// Generate key pair
-		if err := keyGenerator.Generate(); err != nil {
-			return nil, err
-		}
-		if _, err = publicKeyFile.Seek(0, io.SeekStart); err != nil {
-			return nil, err
-		}
-		if _, err = privateKeyFile.Seek(0, io.SeekStart); err != nil {
+		if err != nil {
 			return nil, err
 		}
+
+		return manager.Unwrap(ctx, wrapped)
 	}
-	return services.NewPublicKeyEncryption(publicKeyFile, privateKeyFile)
-}
 
-func getSecretKey(service services.Encryption, secretKeyPath string, secretKeyExists bool) ([]byte, error) {
 	if err := utils.CreateDirs(DefaultKeysPermission, filepath.Dir(secretKeyPath)); err != nil {
 		return nil, err
 	}
 
-	flags := os.O_RDWR | os.O_CREATE
-	secretKeyFile, err := os.OpenFile(secretKeyPath, flags, DefaultKeysPermission)
+	secretKeyFile, err := os.OpenFile(secretKeyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, DefaultKeysPermission)
 	if err != nil {
 		return nil, err
 	}
 	defer secretKeyFile.Close()
-	if secretKeyExists {
-		key, err := ioutil.ReadAll(secretKeyFile)
 
-		if err != nil {
-			return nil, err
-		}
+	return kms.GenerateSecretKey(ctx, manager, secretKeyFile)
+}
 
-		return service.Decrypt(nil, key)
+// getPreviousSecretKey - Key replaced by `vaulguard keys rotate`, nil when no rotation is in progress
+func getPreviousSecretKey(ctx context.Context, manager kms.KeyManager, previousKeyPath string) ([]byte, error) {
+	if !utils.FileExists(previousKeyPath) {
+		return nil, nil
 	}
 
-	var key []byte
-	if err := services.NewSecretKeyGenerator(secretKeyFile, service).Generate(&key); err != nil {
+	key, err := ioutil.ReadFile(previousKeyPath)
+
+	if err != nil {
 		return nil, err
 	}
 
-	return key, nil
+	return manager.Unwrap(ctx, key)
 }
 
-func checkKeyPairExistence(privateKeyExists, publicKeyExists bool) error {
-	if privateKeyExists && !publicKeyExists {
-		return errors.New("public key does not exit while private exists")
+// getKeys - Current secret key and the previous one while values are re-encrypted after rotation,
+// both are unwrapped by the configured key provider and kept in locked memory, previous is nil without rotation
+func getKeys(ctx context.Context, cfg *config.Config) (key *locked.Buffer, previous *locked.Buffer, err error) {
+	secretKeyPath, err := utils.GetAbsolutePath(cfg.Keys.Secret)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if !privateKeyExists && publicKeyExists {
-		return errors.New("private key does not exit while public exists")
+	manager, err := kms.New(cfg.Keys, true)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return nil
-}
-
-func getKeys(config *config.Config) ([]byte, error) {
-	privateKeyPath, err := utils.GetAbsolutePath(config.Keys.Private)
-
+	plain, err := getSecretKey(ctx, manager, secretKeyPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	publicKeyPath, err := utils.GetAbsolutePath(config.Keys.Public)
-	if err != nil {
-		return nil, err
+	if key, err = locked.Move(plain); err != nil {
+		return nil, nil, err
 	}
 
-	secretKeyPath, err := utils.GetAbsolutePath(config.Keys.Secret)
+	plain, err = getPreviousSecretKey(ctx, manager, config.PreviousSecretKeyPath(secretKeyPath))
 	if err != nil {
-		return nil, err
+		key.Destroy()
+		return nil, nil, err
 	}
 
-	privateKeyExists, publicKeyExists, secretKeyExists := utils.FileExists(privateKeyPath), utils.FileExists(publicKeyPath), utils.FileExists(secretKeyPath)
+	if plain == nil {
+		return key, nil, nil
+	}
 
-	if err := checkKeyPairExistence(privateKeyExists, publicKeyExists); err != nil {
-		return nil, err
+	if previous, err = locked.Move(plain); err != nil {
+		key.Destroy()
+		return nil, nil, err
 	}
 
-	service, err := generateKeyPair(privateKeyPath, publicKeyPath, !publicKeyExists)
+	return key, previous, nil
+}
+
+// createSealer - Sealed secret key written by `vaulguard init`, it is unwrapped once enough shares are submitted
+func createSealer(cfg *config.Config, algorithm services.Algorithm) (*seal.Sealer, error) {
+	secretKeyPath, err := utils.GetAbsolutePath(cfg.Keys.Secret)
+
 	if err != nil {
 		return nil, err
 	}
 
-	return getSecretKey(service, secretKeyPath, secretKeyExists)
+	return seal.New(secretKeyPath, algorithm)
 }
@@ -1,66 +1,130 @@
 package main
 
 import (
-	"github.com/stretchr/testify/require"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/kms"
+	"github.com/stretchr/testify/require"
 )
 
-func TestGenerateKeyPair(t *testing.T) {
+func TestGetKeys(t *testing.T) {
 	t.Parallel()
 	asserts := require.New(t)
+	ctx := context.Background()
 
-	path, err := ioutil.TempDir("", "generate_vaulguard_keys")
+	path, err := ioutil.TempDir("", "vaulguard_server_keys")
 	asserts.Nil(err)
+	defer os.RemoveAll(path)
+
+	cfg := &config.Config{
+		Keys: config.Keys{
+			Private:  filepath.Join(path, "keys", "private.key"),
+			Public:   filepath.Join(path, "keys", "public.key"),
+			Secret:   filepath.Join(path, "keys", "secret.key"),
+			Provider: config.KeyProvider{Name: config.KeyProviderFile},
+		},
+	}
+
+	var generated []byte
 
-	t.Run("SuccessfulGeneration", func(t *testing.T) {
-		publicKeyPath := filepath.Join(path, "public_success.key")
-		privateKeyPath := filepath.Join(path, "private_success.key")
-		_, err := generateKeyPair(privateKeyPath, publicKeyPath, true)
+	t.Run("GeneratedOnFirstBoot", func(t *testing.T) {
+		key, previous, err := getKeys(ctx, cfg)
 		asserts.Nil(err)
-		asserts.FileExists(publicKeyPath)
-		asserts.FileExists(privateKeyPath)
-		asserts.Nil(os.Remove(publicKeyPath))
-		asserts.Nil(os.Remove(privateKeyPath))
+		defer key.Destroy()
+
+		asserts.Nil(previous)
+		asserts.Len(key.Bytes(), services.SecretKeyLength)
+		asserts.FileExists(cfg.Keys.Private)
+		asserts.FileExists(cfg.Keys.Public)
+		asserts.FileExists(cfg.Keys.Secret)
+
+		generated = append([]byte(nil), key.Bytes()...)
+
+		wrapped, err := ioutil.ReadFile(cfg.Keys.Secret)
+		asserts.Nil(err)
+		asserts.NotContains(string(wrapped), string(generated), "secret key is stored wrapped")
 	})
 
-	t.Run("PrivateKeyNotFound", func(t *testing.T) {
-		publicKeyPath := filepath.Join(path, "public_success.key")
-		privateKeyPath := filepath.Join(path, "private_success.key")
-		file, err := os.Create(publicKeyPath)
+	t.Run("LoadedOnNextBoot", func(t *testing.T) {
+		key, previous, err := getKeys(ctx, cfg)
 		asserts.Nil(err)
-		asserts.Nil(file.Close())
-		asserts.FileExists(publicKeyPath)
-		_, err = generateKeyPair(privateKeyPath, publicKeyPath, false)
-		asserts.NotNil(err)
+		defer key.Destroy()
+
+		asserts.Nil(previous)
+		asserts.Equal(generated, key.Bytes())
 	})
 
-	t.Run("PublicKeyNotFound", func(t *testing.T) {
-		publicKeyPath := filepath.Join(path, "public_success.key")
-		privateKeyPath := filepath.Join(path, "private_success.key")
-		file, err := os.Create(privateKeyPath)
+	t.Run("PreviousKeyDuringRotation", func(t *testing.T) {
+		manager, err := kms.NewFileKeyPair(cfg.Keys.Private, cfg.Keys.Public, false, kms.PrivateKeyProtection{})
+		asserts.Nil(err)
+
+		previousKeyPath := config.PreviousSecretKeyPath(cfg.Keys.Secret)
+		file, err := os.Create(previousKeyPath)
+		asserts.Nil(err)
+		previousKey, err := kms.GenerateSecretKey(ctx, manager, file)
 		asserts.Nil(err)
 		asserts.Nil(file.Close())
-		asserts.FileExists(publicKeyPath)
-		_, err = generateKeyPair(privateKeyPath, publicKeyPath, false)
-		asserts.NotNil(err)
+		defer os.Remove(previousKeyPath)
+
+		key, previous, err := getKeys(ctx, cfg)
+		asserts.Nil(err)
+		defer key.Destroy()
+		defer previous.Destroy()
+
+		asserts.Equal(generated, key.Bytes())
+		asserts.Equal(previousKey, previous.Bytes())
 	})
 
-	t.Run("EmptyKeyFiles", func(t *testing.T) {
-		publicKeyPath := filepath.Join(path, "public_success.key")
-		privateKeyPath := filepath.Join(path, "private_success.key")
-		file1, err := os.Create(publicKeyPath)
+	t.Run("SecretKeyOfOtherKeyPair", func(t *testing.T) {
+		other := filepath.Join(path, "other")
+		manager, err := kms.NewFileKeyPair(filepath.Join(other, "private.key"), filepath.Join(other, "public.key"), true, kms.PrivateKeyProtection{})
 		asserts.Nil(err)
-		asserts.Nil(file1.Close())
-		file2, err := os.Create(privateKeyPath)
+
+		secretKeyPath := filepath.Join(other, "secret.key")
+		key, err := getSecretKey(ctx, manager, secretKeyPath)
 		asserts.Nil(err)
-		asserts.Nil(file2.Close())
-		asserts.FileExists(publicKeyPath)
-		asserts.FileExists(privateKeyPath)
-		_, err = generateKeyPair(privateKeyPath, publicKeyPath, false)
+		asserts.Len(key, services.SecretKeyLength)
+
+		_, err = getSecretKey(ctx, manager, cfg.Keys.Secret)
+		asserts.Equal(kms.ErrUnwrap, err)
+	})
+
+	t.Run("MissingPublicKey", func(t *testing.T) {
+		asserts.Nil(os.Remove(cfg.Keys.Public))
+
+		_, _, err := getKeys(ctx, cfg)
 		asserts.NotNil(err)
 	})
+}
+
+func TestGetSecretKeyWithPassphrase(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
 
+	path, err := ioutil.TempDir("", "vaulguard_server_passphrase")
+	asserts.Nil(err)
+	defer os.RemoveAll(path)
+
+	manager, err := kms.NewPassphrase([]byte("correct horse"), kms.Argon2Params{Time: 1, Memory: 1024, Parallelism: 1})
+	asserts.Nil(err)
+
+	secretKeyPath := filepath.Join(path, "keys", "secret.key")
+	key, err := getSecretKey(ctx, manager, secretKeyPath)
+	asserts.Nil(err)
+	asserts.Len(key, services.SecretKeyLength)
+
+	loaded, err := getSecretKey(ctx, manager, secretKeyPath)
+	asserts.Nil(err)
+	asserts.Equal(key, loaded)
+
+	previous, err := getPreviousSecretKey(ctx, manager, config.PreviousSecretKeyPath(secretKeyPath))
+	asserts.Nil(err)
+	asserts.Nil(previous)
 }
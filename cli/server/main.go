@@ -10,6 +10,7 @@ import (
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/pprof"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/session/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 	"gorm.io/gorm"
@@ -24,6 +25,11 @@ import (
 	"github.com/BrosSquad/vaulguard/handlers"
 	vaulguardlog "github.com/BrosSquad/vaulguard/log"
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/invalidation"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/BrosSquad/vaulguard/services/seal"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/token"
 	"github.com/BrosSquad/vaulguard/utils"
 )
 
@@ -65,6 +71,7 @@ func main() {
 		tokenCollection       *mongo.Collection
 		secretCollection      *mongo.Collection
 		applicationCollection *mongo.Collection
+		transitKeyCollection  *mongo.Collection
 		httpSession           *session.Session
 		closer                io.Closer
 	)
@@ -84,13 +91,36 @@ func main() {
 	logger := vaulguardlog.NewVaulGuardLogger(vaulguardlog.GetLogLevel(cfg.Logging.Level), cfg.UseConsole)
 	vaulguardlog.SetDefaultLogger(logger)
 
-	key, err := getKeys(cfg)
+	if err := locked.DisableCoreDumps(); err != nil {
+		logger.Errorf(err, "Core dumps could not be disabled, key material may end up in them\n")
+	}
+
+	algorithm, err := services.ParseAlgorithm(cfg.Keys.Cipher)
 
 	if err != nil {
-		logger.Fatalf(err, "Error while loading application keys\n")
+		logger.Fatalf(err, "Error while choosing cipher %s\n", cfg.Keys.Cipher)
 	}
 
-	cfg.ApplicationKey = key
+	var (
+		key, previousKey *locked.Buffer
+		sealer           *seal.Sealer
+	)
+
+	if cfg.Keys.Provider.Name == config.KeyProviderShamir {
+		sealer, err = createSealer(cfg, algorithm)
+
+		if err != nil {
+			logger.Fatalf(err, "Error while loading sealed secret key, run vaulguard init first\n")
+		}
+
+		logger.Printf("VaulGuard is sealed, submit %d unseal key shares to /api/v1/sys/unseal\n", sealer.Status().Threshold)
+	} else {
+		key, previousKey, err = getKeys(context.Background(), cfg)
+
+		if err != nil {
+			logger.Fatalf(err, "Error while loading application keys\n")
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	signal.Notify(signalCh, os.Interrupt)
@@ -116,13 +146,31 @@ func main() {
 		tokenCollection = mongoDatabase.Collection("tokens")
 		secretCollection = mongoDatabase.Collection("secrets")
 		applicationCollection = mongoDatabase.Collection("applications")
+		transitKeyCollection = mongoDatabase.Collection(db.TransitKeysMongoCollection)
 		defer closer.Close()
 	}
 
-	encryptionService, err := services.NewSecretKeyEncryption(cfg.ApplicationKey)
+	var encryptionService services.Encryption = sealer
 
-	if err != nil {
-		logger.Fatalf(err, "Error while creating encryption service\n")
+	if sealer == nil {
+		var previousKeys [][]byte
+
+		if previousKey != nil {
+			previousKeys = append(previousKeys, previousKey.Bytes())
+		}
+
+		encryptionService, err = services.NewKeyedEncryptionWithAlgorithm(algorithm, key.Bytes(), previousKeys...)
+
+		if err != nil {
+			logger.Fatalf(err, "Error while creating encryption service\n")
+		}
+
+		// Encryption service keeps its own copies
+		key.Destroy()
+
+		if previousKey != nil {
+			previousKey.Destroy()
+		}
 	}
 
 	v := validator.New()
@@ -139,6 +187,9 @@ func main() {
 		ErrorHandler: handlers.Error(englishTranslations),
 	})
 
+	// Panic in a handler is turned into 500 response instead of killing the process
+	app.Use(recover.New())
+
 	if cfg.Debug {
 		logger.Debug("Adding pprof routes\n")
 		app.Use(pprof.New())
@@ -151,6 +202,68 @@ func main() {
 		httpSession = createHttpSession(cfg)
 	}
 
+	tokenCache := token.NewCache(cfg.Tokens.CacheSize, cfg.Tokens.CacheTTL)
+	secretCache := secret.NewCache(secret.CacheConfig{
+		MaxEntries: cfg.Secrets.Cache.Entries,
+		MaxBytes:   cfg.Secrets.Cache.Bytes,
+		TTL:        cfg.Secrets.Cache.TTL,
+	})
+	keyRing := createKeyRing(sqlDb, applicationCollection, encryptionService, algorithm, cfg.UseSql)
+	requireAD := cfg.Secrets.AssociatedData == config.AssociatedDataRequired
+	secretService := createSecretService(sqlDb, secretCollection, encryptionService, keyRing, secretCache, requireAD, cfg.UseSql)
+
+	invalidationBus := createInvalidationBus(cfg, sqlDb)
+	defer invalidationBus.Close()
+	invalidator := invalidation.NewInvalidator(invalidationBus, invalidation.Caches{
+		Tokens:  tokenCache,
+		Secrets: secretCache,
+		Keys:    keyRing,
+	}, func(err error) {
+		logger.Errorf(err, "Error while broadcasting cache invalidation\n")
+	})
+
+	go func() {
+		if err := invalidator.Run(ctx); err != nil {
+			logger.Errorf(err, "Cache invalidation listener stopped, caches are refreshed only by their ttl\n")
+		}
+	}()
+
+	startKeyJobs := func(rotating bool) {
+		switch {
+		case rotating:
+			secretKeyPath, err := utils.GetAbsolutePath(cfg.Keys.Secret)
+
+			if err != nil {
+				logger.Fatalf(err, "Error while resolving secret key path\n")
+			}
+
+			go finishKeyRotation(ctx, config.PreviousSecretKeyPath(secretKeyPath), cfg.Keys.RotationBatch, keyRing, secretService, logger)
+		case cfg.Secrets.AssociatedData == config.AssociatedDataMigrate:
+			// Rotation binds values as well, so migration runs only without it
+			go bindAssociatedData(ctx, cfg.Keys.RotationBatch, secretService, logger)
+		}
+	}
+
+	// Prefork children share the database with the parent, only the parent reaps and re-encrypts.
+	// Jobs start after the invalidator, so other processes drop ciphertexts they cache
+	if !fiber.IsChild() {
+		go secret.Reap(ctx, secretService, cfg.Secrets.ReaperInterval, logger)
+
+		if sealer == nil {
+			startKeyJobs(previousKey != nil)
+		} else {
+			// Keys exist only after unsealing
+			go func() {
+				select {
+				case <-sealer.Unsealed():
+					logger.Printf("VaulGuard is unsealed\n")
+					startKeyJobs(sealer.RotationInProgress())
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
+
 	fiberAPI := api.Fiber{
 		Ctx:                   ctx,
 		Cfg:                   cfg,
@@ -158,12 +271,17 @@ func main() {
 		TokenCollection:       tokenCollection,
 		SecretCollection:      secretCollection,
 		ApplicationCollection: applicationCollection,
-		SecretService:         createSecretService(sqlDb, secretCollection, encryptionService, cfg.UseSql),
+		SecretService:         secretService,
+		TransitService:        createTransitService(sqlDb, transitKeyCollection, keyRing, cfg.UseSql),
 		ApplicationService:    createApplicationService(sqlDb, applicationCollection, cfg.UseSql),
-		TokenService:          createTokenService(sqlDb, tokenCollection, cfg.UseSql),
+		TokenService:          createTokenService(sqlDb, tokenCollection, tokenCache, cfg.UseSql),
+		TokenCache:            tokenCache,
+		SecretCache:           secretCache,
 		Logger:                logger,
 		Validator:             v,
 		Session:               httpSession,
+		Invalidator:           invalidator,
+		Sealer:                sealer,
 	}
 
 	fiberAPI.RegisterHandlers()
@@ -181,6 +299,14 @@ func main() {
 	if err := app.Shutdown(); err != nil {
 		logger.Fatalf(err, "Error while shutting down the api\n")
 	}
+	// No request uses the keys anymore
+	if err := locked.DestroyAll(); err != nil {
+		logger.Errorf(err, "Error while wiping key material\n")
+	}
+	stats := tokenCache.Stats()
+	logger.Debug("Token cache: %d hits, %d misses, %d evictions\n", stats.Hits, stats.Misses, stats.Evictions)
+	secretStats := secretCache.Stats()
+	logger.Debug("Secret cache: %d hits, %d misses, %d evictions\n", secretStats.Hits, secretStats.Misses, secretStats.Evictions)
 	logger.Debug("Exiting...\n")
 
 }
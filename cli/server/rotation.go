@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/BrosSquad/vaulguard/log"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/BrosSquad/vaulguard/services/secret"
+)
+
+// finishKeyRotation - Server side part of `vaulguard keys rotate`, data keys are wrapped
+// with the new secret key, every secret is sealed again and the previous key file is removed.
+// Interrupted rotation is resumed on the next boot, since previous key file is still there
+func finishKeyRotation(ctx context.Context, previousKeyPath string, batchSize int, keys *datakey.KeyRing, secrets secret.Service, logger *log.Logger) {
+	logger.Printf("Previous secret key found, re-encrypting secrets with the current key\n")
+
+	rewrapped, err := keys.Rewrap(ctx, batchSize)
+
+	if err != nil {
+		logger.Errorf(err, "Error while wrapping data keys with the current key, previous key is kept\n")
+		return
+	}
+
+	reencrypted, err := secrets.ReEncrypt(ctx, batchSize)
+
+	if err != nil {
+		logger.Errorf(err, "Error while re-encrypting secrets, previous key is kept\n")
+		return
+	}
+
+	if err := os.Remove(previousKeyPath); err != nil {
+		logger.Errorf(err, "Error while removing previous secret key\n")
+		return
+	}
+
+	logger.Printf("Key rotation finished: %d data keys and %d secret values re-encrypted, previous key removed\n", rewrapped, reencrypted)
+}
+
+// bindAssociatedData - Seals every secret again bound to its application, environment and key,
+// afterwards secrets.associated_data can be switched to required
+func bindAssociatedData(ctx context.Context, batchSize int, secrets secret.Service, logger *log.Logger) {
+	reencrypted, err := secrets.ReEncrypt(ctx, batchSize)
+
+	if err != nil {
+		logger.Errorf(err, "Error while binding secrets to application, environment and key\n")
+		return
+	}
+
+	logger.Printf("%d secret values bound to application, environment and key, secrets.associated_data can be set to required\n", reencrypted)
+}
@@ -6,8 +6,11 @@ import (
 	"github.com/BrosSquad/vaulguard/config"
 	"github.com/BrosSquad/vaulguard/services"
 	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/BrosSquad/vaulguard/services/invalidation"
 	"github.com/BrosSquad/vaulguard/services/secret"
 	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/BrosSquad/vaulguard/services/transit"
 	"github.com/gofiber/session/v2"
 	"go.mongodb.org/mongo-driver/mongo"
 	"gorm.io/gorm"
@@ -16,20 +19,44 @@ import (
 	"github.com/gofiber/session/v2/provider/redis"
 )
 
-func createSecretService(db *gorm.DB, client *mongo.Collection, encryption services.Encryption, storeInSql bool) secret.Service {
+func createSecretService(db *gorm.DB, client *mongo.Collection, encryption services.Encryption, keys *datakey.KeyRing, cache *secret.Cache, requireAD, storeInSql bool) secret.Service {
 	if storeInSql {
 		return secret.NewGormSecretStorage(secret.GormSecretConfig{
 			Encryption: encryption,
+			Keys:       keys,
+			Cache:      cache,
 			DB:         db,
+
+			RequireAssociatedData: requireAD,
 		})
 	}
 
 	return secret.NewMongoClient(secret.MongoDBConfig{
 		Encryption: encryption,
+		Keys:       keys,
+		Cache:      cache,
 		Collection: client,
+
+		RequireAssociatedData: requireAD,
 	})
 }
 
+func createKeyRing(db *gorm.DB, client *mongo.Collection, master services.Encryption, algorithm services.Algorithm, storeInSql bool) *datakey.KeyRing {
+	if storeInSql {
+		return datakey.NewKeyRing(master, datakey.NewSqlStorage(db), algorithm)
+	}
+
+	return datakey.NewKeyRing(master, datakey.NewMongoStorage(client), algorithm)
+}
+
+func createTransitService(db *gorm.DB, client *mongo.Collection, keys *datakey.KeyRing, storeInSql bool) transit.Service {
+	if storeInSql {
+		return transit.NewService(keys, transit.NewSqlStorage(db))
+	}
+
+	return transit.NewService(keys, transit.NewMongoStorage(client))
+}
+
 func createApplicationService(db *gorm.DB, client *mongo.Collection, storeInSql bool) application.Service {
 	if storeInSql {
 		return application.NewSqlService(db)
@@ -37,18 +64,37 @@ func createApplicationService(db *gorm.DB, client *mongo.Collection, storeInSql
 	return application.NewMongoService(client)
 }
 
-func createTokenService(db *gorm.DB, client *mongo.Collection, storeInSql bool) token.Service {
+func createTokenService(db *gorm.DB, client *mongo.Collection, cache *token.Cache, storeInSql bool) token.Service {
 	var storage token.Storage
 
 	if storeInSql {
-		storage = token.NewSqlStorage(db)
+		storage = token.NewSqlStorage(db, cache)
 	} else {
-		storage = token.NewMongoStorage(client)
+		storage = token.NewMongoStorage(client, cache)
 	}
 
 	return token.NewService(storage)
 }
 
+func createInvalidationBus(cfg *config.Config, db *gorm.DB) invalidation.Bus {
+	switch cfg.Invalidation.Provider {
+	case "redis":
+		return invalidation.NewRedis(invalidation.RedisConfig{
+			Addr:     cfg.Databases.Redis.Addr,
+			Password: cfg.Databases.Redis.Password,
+			Channel:  cfg.Invalidation.Channel,
+		})
+	case "postgres":
+		return invalidation.NewPostgres(invalidation.PostgresConfig{
+			DB:      db,
+			DSN:     cfg.Databases.SQL.DSN,
+			Channel: cfg.Invalidation.Channel,
+		})
+	}
+
+	return invalidation.NewLocal()
+}
+
 func sessionIdGenerator() []byte {
 	data := make([]byte, 32)
 	n, err := rand.Read(data)
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/kms"
+	"github.com/BrosSquad/vaulguard/utils"
+	"github.com/spf13/cobra"
+)
+
+const keysPermission = 0700
+
+var ErrRotationInProgress = errors.New("previous key rotation is not finished, start the server to re-encrypt secrets first")
+
+type keysRotateCommand struct{}
+
+// NewKeysRotateCommand - Replaces the secret key with a new one, the old key is kept as previous
+// key until the server re-encrypts every secret with the new key and removes it
+func NewKeysRotateCommand() Command {
+	return keysRotateCommand{}
+}
+
+func (kc keysRotateCommand) Execute(cmd *cobra.Command, args []string) error {
+	configPath, err := cmd.Flags().GetString("config")
+
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(configPath)
+
+	if err != nil {
+		return err
+	}
+
+	secretKeyPath, err := utils.GetAbsolutePath(cfg.Keys.Secret)
+
+	if err != nil {
+		return err
+	}
+
+	if !utils.FileExists(secretKeyPath) {
+		return fmt.Errorf("%s does not exist, start the server to generate keys", secretKeyPath)
+	}
+
+	previousKeyPath := config.PreviousSecretKeyPath(secretKeyPath)
+
+	if utils.FileExists(previousKeyPath) {
+		return ErrRotationInProgress
+	}
+
+	ctx := context.Background()
+	manager, err := keyManager(cmd, cfg, secretKeyPath)
+
+	if err != nil {
+		return err
+	}
+
+	current, err := readSecretKey(ctx, manager, secretKeyPath)
+
+	if err != nil {
+		return fmt.Errorf("current secret key cannot be decrypted: %w", err)
+	}
+
+	if err := os.Rename(secretKeyPath, previousKeyPath); err != nil {
+		return err
+	}
+
+	key, err := generateSecretKey(ctx, manager, secretKeyPath)
+
+	if err != nil {
+		// Current key is put back, nothing was rotated
+		_ = os.Remove(secretKeyPath)
+
+		if renameErr := os.Rename(previousKeyPath, secretKeyPath); renameErr != nil {
+			return fmt.Errorf("%v, previous key is left in %s: %w", err, previousKeyPath, renameErr)
+		}
+
+		return err
+	}
+
+	fmt.Printf("Secret key rotated: %08x -> %08x\n", services.KeyID(current), services.KeyID(key))
+	fmt.Println("Restart every VaulGuard server, secrets are re-encrypted on boot and the previous key is removed afterwards")
+
+	return nil
+}
+
+func loadConfig(path string) (*config.Config, error) {
+	path, err := utils.GetAbsolutePath(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return config.New(file)
+}
+
+// keyManager - Sealed secret key is unwrapped with the unseal key recovered from --share flags
+func keyManager(cmd *cobra.Command, cfg *config.Config, secretKeyPath string) (kms.KeyManager, error) {
+	if cfg.Keys.Provider.Name != config.KeyProviderShamir {
+		return kms.New(cfg.Keys, false)
+	}
+
+	encoded, err := cmd.Flags().GetStringArray("share")
+
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := ioutil.ReadFile(secretKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := kms.UnsealThreshold(wrapped)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded) < threshold {
+		return nil, fmt.Errorf("%d unseal key shares are required, pass them with --share", threshold)
+	}
+
+	shares := make([][]byte, 0, len(encoded))
+
+	for _, e := range encoded {
+		share, err := base64.StdEncoding.DecodeString(e)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shares = append(shares, share)
+	}
+
+	return kms.NewUnsealKeyFromShares(shares, threshold)
+}
+
+func readSecretKey(ctx context.Context, manager kms.KeyManager, path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.Unwrap(ctx, data)
+}
+
+func generateSecretKey(ctx context.Context, manager kms.KeyManager, path string) ([]byte, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, keysPermission)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	key, err := kms.GenerateSecretKey(ctx, manager, file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return key, file.Sync()
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services/seal"
+	"github.com/BrosSquad/vaulguard/utils"
+	"github.com/spf13/cobra"
+)
+
+var ErrNotShamirProvider = errors.New("keys.provider.name has to be shamir")
+
+type (
+	initCommand   struct{}
+	unsealCommand struct{}
+)
+
+// NewInitCommand - Generates the secret key wrapped with unseal key and prints the unseal key shares,
+// shares are printed only once and should be handed to different operators
+func NewInitCommand() Command {
+	return initCommand{}
+}
+
+// NewUnsealCommand - Submits one unseal key share to the running server
+func NewUnsealCommand() Command {
+	return unsealCommand{}
+}
+
+func (ic initCommand) Execute(cmd *cobra.Command, args []string) error {
+	configPath, err := cmd.Flags().GetString("config")
+
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(configPath)
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.Keys.Provider.Name != config.KeyProviderShamir {
+		return ErrNotShamirProvider
+	}
+
+	secretKeyPath, err := utils.GetAbsolutePath(cfg.Keys.Secret)
+
+	if err != nil {
+		return err
+	}
+
+	if utils.FileExists(secretKeyPath) {
+		return fmt.Errorf("%s already exists, vaulguard is already initialized", secretKeyPath)
+	}
+
+	shamir := cfg.Keys.Provider.Shamir
+	shares, err := seal.Init(context.Background(), secretKeyPath, shamir.Shares, shamir.Threshold)
+
+	if err != nil {
+		return err
+	}
+
+	for i, share := range shares {
+		fmt.Printf("Unseal key share %d: %s\n", i+1, base64.StdEncoding.EncodeToString(share))
+	}
+
+	fmt.Printf("\nVaulGuard is initialized, %d of %d shares are required to unseal it\n", shamir.Threshold, shamir.Shares)
+	fmt.Println("Shares are not stored anywhere, distribute them to operators now")
+
+	return nil
+}
+
+func (uc unsealCommand) Execute(cmd *cobra.Command, args []string) error {
+	configPath, err := cmd.Flags().GetString("config")
+
+	if err != nil {
+		return err
+	}
+
+	address, err := cmd.Flags().GetString("address")
+
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(configPath)
+
+	if err != nil {
+		return err
+	}
+
+	if address == "" {
+		address = serverAddress(cfg.Http.Address)
+	}
+
+	var share string
+
+	if len(args) == 1 {
+		share = args[0]
+	} else {
+		fmt.Print("Unseal key share: ")
+
+		if share, err = bufio.NewReader(os.Stdin).ReadString('\n'); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(map[string]string{"share": strings.TrimSpace(share)})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(address, "/")+"/api/v1/sys/unseal", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "admin "+cfg.Http.AdminToken)
+
+	res, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	var status struct {
+		seal.Status
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+		return fmt.Errorf("unexpected response with status %d: %w", res.StatusCode, err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unseal failed with status %d: %s", res.StatusCode, status.Message)
+	}
+
+	if status.Sealed {
+		fmt.Printf("Share accepted, %d of %d shares submitted\n", status.Progress, status.Threshold)
+	} else {
+		fmt.Println("VaulGuard is unsealed")
+	}
+
+	return nil
+}
+
+// serverAddress - URL of the server listening on http.address, empty host is local server
+func serverAddress(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+
+	if err != nil {
+		return "http://" + listen
+	}
+
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	return "http://" + net.JoinHostPort(host, port)
+}
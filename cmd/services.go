@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/db"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/BrosSquad/vaulguard/utils"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+// Services - Services of the database from the config file, used by commands
+// which work with applications, tokens and secrets without the running server
+type Services struct {
+	Applications application.Service
+	Tokens       token.Service
+	// Secrets - Nil unless requested, it requires the secret key
+	Secrets secret.Service
+
+	cfg   *config.Config
+	sql   *gorm.DB
+	mongo *mongo.Client
+}
+
+// OpenServices - Connects to the database from --config. Secret service is created only with
+// withSecrets, secret key is unwrapped like by `keys rotate` (--share with shamir key provider)
+func OpenServices(ctx context.Context, cmd *cobra.Command, withSecrets bool) (*Services, error) {
+	configPath, err := cmd.Flags().GetString("config")
+
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadConfig(configPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Services{cfg: cfg}
+
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	if withSecrets {
+		if s.Secrets, err = s.secretService(ctx, cmd); err != nil {
+			_ = s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// connect - Schema is migrated by the server on boot, like the secret key it is not created here
+func (s *Services) connect(ctx context.Context) (err error) {
+	if s.cfg.UseSql {
+		provider, err := db.GetDatabaseProvider(s.cfg.Databases.SQL.Provider)
+
+		if err != nil {
+			return err
+		}
+
+		s.sql, err = db.ConnectToDatabaseProvider(db.GormConfig{
+			SQLProvider: provider,
+			DSN:         s.cfg.Databases.SQL.DSN,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		s.Applications = application.NewSqlService(s.sql)
+		s.Tokens = token.NewService(token.NewSqlStorage(s.sql, nil))
+
+		return nil
+	}
+
+	if s.mongo, err = db.ConnectToMongo(ctx, s.cfg.Databases.Mongo.URI); err != nil {
+		return err
+	}
+
+	database := s.mongo.Database(db.MongoDBName)
+	s.Applications = application.NewMongoService(database.Collection(db.ApplicationMongoCollection))
+	s.Tokens = token.NewService(token.NewMongoStorage(database.Collection(db.TokensMongoCollection), nil))
+
+	return nil
+}
+
+// secretService - Secret key is never generated here, the server creates it on first boot
+func (s *Services) secretService(ctx context.Context, cmd *cobra.Command) (secret.Service, error) {
+	algorithm, err := services.ParseAlgorithm(s.cfg.Keys.Cipher)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secretKeyPath, err := utils.GetAbsolutePath(s.cfg.Keys.Secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !utils.FileExists(secretKeyPath) {
+		return nil, fmt.Errorf("%s does not exist, start the server to generate keys", secretKeyPath)
+	}
+
+	manager, err := keyManager(cmd, s.cfg, secretKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := readSecretKey(ctx, manager, secretKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Encryption service keeps its own copies
+	defer locked.Wipe(key)
+
+	var previousKeys [][]byte
+	previousKeyPath := config.PreviousSecretKeyPath(secretKeyPath)
+
+	// Values are still sealed with the previous key until the server finishes the rotation
+	if utils.FileExists(previousKeyPath) {
+		previous, err := readSecretKey(ctx, manager, previousKeyPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer locked.Wipe(previous)
+		previousKeys = append(previousKeys, previous)
+	}
+
+	encryption, err := services.NewKeyedEncryptionWithAlgorithm(algorithm, key, previousKeys...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cache := secret.NewCache(secret.CacheConfig{})
+	requireAD := s.cfg.Secrets.AssociatedData == config.AssociatedDataRequired
+
+	if s.cfg.UseSql {
+		return secret.NewGormSecretStorage(secret.GormSecretConfig{
+			Encryption: encryption,
+			Keys:       datakey.NewKeyRing(encryption, datakey.NewSqlStorage(s.sql), algorithm),
+			Cache:      cache,
+			DB:         s.sql,
+
+			RequireAssociatedData: requireAD,
+		}), nil
+	}
+
+	database := s.mongo.Database(db.MongoDBName)
+
+	return secret.NewMongoClient(secret.MongoDBConfig{
+		Encryption: encryption,
+		Keys:       datakey.NewKeyRing(encryption, datakey.NewMongoStorage(database.Collection(db.ApplicationMongoCollection)), algorithm),
+		Cache:      cache,
+		Collection: database.Collection(db.SecretsMongoCollection),
+
+		RequireAssociatedData: requireAD,
+	}), nil
+}
+
+// Close - Closes the database connection
+func (s *Services) Close() error {
+	if s.mongo != nil {
+		return s.mongo.Disconnect(context.Background())
+	}
+
+	if s.sql != nil {
+		sqlDB, err := s.sql.DB()
+
+		if err != nil {
+			return err
+		}
+
+		return sqlDB.Close()
+	}
+
+	return nil
+}
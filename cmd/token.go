@@ -3,10 +3,16 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services/application"
 	"github.com/BrosSquad/vaulguard/services/token"
 	"github.com/spf13/cobra"
-	"log"
 )
 
 type tokenCommand struct {
@@ -23,7 +29,44 @@ func (tc tokenCommand) Execute(cmd *cobra.Command, args []string) error {
 		//log.Fatal(err)
 	}
 
-	tokenStr := tc.tokenService.Generate(tc.ctx, app.ID)
+	environments, err := cmd.Flags().GetStringSlice("env")
+
+	if err != nil {
+		return err
+	}
+
+	for _, environment := range environments {
+		if err := models.ValidateEnvironment(environment); err != nil {
+			return fmt.Errorf("%s: %w", environment, err)
+		}
+	}
+
+	scopes, err := cmd.Flags().GetStringSlice("scope")
+
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range scopes {
+		if err := models.ValidateScope(scope); err != nil {
+			return fmt.Errorf("%s: %w", scope, err)
+		}
+	}
+
+	expires, err := cmd.Flags().GetDuration("expires")
+
+	if err != nil {
+		return err
+	}
+
+	options := token.GenerateOptions{Environments: environments, Scopes: scopes}
+
+	if expires > 0 {
+		expiresAt := time.Now().Add(expires)
+		options.ExpiresAt = &expiresAt
+	}
+
+	tokenStr := tc.tokenService.Generate(tc.ctx, app.ID, options)
 
 	if tokenStr == "" {
 		log.Fatal("Error while generating Auth Token")
@@ -41,3 +84,106 @@ func NewTokenCommand(ctx context.Context, applicationService application.Service
 		tokenService:       tokenService,
 	}
 }
+
+type tokenRevokeCommand struct {
+	ctx          context.Context
+	tokenService token.Service
+}
+
+func (tc tokenRevokeCommand) Execute(cmd *cobra.Command, args []string) error {
+	id, err := token.ParseID(args[0])
+
+	if err != nil {
+		return err
+	}
+
+	if err := tc.tokenService.Revoke(tc.ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Printf("Token %s revoked\n", args[0])
+
+	return nil
+}
+
+func NewTokenRevokeCommand(ctx context.Context, tokenService token.Service) Command {
+	return tokenRevokeCommand{
+		ctx:          ctx,
+		tokenService: tokenService,
+	}
+}
+
+type tokenListCommand struct {
+	ctx                context.Context
+	applicationService application.Service
+	tokenService       token.Service
+}
+
+func (tc tokenListCommand) Execute(cmd *cobra.Command, args []string) error {
+	app, err := tc.applicationService.GetByName(tc.ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	tokens, err := tc.tokenService.List(tc.ctx, app.ID)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tENVIRONMENTS\tSCOPES\tCREATED\tEXPIRES\tSTATUS")
+
+	for _, t := range tokens {
+		environments := strings.Join(t.Environments, ",")
+
+		if environments == "" {
+			environments = "*"
+		}
+
+		scopes := strings.Join(t.Scopes, ",")
+
+		if scopes == "" {
+			scopes = "*"
+		}
+
+		expires := "never"
+
+		if t.ExpiresAt != nil {
+			expires = t.ExpiresAt.Format(time.RFC3339)
+		}
+
+		_, _ = fmt.Fprintf(w, "%v\t%s\t%s\t%s\t%s\t%s\n", tokenID(t.ID), environments, scopes, t.CreatedAt.Format(time.RFC3339), expires, tokenStatus(t, now))
+	}
+
+	return w.Flush()
+}
+
+func NewTokenListCommand(ctx context.Context, applicationService application.Service, tokenService token.Service) Command {
+	return tokenListCommand{
+		ctx:                ctx,
+		applicationService: applicationService,
+		tokenService:       tokenService,
+	}
+}
+
+func tokenID(id interface{}) string {
+	if hex, ok := id.(interface{ Hex() string }); ok {
+		return hex.Hex()
+	}
+
+	return fmt.Sprint(id)
+}
+
+func tokenStatus(t models.TokenDto, now time.Time) string {
+	switch {
+	case t.RevokedAt != nil:
+		return "revoked"
+	case !t.Active(now):
+		return "expired"
+	}
+
+	return "active"
+}
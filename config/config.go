@@ -10,7 +10,32 @@ import (
 	"github.com/go-yaml/yaml"
 )
 
-const EnvironmentalVariablesPrefix = "VAULGUARD_"
+const (
+	EnvironmentalVariablesPrefix = "VAULGUARD_"
+	DefaultSecretsReaperInterval = time.Minute
+	DefaultTokenCacheSize        = 1024
+	DefaultTokenCacheTTL         = time.Minute
+
+	// AssociatedDataOptional - Values are bound to application, environment and key, unbound values are still readable
+	AssociatedDataOptional = "optional"
+	// AssociatedDataMigrate - Like optional, server binds every existing value on boot
+	AssociatedDataMigrate = "migrate"
+	// AssociatedDataRequired - Unbound values are rejected
+	AssociatedDataRequired = "required"
+
+	// CipherXChaCha20Poly1305 - Default cipher of secret key encryption
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+	// CipherAES256GCM - AES-256-GCM with per value derived key, so random nonces stay safe
+	CipherAES256GCM = "aes-256-gcm"
+
+	KeyProviderFile        = "file"
+	KeyProviderPassphrase  = "passphrase"
+	KeyProviderKMS         = "kms"
+	KeyProviderShamir      = "shamir"
+	DefaultShamirShares    = 5
+	DefaultShamirThreshold = 3
+	DefaultKMSTimeout      = 10 * time.Second
+)
 
 var (
 	ErrDatabaseProviderEmpty = errors.New("database provider is required")
@@ -21,6 +46,14 @@ var (
 	ErrPublicKeyEmpty        = errors.New("public key is required")
 	ErrLocaleNotFound        = errors.New("locale is required for validation")
 	ErrMemoryUsageSleepEmpty = errors.New("memory usage sleep is required")
+	ErrInvalidationProvider  = errors.New("invalidation provider must be local, redis or postgres (with postgres SQL provider)")
+	ErrInvalidationPrefork   = errors.New("local invalidation provider cannot be used with prefork, every process would keep its own stale cache")
+	ErrAssociatedDataMode    = errors.New("secrets associated data must be optional, migrate or required")
+	ErrKeyProvider           = errors.New("key provider must be file, passphrase, kms or shamir")
+	ErrShamirShares          = errors.New("shamir threshold must be at least 2 and not greater than shares (at most 255)")
+	ErrShamirPrefork         = errors.New("shamir key provider cannot be used with prefork, every process would have to be unsealed")
+	ErrKMSEmpty              = errors.New("kms url and key_id are required")
+	ErrCipher                = errors.New("keys cipher must be xchacha20-poly1305 or aes-256-gcm")
 )
 
 type (
@@ -36,15 +69,55 @@ type (
 	}
 
 	Http struct {
-		Address string  `yaml:"address,omitempty"`
-		Session Session `yaml:"session:omitempty"`
-		Prefork bool    `yaml:"prefork,omitempty"`
+		Address    string  `yaml:"address,omitempty"`
+		AdminToken string  `yaml:"admin_token,omitempty"`
+		Session    Session `yaml:"session:omitempty"`
+		Prefork    bool    `yaml:"prefork,omitempty"`
+	}
+
+	// PassphraseProvider - Argon2id parameters used when the secret key is wrapped,
+	// unwrapping uses parameters stored with the wrapped key
+	PassphraseProvider struct {
+		File        string `yaml:"file,omitempty"`
+		Time        uint32 `yaml:"time,omitempty"`
+		Memory      uint32 `yaml:"memory,omitempty"`
+		Parallelism uint8  `yaml:"parallelism,omitempty"`
+	}
+
+	KMSProvider struct {
+		URL     string        `yaml:"url,omitempty"`
+		KeyID   string        `yaml:"key_id,omitempty"`
+		Token   string        `yaml:"token,omitempty"`
+		Timeout time.Duration `yaml:"timeout,omitempty"`
+	}
+
+	// ShamirProvider - Unseal key is split into shares by `vaulguard init`, server starts sealed
+	// until threshold of shares is submitted
+	ShamirProvider struct {
+		Shares    int `yaml:"shares,omitempty"`
+		Threshold int `yaml:"threshold,omitempty"`
+	}
+
+	// KeyProvider - Key manager which wraps the secret key stored on disk
+	KeyProvider struct {
+		Name       string             `yaml:"name,omitempty"`
+		Passphrase PassphraseProvider `yaml:"passphrase,omitempty"`
+		KMS        KMSProvider        `yaml:"kms,omitempty"`
+		Shamir     ShamirProvider     `yaml:"shamir,omitempty"`
 	}
 
 	Keys struct {
-		Private string `yaml:"private,omitempty"`
-		Public  string `yaml:"public,omitempty"`
-		Secret  string `yaml:"secret,omitempty"`
+		Private  string      `yaml:"private,omitempty"`
+		Public   string      `yaml:"public,omitempty"`
+		Secret   string      `yaml:"secret,omitempty"`
+		Provider KeyProvider `yaml:"provider,omitempty"`
+		// EncryptPrivateKey - Private key of the file provider is sealed with the passphrase (Argon2id),
+		// passphrase is read like the one of passphrase provider
+		EncryptPrivateKey bool `yaml:"encrypt_private_key,omitempty"`
+		// RotationBatch - Secrets re-encrypted at once after key rotation
+		RotationBatch int `yaml:"rotation_batch,omitempty"`
+		// Cipher - Cipher new values are sealed with, values sealed with the other one stay readable
+		Cipher string `yaml:"cipher,omitempty"`
 	}
 
 	Logging struct {
@@ -71,26 +144,58 @@ type (
 		Redis Redis `yaml:"redis,omitempty"`
 	}
 
+	SecretsCache struct {
+		Entries int           `yaml:"entries,omitempty"`
+		Bytes   int64         `yaml:"bytes,omitempty"`
+		TTL     time.Duration `yaml:"ttl,omitempty"`
+	}
+
+	Secrets struct {
+		ReaperInterval time.Duration `yaml:"reaper,omitempty"`
+		Cache          SecretsCache  `yaml:"cache,omitempty"`
+		// AssociatedData - optional, migrate (binds existing values on boot) or required
+		AssociatedData string `yaml:"associated_data,omitempty"`
+	}
+
+	Tokens struct {
+		CacheSize int           `yaml:"cache_size,omitempty"`
+		CacheTTL  time.Duration `yaml:"cache_ttl,omitempty"`
+	}
+
+	// Invalidation - Bus which keeps caches of all processes (prefork workers, replicas) consistent
+	Invalidation struct {
+		Provider string `yaml:"provider,omitempty"`
+		Channel  string `yaml:"channel,omitempty"`
+	}
+
 	MemoryUsage struct {
 		Report bool          `yaml:"report,omitempty"`
 		Sleep  time.Duration `yaml:"sleep,omitempty"`
 	}
 
 	Config struct {
-		ApplicationKey []byte      `yaml:"-"`
-		Locale         string      `yaml:"locale,omitempty"`
-		Http           Http        `yaml:"http,omitempty"`
-		Keys           Keys        `yaml:"keys,omitempty"`
-		Logging        Logging     `yaml:"log,omitempty"`
-		Databases      Databases   `yaml:"databases,omitempty"`
-		MemoryUsage    MemoryUsage `yaml:"memory,omitempty"`
-		UseConsole     bool        `yaml:"console,omitempty"`
-		Debug          bool        `yaml:"debug,omitempty"`
-		UseSql         bool        `yaml:"sql,omitempty"`
-		UseDashboard   bool        `yaml:"dashboard,omitempty"`
+		Locale       string       `yaml:"locale,omitempty"`
+		Http         Http         `yaml:"http,omitempty"`
+		Keys         Keys         `yaml:"keys,omitempty"`
+		Logging      Logging      `yaml:"log,omitempty"`
+		Databases    Databases    `yaml:"databases,omitempty"`
+		MemoryUsage  MemoryUsage  `yaml:"memory,omitempty"`
+		Secrets      Secrets      `yaml:"secrets,omitempty"`
+		Tokens       Tokens       `yaml:"tokens,omitempty"`
+		Invalidation Invalidation `yaml:"invalidation,omitempty"`
+		UseConsole   bool         `yaml:"console,omitempty"`
+		Debug        bool         `yaml:"debug,omitempty"`
+		UseSql       bool         `yaml:"sql,omitempty"`
+		UseDashboard bool         `yaml:"dashboard,omitempty"`
 	}
 )
 
+// PreviousSecretKeyPath - Secret key replaced by rotation is kept next to
+// the current one until every value is re-encrypted with the new key
+func PreviousSecretKeyPath(secretKeyPath string) string {
+	return secretKeyPath + ".previous"
+}
+
 func (c Config) Validate() error {
 	if c.UseSql {
 		if c.Databases.SQL.DSN == "" {
@@ -109,12 +214,38 @@ func (c Config) Validate() error {
 		return ErrAddressEmpty
 	}
 
-	if c.Keys.Private == "" {
-		return ErrPrivateKeyEmpty
+	switch c.Keys.Provider.Name {
+	case KeyProviderFile:
+		if c.Keys.Private == "" {
+			return ErrPrivateKeyEmpty
+		}
+
+		if c.Keys.Public == "" {
+			return ErrPublicKeyEmpty
+		}
+	case KeyProviderPassphrase:
+	case KeyProviderKMS:
+		if c.Keys.Provider.KMS.URL == "" || c.Keys.Provider.KMS.KeyID == "" {
+			return ErrKMSEmpty
+		}
+	case KeyProviderShamir:
+		shamir := c.Keys.Provider.Shamir
+
+		if shamir.Threshold < 2 || shamir.Shares < shamir.Threshold || shamir.Shares > 255 {
+			return ErrShamirShares
+		}
+
+		if c.Http.Prefork {
+			return ErrShamirPrefork
+		}
+	default:
+		return ErrKeyProvider
 	}
 
-	if c.Keys.Public == "" {
-		return ErrPublicKeyEmpty
+	switch c.Keys.Cipher {
+	case CipherXChaCha20Poly1305, CipherAES256GCM:
+	default:
+		return ErrCipher
 	}
 
 	if c.Locale == "" {
@@ -125,6 +256,26 @@ func (c Config) Validate() error {
 		return ErrMemoryUsageSleepEmpty
 	}
 
+	switch c.Invalidation.Provider {
+	case "", "local":
+		if c.Http.Prefork {
+			return ErrInvalidationPrefork
+		}
+	case "redis":
+	case "postgres":
+		if !c.UseSql || c.Databases.SQL.Provider != "postgres" {
+			return ErrInvalidationProvider
+		}
+	default:
+		return ErrInvalidationProvider
+	}
+
+	switch c.Secrets.AssociatedData {
+	case AssociatedDataOptional, AssociatedDataMigrate, AssociatedDataRequired:
+	default:
+		return ErrAssociatedDataMode
+	}
+
 	// TODO: Add HTTP Session Validation
 	if c.UseDashboard {
 
@@ -147,6 +298,11 @@ func (c *Config) loadEnvironmentalVariables() (err error) {
 		c.Http.Address = address
 	}
 
+	adminToken := os.Getenv(EnvironmentalVariablesPrefix + "ADMIN_TOKEN")
+	if adminToken != "" {
+		c.Http.AdminToken = adminToken
+	}
+
 	publicKey := os.Getenv(EnvironmentalVariablesPrefix + "PUBLIC_KEY")
 	if publicKey != "" {
 		c.Keys.Public = publicKey
@@ -162,6 +318,40 @@ func (c *Config) loadEnvironmentalVariables() (err error) {
 		c.Keys.Public = secretKey
 	}
 
+	keyProvider := os.Getenv(EnvironmentalVariablesPrefix + "KEY_PROVIDER")
+	if keyProvider != "" {
+		c.Keys.Provider.Name = keyProvider
+	}
+
+	cipher := os.Getenv(EnvironmentalVariablesPrefix + "CIPHER")
+	if cipher != "" {
+		c.Keys.Cipher = cipher
+	}
+
+	encryptPrivateKey := os.Getenv(EnvironmentalVariablesPrefix + "ENCRYPT_PRIVATE_KEY")
+	if encryptPrivateKey != "" {
+		c.Keys.EncryptPrivateKey, err = strconv.ParseBool(encryptPrivateKey)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	keyPassphraseFile := os.Getenv(EnvironmentalVariablesPrefix + "KEY_PASSPHRASE_FILE")
+	if keyPassphraseFile != "" {
+		c.Keys.Provider.Passphrase.File = keyPassphraseFile
+	}
+
+	kmsURL := os.Getenv(EnvironmentalVariablesPrefix + "KMS_URL")
+	if kmsURL != "" {
+		c.Keys.Provider.KMS.URL = kmsURL
+	}
+
+	kmsToken := os.Getenv(EnvironmentalVariablesPrefix + "KMS_TOKEN")
+	if kmsToken != "" {
+		c.Keys.Provider.KMS.Token = kmsToken
+	}
+
 	loggingLevel := os.Getenv(EnvironmentalVariablesPrefix + "LOGGING_LEVEL")
 	if loggingLevel != "" {
 		c.Logging.Level = loggingLevel
@@ -227,6 +417,64 @@ func (c *Config) loadEnvironmentalVariables() (err error) {
 		}
 	}
 
+	secretsReaperInterval := os.Getenv(EnvironmentalVariablesPrefix + "SECRETS_REAPER_INTERVAL")
+	if secretsReaperInterval != "" {
+		c.Secrets.ReaperInterval, err = time.ParseDuration(secretsReaperInterval)
+		if err != nil {
+			return err
+		}
+	}
+
+	secretsCacheEntries := os.Getenv(EnvironmentalVariablesPrefix + "SECRETS_CACHE_ENTRIES")
+	if secretsCacheEntries != "" {
+		c.Secrets.Cache.Entries, err = strconv.Atoi(secretsCacheEntries)
+		if err != nil {
+			return err
+		}
+	}
+
+	secretsCacheBytes := os.Getenv(EnvironmentalVariablesPrefix + "SECRETS_CACHE_BYTES")
+	if secretsCacheBytes != "" {
+		c.Secrets.Cache.Bytes, err = strconv.ParseInt(secretsCacheBytes, 10, 64)
+		if err != nil {
+			return err
+		}
+	}
+
+	secretsCacheTTL := os.Getenv(EnvironmentalVariablesPrefix + "SECRETS_CACHE_TTL")
+	if secretsCacheTTL != "" {
+		c.Secrets.Cache.TTL, err = time.ParseDuration(secretsCacheTTL)
+		if err != nil {
+			return err
+		}
+	}
+
+	secretsAssociatedData := os.Getenv(EnvironmentalVariablesPrefix + "SECRETS_ASSOCIATED_DATA")
+	if secretsAssociatedData != "" {
+		c.Secrets.AssociatedData = secretsAssociatedData
+	}
+
+	invalidationProvider := os.Getenv(EnvironmentalVariablesPrefix + "INVALIDATION_PROVIDER")
+	if invalidationProvider != "" {
+		c.Invalidation.Provider = invalidationProvider
+	}
+
+	tokenCacheSize := os.Getenv(EnvironmentalVariablesPrefix + "TOKEN_CACHE_SIZE")
+	if tokenCacheSize != "" {
+		c.Tokens.CacheSize, err = strconv.Atoi(tokenCacheSize)
+		if err != nil {
+			return err
+		}
+	}
+
+	tokenCacheTTL := os.Getenv(EnvironmentalVariablesPrefix + "TOKEN_CACHE_TTL")
+	if tokenCacheTTL != "" {
+		c.Tokens.CacheTTL, err = time.ParseDuration(tokenCacheTTL)
+		if err != nil {
+			return err
+		}
+	}
+
 	sessionCookieName := os.Getenv(EnvironmentalVariablesPrefix + "SESSION_COOKIE_NAME")
 	if sessionCookieName != "" {
 		c.Http.Session.CookieName = sessionCookieName
@@ -302,6 +550,42 @@ func New(r io.Reader) (*Config, error) {
 		return nil, err
 	}
 
+	if config.Secrets.ReaperInterval == 0 {
+		config.Secrets.ReaperInterval = DefaultSecretsReaperInterval
+	}
+
+	if config.Keys.Provider.Name == "" {
+		config.Keys.Provider.Name = KeyProviderFile
+	}
+
+	if config.Keys.Cipher == "" {
+		config.Keys.Cipher = CipherXChaCha20Poly1305
+	}
+
+	if config.Keys.Provider.Shamir.Shares == 0 {
+		config.Keys.Provider.Shamir.Shares = DefaultShamirShares
+	}
+
+	if config.Keys.Provider.Shamir.Threshold == 0 {
+		config.Keys.Provider.Shamir.Threshold = DefaultShamirThreshold
+	}
+
+	if config.Keys.Provider.KMS.Timeout == 0 {
+		config.Keys.Provider.KMS.Timeout = DefaultKMSTimeout
+	}
+
+	if config.Secrets.AssociatedData == "" {
+		config.Secrets.AssociatedData = AssociatedDataOptional
+	}
+
+	if config.Tokens.CacheSize == 0 {
+		config.Tokens.CacheSize = DefaultTokenCacheSize
+	}
+
+	if config.Tokens.CacheTTL == 0 {
+		config.Tokens.CacheTTL = DefaultTokenCacheTTL
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+locale: en
+sql: true
+keys:
+  private: ./keys/private.key
+  public: ./keys/public.key
+databases:
+  sql:
+    provider: postgres
+    dsn: host=localhost
+http:
+  address: :4000
+`
+
+func TestPreforkInvalidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		config   string
+		expected error
+	}{
+		{"DefaultProvider", testConfig + "  prefork: true\n", ErrInvalidationPrefork},
+		{"LocalProvider", testConfig + "  prefork: true\ninvalidation:\n  provider: local\n", ErrInvalidationPrefork},
+		{"RedisProvider", testConfig + "  prefork: true\ninvalidation:\n  provider: redis\n", nil},
+		{"PostgresProvider", testConfig + "  prefork: true\ninvalidation:\n  provider: postgres\n", nil},
+		{"LocalWithoutPrefork", testConfig + "invalidation:\n  provider: local\n", nil},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			asserts := require.New(t)
+
+			_, err := New(strings.NewReader(test.config))
+			asserts.Equal(test.expected, err)
+		})
+	}
+}
@@ -11,8 +11,10 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"gorm.io/gorm/logger"
 
+	mysqlDriver "github.com/go-sql-driver/mysql"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -37,6 +39,7 @@ const (
 	TokensMongoCollection      = "tokens"
 	ApplicationMongoCollection = "applications"
 	SecretsMongoCollection     = "secrets"
+	TransitKeysMongoCollection = "transit_keys"
 
 	PostgreSQL Provider = iota + 1
 	MySQL
@@ -64,7 +67,11 @@ func ConnectToMongo(ctx context.Context, url string) (_ *mongo.Client, err error
 }
 
 func MongoCreateCollections(ctx context.Context, client *mongo.Client) error {
-	database := client.Database(MongoDBName)
+	return MongoMigrate(ctx, client.Database(MongoDBName))
+}
+
+// MongoMigrate - Creates collections and indexes in the database
+func MongoMigrate(ctx context.Context, database *mongo.Database) error {
 
 	if err := database.CreateCollection(ctx, TokensMongoCollection); err != nil {
 		if _, ok := err.(mongo.CommandError); !ok {
@@ -99,28 +106,58 @@ func MongoCreateCollections(ctx context.Context, client *mongo.Client) error {
 		}
 	}
 
+	secrets := database.Collection(SecretsMongoCollection)
+
+	// Keys are unique only inside of application environment and values are never unique,
+	// indexes created by older versions are dropped
+	for _, index := range []string{"Key_1", "Value_1", "Key_1_ApplicationId_1", "ApplicationId_1_Key_1"} {
+		if _, err := secrets.Indexes().DropOne(ctx, index); err != nil {
+			if _, ok := err.(mongo.CommandError); !ok {
+				return err
+			}
+		}
+	}
+
 	secretIndexes := []mongo.IndexModel{
 		{
-			Keys: bson.M{
-				"Key": 1,
+			Keys: bson.D{
+				{Key: "ApplicationId", Value: 1},
+				{Key: "Environment", Value: 1},
+				{Key: "Key", Value: 1},
 			},
 			Options: options.Index().SetUnique(true),
 		},
 		{
 			Keys: bson.M{
-				"Value": 1,
+				"ExpiresAt": 1,
 			},
-			Options: options.Index().SetUnique(true),
 		},
+	}
+
+	_, err = secrets.Indexes().CreateMany(ctx, secretIndexes)
+
+	if err != nil {
+		return err
+	}
+
+	if err := database.CreateCollection(ctx, TransitKeysMongoCollection); err != nil {
+		if _, ok := err.(mongo.CommandError); !ok {
+			return err
+		}
+	}
+
+	transitKeyIndexes := []mongo.IndexModel{
 		{
-			Keys: bson.M{
-				"Key":           1,
-				"ApplicationId": 1,
+			Keys: bson.D{
+				{Key: "ApplicationId", Value: 1},
+				{Key: "Name", Value: 1},
+				{Key: "Version", Value: 1},
 			},
+			Options: options.Index().SetUnique(true),
 		},
 	}
 
-	_, err = database.Collection(SecretsMongoCollection).Indexes().CreateMany(ctx, secretIndexes)
+	_, err = database.Collection(TransitKeysMongoCollection).Indexes().CreateMany(ctx, transitKeyIndexes)
 
 	if err != nil {
 		return err
@@ -134,9 +171,21 @@ func SqlMigrate(dbConn *gorm.DB) error {
 		&models.Application{},
 		&models.Token{},
 		&models.Secret{},
+		&models.SecretVersion{},
+		&models.TransitKey{},
+	}
+
+	if err := dbConn.AutoMigrate(dst...); err != nil {
+		return err
+	}
+
+	// Secrets used to be unique per application only, environments require
+	// the key to be unique per application and environment
+	if dbConn.Migrator().HasIndex(&models.Secret{}, "application_id_key_idx") {
+		return dbConn.Migrator().DropIndex(&models.Secret{}, "application_id_key_idx")
 	}
 
-	return dbConn.AutoMigrate(dst...)
+	return nil
 }
 
 func GetDatabaseProvider(provider string) (Provider, error) {
@@ -181,7 +230,7 @@ func ConnectToDatabaseProvider(config GormConfig) (_ *gorm.DB, err error) {
 		return connectToSQLite(config.DSN, gormConfig)
 	}
 
-	return nil, nil
+	return nil, ErrDatabaseProviderNotSupported
 }
 
 // ConnectToPostgres - Connects to the running postgres database instance
@@ -191,8 +240,20 @@ func connectToPostgreSQL(dsn string, config *gorm.Config) (*gorm.DB, error) {
 	}), config)
 }
 
+// connectToMySQL - Connects to the running MySQL database instance, DATETIME columns
+// are always parsed into time.Time so parseTime is forced in the DSN
 func connectToMySQL(dsn string, config *gorm.Config) (*gorm.DB, error) {
-	return nil, nil
+	mysqlConfig, err := mysqlDriver.ParseDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mysqlConfig.ParseTime = true
+
+	return gorm.Open(mysql.New(mysql.Config{
+		DSN: mysqlConfig.FormatDSN(),
+	}), config)
 }
 
 func connectToSQLite(dsn string, config *gorm.Config) (*gorm.DB, error) {
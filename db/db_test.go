@@ -0,0 +1,24 @@
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConnectToDatabaseProvider(t *testing.T) {
+	t.Parallel()
+
+	t.Run("UnknownProvider", func(t *testing.T) {
+		conn, err := ConnectToDatabaseProvider(GormConfig{SQLProvider: Provider(100), DSN: "dsn"})
+
+		if conn != nil || !errors.Is(err, ErrDatabaseProviderNotSupported) {
+			t.Fatalf("Expected provider not supported error, GOT: %v", err)
+		}
+	})
+
+	t.Run("InvalidMySQLDSN", func(t *testing.T) {
+		if _, err := ConnectToDatabaseProvider(GormConfig{SQLProvider: MySQL, DSN: "not a dsn"}); err == nil {
+			t.Fatal("Invalid MySQL DSN should be rejected")
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package db
+
+import (
+	"errors"
+
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	mysqlDuplicateEntry     = 1062
+	postgresUniqueViolation = "23505"
+)
+
+// IsUniqueViolation - Reports whether the write failed on a unique index,
+// every supported SQL provider reports it with its own driver error
+func IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	var mysqlErr *mysqlDriver.MySQLError
+
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDuplicateEntry
+	}
+
+	var postgresErr *pgconn.PgError
+
+	if errors.As(err, &postgresErr) {
+		return postgresErr.Code == postgresUniqueViolation
+	}
+
+	return false
+}
@@ -10,13 +10,18 @@ require (
 	github.com/go-playground/locales v0.13.0
 	github.com/go-playground/universal-translator v0.17.0
 	github.com/go-playground/validator/v10 v10.4.0
+	github.com/go-redis/redis/v8 v8.3.1
+	github.com/go-sql-driver/mysql v1.5.0
 	github.com/go-yaml/yaml v2.1.0+incompatible
 	github.com/gofiber/fiber/v2 v2.1.2
 	github.com/gofiber/session/v2 v2.0.2
 	github.com/gofiber/utils v0.1.0
 	github.com/golang/snappy v0.0.2 // indirect
+	github.com/jackc/pgconn v1.6.4
 	github.com/jackc/pgproto3/v2 v2.0.5 // indirect
+	github.com/jackc/pgx/v4 v4.8.1
 	github.com/klauspost/compress v1.11.2 // indirect
+	github.com/mattn/go-sqlite3 v1.14.4
 	github.com/philhofer/fwd v1.1.0 // indirect
 	github.com/rs/zerolog v1.20.0
 	github.com/spf13/cobra v1.1.1
@@ -28,10 +33,11 @@ require (
 	golang.org/x/crypto v0.0.0-20201016220609-9e8e0b390897
 	golang.org/x/net v0.0.0-20200822124328-c89045814202 // indirect
 	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9 // indirect
-	golang.org/x/sys v0.0.0-20201029080932-201ba4db2418 // indirect
+	golang.org/x/sys v0.0.0-20201029080932-201ba4db2418
 	golang.org/x/text v0.3.4 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
+	gorm.io/driver/mysql v1.0.1
 	gorm.io/driver/postgres v1.0.1
 	gorm.io/driver/sqlite v1.1.3
 	gorm.io/gorm v1.20.5
@@ -1,64 +1,235 @@
 package handlers
 
 import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/BrosSquad/vaulguard/middleware"
+	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/invalidation"
 )
 
-func RegisterApplicationHandlers(service application.Service, r fiber.Router) {
-	r.Get("/", getApplications(service)).Use(middleware.ParsePageAndPerPage)
-	r.Get("/search", searchApplications(service))
-	r.Get("/:id", getApplication(service))
-	r.Post("/", createApplication(service))
-	r.Put("/:id", updateApplication(service))
-	r.Delete("/:id", deleteApplication(service))
+// maxApplicationsPerPage - Upper bound of perPage for listing and searching applications
+const maxApplicationsPerPage = 100
+
+type applicationHandlers struct {
+	validator   *validator.Validate
+	service     application.Service
+	invalidator *invalidation.Invalidator
+}
+
+// applicationResponse - Application as seen by the administrator, data key never leaves the server
+type applicationResponse struct {
+	ID        interface{} `json:"id"`
+	Name      string      `json:"name"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// applicationPayload - Body of create and update requests
+type applicationPayload struct {
+	Name string `json:"name" validate:"required,max=255"`
 }
 
-func getApplications(service application.Service) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		ctx := c.Context()
-		page := c.Locals("page").(int)
-		perPage := c.Locals("perPage").(int)
-		apps, err := service.Get(ctx, page, perPage)
+// RegisterApplicationHandlers - Invalidator can be nil, then only caches of this process
+// are left to expire after renamed or deleted application
+func RegisterApplicationHandlers(validate *validator.Validate, service application.Service, invalidator *invalidation.Invalidator, r fiber.Router) {
+	applicationHandlers := applicationHandlers{
+		validator:   validate,
+		service:     service,
+		invalidator: invalidator,
+	}
 
-		if err != nil {
-			return fiber.ErrInternalServerError
-		}
+	r.Get("/", middleware.ParsePageAndPerPage, applicationHandlers.getApplications)
+	r.Get("/search", middleware.ParsePageAndPerPage, applicationHandlers.searchApplications)
+	r.Get("/:id", applicationHandlers.getApplication)
+	r.Post("/", applicationHandlers.createApplication)
+	r.Put("/:id", applicationHandlers.updateApplication)
+	r.Delete("/:id", applicationHandlers.deleteApplication)
+}
 
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"data": apps,
-		})
+func applicationIDParam(c *fiber.Ctx) (interface{}, error) {
+	id, err := application.ParseID(c.Params("id"))
+
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
 	}
+
+	return id, nil
 }
 
-func getApplication(service application.Service) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return nil
+// applicationsPage - Page and perPage parsed by middleware.ParsePageAndPerPage, checked against the bounds
+func applicationsPage(c *fiber.Ctx) (int, int, error) {
+	page := c.Locals("page").(int)
+	perPage := c.Locals("perPage").(int)
+
+	if page < 1 {
+		return 0, 0, fiber.NewError(fiber.StatusUnprocessableEntity, "page must be at least 1")
+	}
+
+	if perPage < 1 || perPage > maxApplicationsPerPage {
+		return 0, 0, fiber.NewError(fiber.StatusUnprocessableEntity, "perPage must be between 1 and 100")
 	}
+
+	return page, perPage, nil
 }
 
-func searchApplications(service application.Service) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return nil
+func newApplicationResponse(app models.ApplicationDto) applicationResponse {
+	return applicationResponse{
+		ID:        app.ID,
+		Name:      app.Name,
+		CreatedAt: app.CreatedAt,
+		UpdatedAt: app.UpdatedAt,
 	}
 }
 
-func createApplication(service application.Service) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return nil
+func applicationsResponse(apps []models.ApplicationDto) fiber.Map {
+	response := make([]applicationResponse, 0, len(apps))
+
+	for _, app := range apps {
+		response = append(response, newApplicationResponse(app))
+	}
+
+	return fiber.Map{
+		"data": response,
 	}
 }
 
-func updateApplication(service application.Service) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return nil
+func (a applicationHandlers) parsePayload(c *fiber.Ctx) (applicationPayload, error) {
+	var p applicationPayload
+
+	if err := c.BodyParser(&p); err != nil {
+		return p, fiber.ErrBadRequest
 	}
+
+	return p, a.validator.Struct(p)
 }
 
-func deleteApplication(service application.Service) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		return nil
+// applicationChanged - Tokens and secrets cached with the old application are dropped in every process
+func (a applicationHandlers) applicationChanged(id interface{}) {
+	if a.invalidator != nil {
+		a.invalidator.ApplicationChanged(id)
+	}
+}
+
+func (a applicationHandlers) getApplications(c *fiber.Ctx) error {
+	page, perPage, err := applicationsPage(c)
+
+	if err != nil {
+		return err
+	}
+
+	apps, err := a.service.Get(c.Context(), page, perPage)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(applicationsResponse(apps))
+}
+
+func (a applicationHandlers) getApplication(c *fiber.Ctx) error {
+	id, err := applicationIDParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := a.service.GetOne(c.Context(), id)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(newApplicationResponse(app))
+}
+
+// searchApplications - Applications whose name contains ?name=, case insensitive
+func (a applicationHandlers) searchApplications(c *fiber.Ctx) error {
+	name := c.Query("name")
+
+	if name == "" {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "name query parameter is required")
 	}
+
+	page, perPage, err := applicationsPage(c)
+
+	if err != nil {
+		return err
+	}
+
+	apps, err := a.service.Search(c.Context(), name, page, perPage)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(applicationsResponse(apps))
+}
+
+func (a applicationHandlers) createApplication(c *fiber.Ctx) error {
+	p, err := a.parsePayload(c)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := a.service.Create(c.Context(), p.Name)
+
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(newApplicationResponse(app))
+}
+
+func (a applicationHandlers) updateApplication(c *fiber.Ctx) error {
+	id, err := applicationIDParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	p, err := a.parsePayload(c)
+
+	if err != nil {
+		return err
+	}
+
+	app, err := a.service.Update(c.Context(), id, p.Name)
+
+	if err != nil {
+		return err
+	}
+
+	a.applicationChanged(app.ID)
+
+	return c.JSON(newApplicationResponse(app))
+}
+
+// deleteApplication - Tokens, secrets and transit keys of the application are deleted with it
+func (a applicationHandlers) deleteApplication(c *fiber.Ctx) error {
+	id, err := applicationIDParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	// Delete does not report missing applications
+	app, err := a.service.GetOne(c.Context(), id)
+
+	if err != nil {
+		return err
+	}
+
+	if err := a.service.Delete(c.Context(), app.ID); err != nil {
+		return err
+	}
+
+	a.applicationChanged(app.ID)
+
+	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/middleware"
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/invalidation"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestApplicationHandlers(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	path, err := filepath.Abs("./application_handlers.db")
+	asserts.Nil(err)
+	defer os.Remove(path)
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	asserts.Nil(err)
+	asserts.Nil(db.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}, &models.TransitKey{}))
+
+	service := application.NewSqlService(db)
+	tokenCache := token.NewCache(10, time.Minute)
+	invalidator := invalidation.NewInvalidator(invalidation.NewLocal(), invalidation.Caches{Tokens: tokenCache}, nil)
+
+	english := en.New()
+	uni := ut.New(english, english)
+	englishTranslations, _ := uni.GetTranslator("en")
+	fiberApp := fiber.New(fiber.Config{
+		ErrorHandler: Error(englishTranslations),
+	})
+	applicationsGroup := fiberApp.Group("/applications")
+	applicationsGroup.Use(middleware.AdminAuth("admin-token"))
+	RegisterApplicationHandlers(validator.New(), service, invalidator, applicationsGroup)
+
+	request := func(method, target, body string) *http.Response {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(fiber.HeaderAuthorization, "admin admin-token")
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		res, err := fiberApp.Test(req)
+		asserts.Nil(err)
+		return res
+	}
+
+	decode := func(res *http.Response, out interface{}) {
+		asserts.Nil(json.NewDecoder(res.Body).Decode(out))
+	}
+
+	t.Run("AdminTokenRequired", func(t *testing.T) {
+		res, err := fiberApp.Test(httptest.NewRequest(http.MethodGet, "/applications", nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusUnauthorized, res.StatusCode)
+
+		req := httptest.NewRequest(http.MethodDelete, "/applications/1", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "admin wrong")
+		res, err = fiberApp.Test(req)
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusUnauthorized, res.StatusCode)
+	})
+
+	var created applicationResponse
+
+	t.Run("CreateApplication", func(t *testing.T) {
+		res := request(http.MethodPost, "/applications", `{"name": "Billing"}`)
+		asserts.Equal(fiber.StatusCreated, res.StatusCode)
+		decode(res, &created)
+		asserts.Equal("Billing", created.Name)
+		asserts.NotNil(created.ID)
+
+		res = request(http.MethodPost, "/applications", `{"name": "Billing"}`)
+		asserts.Equal(fiber.StatusConflict, res.StatusCode)
+
+		res = request(http.MethodPost, "/applications", `{"name": ""}`)
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+
+		res = request(http.MethodPost, "/applications", `{"name": "`+strings.Repeat("a", 256)+`"}`)
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+
+		res = request(http.MethodPost, "/applications", `{"name":`)
+		asserts.Equal(fiber.StatusBadRequest, res.StatusCode)
+	})
+
+	id := func() string {
+		return strconv.FormatFloat(created.ID.(float64), 'f', 0, 64)
+	}
+
+	t.Run("GetApplication", func(t *testing.T) {
+		res := request(http.MethodGet, "/applications/"+id(), "")
+		asserts.Equal(fiber.StatusOK, res.StatusCode)
+
+		var app applicationResponse
+		decode(res, &app)
+		asserts.Equal("Billing", app.Name)
+
+		res = request(http.MethodGet, "/applications/152000", "")
+		asserts.Equal(fiber.StatusNotFound, res.StatusCode)
+
+		res = request(http.MethodGet, "/applications/invalid", "")
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+
+	t.Run("ListAndSearchApplications", func(t *testing.T) {
+		res := request(http.MethodPost, "/applications", `{"name": "Billing API"}`)
+		asserts.Equal(fiber.StatusCreated, res.StatusCode)
+
+		var list struct {
+			Data []applicationResponse `json:"data"`
+		}
+
+		res = request(http.MethodGet, "/applications?page=1&perPage=10", "")
+		asserts.Equal(fiber.StatusOK, res.StatusCode)
+		decode(res, &list)
+		asserts.Len(list.Data, 2)
+
+		res = request(http.MethodGet, "/applications/search?name=api", "")
+		asserts.Equal(fiber.StatusOK, res.StatusCode)
+		decode(res, &list)
+		asserts.Len(list.Data, 1)
+		asserts.Equal("Billing API", list.Data[0].Name)
+
+		res = request(http.MethodGet, "/applications/search", "")
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+
+		res = request(http.MethodGet, "/applications?perPage=1000", "")
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+
+		res = request(http.MethodGet, "/applications?page=0", "")
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+
+	t.Run("UpdateApplication", func(t *testing.T) {
+		appID := uint(created.ID.(float64))
+		tokenCache.Set(uint(1), models.TokenDto{ID: uint(1), ApplicationId: appID})
+
+		res := request(http.MethodPut, "/applications/"+id(), `{"name": "Payments"}`)
+		asserts.Equal(fiber.StatusOK, res.StatusCode)
+
+		var app applicationResponse
+		decode(res, &app)
+		asserts.Equal("Payments", app.Name)
+
+		_, cached := tokenCache.Get(uint(1))
+		asserts.False(cached, "tokens carry the old application name")
+
+		res = request(http.MethodPut, "/applications/"+id(), `{"name": "Billing API"}`)
+		asserts.Equal(fiber.StatusConflict, res.StatusCode)
+
+		res = request(http.MethodPut, "/applications/152000", `{"name": "Missing"}`)
+		asserts.Equal(fiber.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("DeleteApplication", func(t *testing.T) {
+		ctx := context.Background()
+		tokenService := token.NewService(token.NewSqlStorage(db, tokenCache))
+		value := tokenService.Generate(ctx, uint(created.ID.(float64)), token.GenerateOptions{})
+		_, ok := tokenService.Verify(ctx, value)
+		asserts.True(ok)
+
+		res := request(http.MethodDelete, "/applications/"+id(), "")
+		asserts.Equal(fiber.StatusNoContent, res.StatusCode)
+
+		_, ok = tokenService.Verify(ctx, value)
+		asserts.False(ok, "tokens of the deleted application stop working")
+
+		res = request(http.MethodDelete, "/applications/"+id(), "")
+		asserts.Equal(fiber.StatusNotFound, res.StatusCode)
+	})
+}
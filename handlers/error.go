@@ -4,9 +4,13 @@ import (
 	"errors"
 
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/seal"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/transit"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo"
 	"gorm.io/gorm"
 )
 
@@ -37,7 +41,31 @@ func Error(translator ut.Translator) fiber.ErrorHandler {
 			return ctx.Status(fiber.StatusConflict).JSON(message{Message: "Data already exists!"})
 		}
 
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, secret.ErrModified) {
+			return ctx.Status(fiber.StatusConflict).JSON(message{Message: err.Error()})
+		}
+
+		if errors.Is(err, secret.ErrTransactionsRequired) {
+			return ctx.Status(fiber.StatusNotImplemented).JSON(message{Message: err.Error()})
+		}
+
+		if errors.Is(err, secret.ErrInvalidKey) || errors.Is(err, secret.ErrSameEnvironment) {
+			return ctx.Status(fiber.StatusUnprocessableEntity).JSON(message{Message: err.Error()})
+		}
+
+		if errors.Is(err, transit.ErrInvalidName) || errors.Is(err, transit.ErrInvalidCiphertext) {
+			return ctx.Status(fiber.StatusUnprocessableEntity).JSON(message{Message: err.Error()})
+		}
+
+		if errors.Is(err, transit.ErrKeyNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(message{Message: err.Error()})
+		}
+
+		if errors.Is(err, seal.ErrSealed) {
+			return ctx.Status(fiber.StatusServiceUnavailable).JSON(message{Message: err.Error()})
+		}
+
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, mongo.ErrNoDocuments) {
 			return ctx.Status(fiber.StatusNotFound).JSON(message{Message: "Data not found!"})
 		}
 
@@ -1,6 +1,15 @@
 package handlers
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/BrosSquad/vaulguard/middleware"
 	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services/secret"
@@ -8,6 +17,11 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// exportBatchSize - Number of secrets read from the storage at once while exporting
+const exportBatchSize = 100
+
+var errExportFailed = errors.New("an error has occurred, exported secrets are incomplete")
+
 type secretHandlers struct {
 	validator *validator.Validate
 	service   secret.Service
@@ -18,18 +32,136 @@ func RegisterSecretHandlers(validate *validator.Validate, service secret.Service
 		validator: validate,
 		service:   service,
 	}
-	r.Get("/", secretHandlers.getSecrets).Use(middleware.ParsePageAndPerPage)
+	r.Get("/", middleware.ParsePageAndPerPage, secretHandlers.getSecrets)
 	r.Get("/many", secretHandlers.getManySecrets)
 	r.Post("/", secretHandlers.createSecret)
+	r.Post("/promote", secretHandlers.promoteSecrets)
+	r.Post("/import", secretHandlers.importSecrets)
+	r.Get("/export", secretHandlers.exportSecrets)
 	r.Delete("/invalidate", secretHandlers.invalidateCache)
+	r.Get("/:key/versions", secretHandlers.getSecretVersions)
+	r.Get("/:key/versions/:version", secretHandlers.getSecretVersion)
+	r.Post("/:key/versions/:version/rollback", secretHandlers.rollbackSecret)
+}
+
+// secretContext - Carries the authenticated token ID down to the service
+// so every created secret version records its author
+func secretContext(c *fiber.Ctx) context.Context {
+	if token, ok := c.Locals("token").(models.TokenDto); ok {
+		return secret.WithTokenID(c.Context(), token.ID)
+	}
+
+	return c.Context()
+}
+
+// requestEnvironment - Environment from ?env= query, invalid names and token
+// scoped to other environments are rejected
+func requestEnvironment(c *fiber.Ctx) (string, error) {
+	environment := c.Query("env", secret.DefaultEnvironment)
+
+	if err := allowEnvironment(c, environment); err != nil {
+		return "", err
+	}
+
+	return environment, nil
+}
+
+func allowEnvironment(c *fiber.Ctx, environment string) error {
+	if err := models.ValidateEnvironment(environment); err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	if token, ok := c.Locals("token").(models.TokenDto); ok && !token.AllowsEnvironment(environment) {
+		return fiber.NewError(fiber.StatusForbidden, "token has no access to environment "+environment)
+	}
+
+	return nil
+}
+
+// allowKeys - Token scopes must grant the action on every key,
+// tokens without scopes have full access
+func allowKeys(c *fiber.Ctx, action string, keys ...string) error {
+	token, ok := c.Locals("token").(models.TokenDto)
+
+	if !ok {
+		return nil
+	}
+
+	for _, key := range keys {
+		if !token.Allows(action, key) {
+			return fiber.NewError(fiber.StatusForbidden, "token has no "+action+" access to "+key)
+		}
+	}
+
+	return nil
+}
+
+// readFilter - Listings are limited to keys the token may read in the query, so pages
+// are filled with readable secrets and a token scoped to db/* can still browse the root
+func readFilter(c *fiber.Ctx) secret.KeyFilter {
+	token, ok := c.Locals("token").(models.TokenDto)
+
+	if !ok {
+		return nil
+	}
+
+	return token.Patterns(models.ScopeRead)
+}
+
+// keyParam - Hierarchical keys are sent URL encoded (db%2Fprimary%2Fpassword)
+// so they fit into a single route segment
+func keyParam(c *fiber.Ctx) (string, error) {
+	key, err := url.PathUnescape(c.Params("key"))
+
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusBadRequest, "key parameter is not correctly encoded")
+	}
+
+	return key, nil
+}
+
+func parseVersion(c *fiber.Ctx) (uint, error) {
+	version, err := strconv.ParseUint(c.Params("version"), 10, 32)
+
+	if err != nil || version == 0 {
+		return 0, fiber.NewError(fiber.StatusUnprocessableEntity, "version parameter is not a positive number")
+	}
+
+	return uint(version), nil
 }
 
 func (s secretHandlers) getSecrets(c *fiber.Ctx) error {
 	app := c.Locals("application").(models.ApplicationDto)
 	page := c.Locals("page").(int)
 	perPage := c.Locals("perPage").(int)
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	prefix := c.Query("prefix")
 
-	secrets, err := s.service.Paginate(c.Context(), app.ID, page, perPage)
+	// Prefix switches listing to tree mode, unless all nested secrets are requested
+	if c.Context().QueryArgs().Has("prefix") && !c.Context().QueryArgs().GetBool("recursive") {
+		tree, err := s.service.Tree(c.Context(), app.ID, environment, prefix, readFilter(c), page, perPage)
+
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(struct {
+			Prefix  string            `json:"prefix"`
+			Folders []string          `json:"folders"`
+			Secrets map[string]string `json:"secrets"`
+		}{
+			Prefix:  tree.Prefix,
+			Folders: nonNilStrings(tree.Folders),
+			Secrets: tree.Secrets,
+		})
+	}
+
+	secrets, err := s.service.Paginate(c.Context(), app.ID, environment, prefix, readFilter(c), page, perPage)
 
 	if err != nil {
 		return err
@@ -40,7 +172,7 @@ func (s secretHandlers) getSecrets(c *fiber.Ctx) error {
 
 func (s secretHandlers) getManySecrets(c *fiber.Ctx) error {
 	type query struct {
-		keys []string `query:"keys"`
+		Keys []string `query:"keys"`
 	}
 	var keysStruct query
 	app := c.Locals("application").(models.ApplicationDto)
@@ -48,7 +180,17 @@ func (s secretHandlers) getManySecrets(c *fiber.Ctx) error {
 		return fiber.ErrBadRequest
 	}
 
-	secrets, err := s.service.Get(c.Context(), app.ID, keysStruct.keys)
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeRead, keysStruct.Keys...); err != nil {
+		return err
+	}
+
+	secrets, err := s.service.Get(c.Context(), app.ID, environment, keysStruct.Keys)
 	if err != nil {
 		return err
 	}
@@ -58,8 +200,9 @@ func (s secretHandlers) getManySecrets(c *fiber.Ctx) error {
 
 func (s secretHandlers) createSecret(c *fiber.Ctx) error {
 	type payload struct {
-		Key   string `json:"key" validate:"required"`
-		Value string `json:"value" validate:"required"`
+		Key       string     `json:"key" validate:"required"`
+		Value     string     `json:"value" validate:"required"`
+		ExpiresAt *time.Time `json:"expires_at" validate:"omitempty,gt"`
 	}
 
 	var p payload
@@ -72,28 +215,337 @@ func (s secretHandlers) createSecret(c *fiber.Ctx) error {
 		return err
 	}
 
-	data, err := s.service.Create(c.Context(), app.ID, p.Key, p.Value)
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeWrite, p.Key); err != nil {
+		return err
+	}
+
+	data, err := s.service.Create(secretContext(c), app.ID, environment, p.Key, p.Value, p.ExpiresAt)
 
 	if err != nil {
 		return err
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(struct {
-		ID    interface{} `json:"id"`
-		Key   string      `json:"key"`
-		Value string      `json:"value"`
+		ID        interface{} `json:"id"`
+		Key       string      `json:"key"`
+		Value     string      `json:"value"`
+		ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	}{
+		ID:        data.ID,
+		Key:       data.Key,
+		Value:     p.Value,
+		ExpiresAt: data.ExpiresAt,
+	})
+}
+
+func (s secretHandlers) promoteSecrets(c *fiber.Ctx) error {
+	type payload struct {
+		From string   `json:"from" validate:"required"`
+		To   string   `json:"to" validate:"required,nefield=From"`
+		Keys []string `json:"keys" validate:"required,min=1,dive,required"`
+	}
+
+	var p payload
+	app := c.Locals("application").(models.ApplicationDto)
+	if err := c.BodyParser(&p); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if err := s.validator.Struct(p); err != nil {
+		return err
+	}
+
+	if err := allowEnvironment(c, p.From); err != nil {
+		return err
+	}
+
+	if err := allowEnvironment(c, p.To); err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeWrite, p.Keys...); err != nil {
+		return err
+	}
+
+	if err := s.service.Promote(secretContext(c), app.ID, p.From, p.To, p.Keys); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (s secretHandlers) importSecrets(c *fiber.Ctx) error {
+	app := c.Locals("application").(models.ApplicationDto)
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	format, err := secret.ParseFormat(c.Query("format", formatFromContentType(c.Get(fiber.HeaderContentType))))
+
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	mode, err := secret.ParseImportMode(c.Query("mode"))
+
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	secrets, err := secret.Parse(format, bytes.NewReader(c.Body()))
+
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	for key := range secrets {
+		if err := allowKeys(c, models.ScopeWrite, key); err != nil {
+			return err
+		}
+	}
+
+	result, err := s.service.Import(secretContext(c), app.ID, environment, secrets, mode)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(struct {
+		Created []string `json:"created"`
+		Updated []string `json:"updated"`
+		Skipped []string `json:"skipped"`
 	}{
-		ID:    data.ID,
-		Key:   data.Key,
-		Value: p.Value,
+		Created: nonNilStrings(result.Created),
+		Updated: nonNilStrings(result.Updated),
+		Skipped: nonNilStrings(result.Skipped),
 	})
 }
 
+func (s secretHandlers) exportSecrets(c *fiber.Ctx) error {
+	app := c.Locals("application").(models.ApplicationDto)
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	format, err := secret.ParseFormat(c.Query("format"))
+
+	if err != nil {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	ctx := c.Context()
+	ctx.SetContentType(format.ContentType())
+	token, scoped := c.Locals("token").(models.TokenDto)
+
+	// Secrets are written batch by batch while the response is sent, status is
+	// already committed so failed export ends the document with an error marker
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		writer := secret.NewWriter(format, w)
+
+		err := s.service.Export(ctx, app.ID, environment, exportBatchSize, func(secrets []secret.Secret) error {
+			if scoped {
+				secrets = readableSecrets(token, secrets)
+			}
+
+			if err := writer.Write(secrets); err != nil {
+				return err
+			}
+
+			return w.Flush()
+		})
+
+		if err != nil {
+			// Storage errors are not exposed, same as in the error handler
+			if !errors.Is(err, secret.ErrShellNameConflict) {
+				err = errExportFailed
+			}
+
+			_ = writer.Abort(err)
+			return
+		}
+
+		_ = writer.Close()
+	})
+
+	return nil
+}
+
+// readableSecrets - Exported batch without the secrets token is not allowed to read
+func readableSecrets(token models.TokenDto, secrets []secret.Secret) []secret.Secret {
+	allowed := make([]secret.Secret, 0, len(secrets))
+
+	for _, s := range secrets {
+		if token.Allows(models.ScopeRead, s.Key) {
+			allowed = append(allowed, s)
+		}
+	}
+
+	return allowed
+}
+
+func formatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+		return string(secret.FormatJSON)
+	case strings.Contains(contentType, "yaml"):
+		return string(secret.FormatYAML)
+	}
+
+	return string(secret.FormatDotEnv)
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
 func (s secretHandlers) invalidateCache(c *fiber.Ctx) error {
 	app := c.Locals("application").(models.ApplicationDto)
 
+	if err := allowKeys(c, models.ScopeAdmin, models.ScopeCache); err != nil {
+		return err
+	}
+
 	if err := s.service.InvalidateCache(c.Context(), app.ID); err != nil {
 		return fiber.ErrInternalServerError
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+func (s secretHandlers) getSecretVersions(c *fiber.Ctx) error {
+	type version struct {
+		Version   uint        `json:"version"`
+		TokenID   interface{} `json:"token_id"`
+		CreatedAt time.Time   `json:"created_at"`
+	}
+
+	app := c.Locals("application").(models.ApplicationDto)
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := keyParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeRead, key); err != nil {
+		return err
+	}
+
+	versions, err := s.service.Versions(c.Context(), app.ID, environment, key)
+
+	if err != nil {
+		return err
+	}
+
+	data := make([]version, 0, len(versions))
+
+	for _, v := range versions {
+		data = append(data, version{
+			Version:   v.Version,
+			TokenID:   v.TokenID,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+
+	return c.JSON(data)
+}
+
+func (s secretHandlers) getSecretVersion(c *fiber.Ctx) error {
+	app := c.Locals("application").(models.ApplicationDto)
+	version, err := parseVersion(c)
+
+	if err != nil {
+		return err
+	}
+
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := keyParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeRead, key); err != nil {
+		return err
+	}
+
+	data, err := s.service.GetVersion(c.Context(), app.ID, environment, key, version)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(struct {
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Version uint   `json:"version"`
+	}{
+		Key:     data.Key,
+		Value:   data.Value,
+		Version: version,
+	})
+}
+
+func (s secretHandlers) rollbackSecret(c *fiber.Ctx) error {
+	app := c.Locals("application").(models.ApplicationDto)
+	version, err := parseVersion(c)
+
+	if err != nil {
+		return err
+	}
+
+	environment, err := requestEnvironment(c)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := keyParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeWrite, key); err != nil {
+		return err
+	}
+
+	data, err := s.service.Rollback(secretContext(c), app.ID, environment, key, version)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(struct {
+		ID      interface{} `json:"id"`
+		Key     string      `json:"key"`
+		Version uint        `json:"version"`
+	}{
+		ID:      data.ID,
+		Key:     data.Key,
+		Version: data.Version,
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -34,52 +35,118 @@ type mockSecretService struct {
 	Id      uint
 	Mutex   *sync.RWMutex
 	IdMutex *sync.Mutex
-	Data    []models.Secret
+	Data    []models.SecretDto
 }
 
-func (m *mockSecretService) Paginate(ctx context.Context, applicationID interface{}, page, perPage int) (map[string]string, error) {
-	panic("implement me")
+func (m *mockSecretService) Paginate(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter secret.KeyFilter, page, perPage int) (map[string]string, error) {
+	args := m.Called(applicationID, environment, prefix, keyFilter, page, perPage)
+
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+
+	return args.Get(0).(map[string]string), nil
+}
+
+func (m *mockSecretService) Tree(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter secret.KeyFilter, page, perPage int) (secret.Tree, error) {
+	args := m.Called(applicationID, environment, prefix, keyFilter, page, perPage)
+
+	return args.Get(0).(secret.Tree), args.Error(1)
 }
 
-func (m *mockSecretService) Get(ctx context.Context, applicationID interface{}, key []string) (map[string]string, error) {
+func (m *mockSecretService) Get(ctx context.Context, applicationID interface{}, environment string, key []string) (map[string]string, error) {
 	panic("implement me")
 }
 
-func (m *mockSecretService) GetOne(ctx context.Context, applicationID interface{}, key string) (secret.Secret, error) {
+func (m *mockSecretService) GetOne(ctx context.Context, applicationID interface{}, environment, key string) (secret.Secret, error) {
 	panic("implement me")
 }
 
-func (m *mockSecretService) Create(ctx context.Context, applicationID interface{}, key, value string) (models.Secret, error) {
+func (m *mockSecretService) Create(ctx context.Context, applicationID interface{}, environment, key, value string, expiresAt *time.Time) (models.SecretDto, error) {
 	args := m.Called(applicationID, key, value)
 
 	if err := args.Error(0); err != nil {
-		return models.Secret{}, err
+		return models.SecretDto{}, err
 	}
 	m.Mutex.Lock()
 	m.IdMutex.Lock()
 	defer m.IdMutex.Unlock()
 	defer m.Mutex.Unlock()
 	m.Id++
-	s := models.Secret{ID: m.Id, Key: key, Value: []byte(value), ApplicationId: applicationID.(uint)}
+	s := models.SecretDto{ID: m.Id, Key: key, Value: []byte(value), ApplicationId: applicationID.(uint), ExpiresAt: expiresAt}
 	m.Data = append(m.Data, s)
 
 	return s, nil
 }
 
-func (m *mockSecretService) Update(ctx context.Context, applicationID interface{}, key, newKey, value string) (models.Secret, error) {
+func (m *mockSecretService) Update(ctx context.Context, applicationID interface{}, environment, key, newKey, value string) (models.SecretDto, error) {
 	panic("implement me")
 }
 
-func (m *mockSecretService) Delete(ctx context.Context, applicationID interface{}, key string) error {
+func (m *mockSecretService) Delete(ctx context.Context, applicationID interface{}, environment, key string) error {
 	panic("implement me")
 }
 
-func (m *mockSecretService) InvalidateCache(applicationID interface{}) error {
+func (m *mockSecretService) Promote(ctx context.Context, applicationID interface{}, from, to string, keys []string) error {
+	args := m.Called(applicationID, from, to, keys)
+
+	return args.Error(0)
+}
+
+func (m *mockSecretService) Import(ctx context.Context, applicationID interface{}, environment string, secrets map[string]string, mode secret.ImportMode) (secret.ImportResult, error) {
+	args := m.Called(applicationID, environment, secrets, mode)
+
+	return args.Get(0).(secret.ImportResult), args.Error(1)
+}
+
+func (m *mockSecretService) Export(ctx context.Context, applicationID interface{}, environment string, batchSize int, cb func([]secret.Secret) error) error {
+	args := m.Called(applicationID, environment)
+
+	for _, batch := range args.Get(0).([][]secret.Secret) {
+		if err := cb(batch); err != nil {
+			return err
+		}
+	}
+
+	return args.Error(1)
+}
+
+func (m *mockSecretService) InvalidateCache(ctx context.Context, applicationID interface{}) error {
 	args := m.Called(applicationID)
 
 	return args.Error(0)
 }
 
+func (m *mockSecretService) Versions(ctx context.Context, applicationID interface{}, environment, key string) ([]secret.Version, error) {
+	args := m.Called(applicationID, environment, key)
+
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+
+	return args.Get(0).([]secret.Version), nil
+}
+
+func (m *mockSecretService) GetVersion(ctx context.Context, applicationID interface{}, environment, key string, version uint) (secret.Secret, error) {
+	args := m.Called(applicationID, environment, key, version)
+
+	return args.Get(0).(secret.Secret), args.Error(1)
+}
+
+func (m *mockSecretService) DeleteExpired(ctx context.Context) (int64, error) {
+	panic("implement me")
+}
+
+func (m *mockSecretService) ReEncrypt(ctx context.Context, batchSize int) (int64, error) {
+	panic("implement me")
+}
+
+func (m *mockSecretService) Rollback(ctx context.Context, applicationID interface{}, environment, key string, version uint) (models.SecretDto, error) {
+	args := m.Called(applicationID, environment, key, version)
+
+	return args.Get(0).(models.SecretDto), args.Error(1)
+}
+
 func setupSecretApp(service secret.Service, setupMiddleware bool) (*fiber.App, *validator.Validate) {
 	v := validator.New()
 	english := en.New()
@@ -105,10 +172,11 @@ func setupSecretApp(service secret.Service, setupMiddleware bool) (*fiber.App, *
 
 func createMockService() *mockSecretService {
 	return &mockSecretService{
+		Mock:    &mock.Mock{},
 		Id:      0,
 		Mutex:   &sync.RWMutex{},
 		IdMutex: &sync.Mutex{},
-		Data:    make([]models.Secret, 0),
+		Data:    make([]models.SecretDto, 0),
 	}
 }
 
@@ -196,6 +264,52 @@ func TestCreateSecret(t *testing.T) {
 		asserts.EqualValues(0, service.Id)
 	})
 
+	t.Run("ExpiresAtInThePast", func(t *testing.T) {
+		service := createMockService()
+		app, _ := setupSecretApp(service, true)
+		expiresAt := time.Now().Add(-time.Hour)
+
+		data, err := json.Marshal(struct {
+			Key       string     `json:"key"`
+			Value     string     `json:"value"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}{Key: "Test", Value: "Test", ExpiresAt: &expiresAt})
+		asserts.Nil(err)
+		buff := bytes.NewBuffer(data)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets", buff)
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		res, err := app.Test(req, 400)
+		asserts.Nil(err)
+		asserts.EqualValues(http.StatusUnprocessableEntity, res.StatusCode)
+		asserts.Len(service.Data, 0)
+	})
+
+	t.Run("InsertWithExpiry", func(t *testing.T) {
+		service := createMockService()
+		service.On("Create", uint(1), "Test", "Test").Return(nil)
+		app, _ := setupSecretApp(service, true)
+		expiresAt := time.Now().Add(time.Hour)
+
+		data, err := json.Marshal(struct {
+			Key       string     `json:"key"`
+			Value     string     `json:"value"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}{Key: "Test", Value: "Test", ExpiresAt: &expiresAt})
+		asserts.Nil(err)
+		buff := bytes.NewBuffer(data)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets", buff)
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		res, err := app.Test(req, 400)
+		asserts.Nil(err)
+		asserts.EqualValues(http.StatusCreated, res.StatusCode)
+		asserts.Len(service.Data, 1)
+		asserts.True(expiresAt.Equal(*service.Data[0].ExpiresAt))
+	})
+
 	t.Run("GormIntegrationTest", func(t *testing.T) {
 		ctx := context.Background()
 		asserts := require.New(t)
@@ -210,7 +324,7 @@ func TestCreateSecret(t *testing.T) {
 		defer os.Remove(path)
 		db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
 		asserts.Nil(err)
-		asserts.Nil(db.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}))
+		asserts.Nil(db.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}))
 		service := secret.NewGormSecretStorage(secret.GormSecretConfig{
 			Encryption: encryption,
 			CacheSize:  10,
@@ -273,3 +387,489 @@ func TestInvalidateCache(t *testing.T) {
 	})
 
 }
+
+func TestSecretVersions(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	t.Run("ListVersions", func(t *testing.T) {
+		service := createMockService()
+		service.On("Versions", uint(1), secret.DefaultEnvironment, "Test").Return([]secret.Version{
+			{Version: 2, TokenID: uint(1), CreatedAt: time.Now()},
+			{Version: 1, TokenID: uint(1), CreatedAt: time.Now()},
+		}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		var payload []struct {
+			Version uint `json:"version"`
+		}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.Len(payload, 2)
+		asserts.EqualValues(2, payload[0].Version)
+	})
+
+	t.Run("VersionsOfMissingSecret", func(t *testing.T) {
+		service := createMockService()
+		service.On("Versions", uint(1), secret.DefaultEnvironment, "Test").Return(nil, gorm.ErrRecordNotFound)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("GetVersion", func(t *testing.T) {
+		service := createMockService()
+		service.On("GetVersion", uint(1), secret.DefaultEnvironment, "Test", uint(1)).Return(secret.Secret{Key: "Test", Value: "Old"}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions/1", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		payload := struct {
+			Key     string `json:"key"`
+			Value   string `json:"value"`
+			Version uint   `json:"version"`
+		}{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.Equal("Old", payload.Value)
+		asserts.EqualValues(1, payload.Version)
+	})
+
+	t.Run("InvalidVersion", func(t *testing.T) {
+		service := createMockService()
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions/latest", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		service := createMockService()
+		service.On("Rollback", uint(1), "production", "Test", uint(1)).Return(models.SecretDto{ID: uint(1), Key: "Test", Version: 3}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodPost, "/secrets/Test/versions/1/rollback?env=production", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		payload := struct {
+			Key     string `json:"key"`
+			Version uint   `json:"version"`
+		}{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.EqualValues(3, payload.Version)
+	})
+}
+
+func TestSecretEnvironments(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	setup := func(service secret.Service, environments ...string) *fiber.App {
+		app, v := setupSecretApp(service, false)
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("application", models.ApplicationDto{ID: uint(1), Name: "Test Application"})
+			c.Locals("token", models.TokenDto{ID: uint(1), ApplicationId: uint(1), Environments: environments})
+			return c.Next()
+		})
+		RegisterSecretHandlers(v, service, app.Group("/secrets"))
+		return app
+	}
+
+	t.Run("TokenWithoutAccessToEnvironment", func(t *testing.T) {
+		service := createMockService()
+		app := setup(service, "dev")
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions?env=prod", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("InvalidEnvironment", func(t *testing.T) {
+		service := createMockService()
+		app := setup(service)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions?env=prod%2Fdb", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+
+	t.Run("TokenWithAccessToEnvironment", func(t *testing.T) {
+		service := createMockService()
+		service.On("Versions", uint(1), "dev", "Test").Return([]secret.Version{}, nil)
+		app := setup(service, "dev")
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/Test/versions?env=dev", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+	})
+
+	t.Run("Promote", func(t *testing.T) {
+		service := createMockService()
+		service.On("Promote", uint(1), "staging", "production", []string{"A", "B"}).Return(nil)
+		app := setup(service)
+
+		data, err := json.Marshal(fiber.Map{"from": "staging", "to": "production", "keys": []string{"A", "B"}})
+		asserts.Nil(err)
+		req := httptest.NewRequest(http.MethodPost, "/secrets/promote", bytes.NewBuffer(data))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusNoContent, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+
+	t.Run("PromoteToForbiddenEnvironment", func(t *testing.T) {
+		service := createMockService()
+		app := setup(service, "staging")
+
+		data, err := json.Marshal(fiber.Map{"from": "staging", "to": "production", "keys": []string{"A"}})
+		asserts.Nil(err)
+		req := httptest.NewRequest(http.MethodPost, "/secrets/promote", bytes.NewBuffer(data))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("PromoteToSameEnvironment", func(t *testing.T) {
+		service := createMockService()
+		app := setup(service)
+
+		data, err := json.Marshal(fiber.Map{"from": "staging", "to": "staging", "keys": []string{"A"}})
+		asserts.Nil(err)
+		req := httptest.NewRequest(http.MethodPost, "/secrets/promote", bytes.NewBuffer(data))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+}
+
+func TestGetSecrets(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	t.Run("FlatListing", func(t *testing.T) {
+		service := createMockService()
+		service.On("Paginate", uint(1), secret.DefaultEnvironment, "", secret.KeyFilter(nil), 1, 10).Return(map[string]string{"A": "B"}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		payload := map[string]string{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.Equal("B", payload["A"])
+	})
+
+	t.Run("TreeListing", func(t *testing.T) {
+		service := createMockService()
+		service.On("Tree", uint(1), secret.DefaultEnvironment, "db/", secret.KeyFilter(nil), 1, 10).Return(secret.Tree{
+			Prefix:  "db/",
+			Folders: []string{"db/primary/"},
+			Secrets: map[string]string{"db/url": "postgres://localhost"},
+		}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets?prefix=db/", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		payload := struct {
+			Prefix  string            `json:"prefix"`
+			Folders []string          `json:"folders"`
+			Secrets map[string]string `json:"secrets"`
+		}{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.Equal([]string{"db/primary/"}, payload.Folders)
+		asserts.Equal("postgres://localhost", payload.Secrets["db/url"])
+	})
+
+	t.Run("RecursiveListing", func(t *testing.T) {
+		service := createMockService()
+		service.On("Paginate", uint(1), secret.DefaultEnvironment, "db/", secret.KeyFilter(nil), 1, 10).Return(map[string]string{"db/primary/password": "B"}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets?prefix=db/&recursive=true", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+
+	t.Run("EncodedHierarchicalKey", func(t *testing.T) {
+		service := createMockService()
+		service.On("Versions", uint(1), secret.DefaultEnvironment, "db/primary/password").Return([]secret.Version{}, nil)
+		app, _ := setupSecretApp(service, true)
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/db%2Fprimary%2Fpassword/versions", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+}
+
+func TestImportSecrets(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	t.Run("ImportDotEnv", func(t *testing.T) {
+		service := createMockService()
+		service.On("Import", uint(1), secret.DefaultEnvironment, map[string]string{"A": "1", "B": "2"}, secret.ImportSkip).
+			Return(secret.ImportResult{Created: []string{"A"}, Skipped: []string{"B"}}, nil)
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/import?mode=skip", bytes.NewBufferString("A=1\nB=2\n"))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMETextPlain)
+
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		payload := struct {
+			Created []string `json:"created"`
+			Updated []string `json:"updated"`
+			Skipped []string `json:"skipped"`
+		}{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.Equal([]string{"A"}, payload.Created)
+		asserts.Equal([]string{}, payload.Updated)
+		asserts.Equal([]string{"B"}, payload.Skipped)
+	})
+
+	t.Run("ImportJSONConflict", func(t *testing.T) {
+		service := createMockService()
+		service.On("Import", uint(1), secret.DefaultEnvironment, map[string]string{"A": "1"}, secret.ImportFail).
+			Return(secret.ImportResult{}, services.ErrAlreadyExists)
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/import", bytes.NewBufferString(`{"A": "1"}`))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusConflict, res.StatusCode)
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		service := createMockService()
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/import?mode=merge", bytes.NewBufferString("A=1"))
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+
+	t.Run("InvalidFile", func(t *testing.T) {
+		service := createMockService()
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/import?format=yaml", bytes.NewBufferString("db:\n  password: secret\n"))
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestExportSecrets(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	t.Run("ExportShell", func(t *testing.T) {
+		service := createMockService()
+		service.On("Export", uint(1), secret.DefaultEnvironment).Return([][]secret.Secret{
+			{{Key: "A", Value: "1"}},
+			{{Key: "db/password", Value: "secret"}},
+		}, nil)
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodGet, "/secrets/export?format=shell", nil)
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		body, err := ioutil.ReadAll(res.Body)
+		asserts.Nil(err)
+		asserts.Equal("export A='1'\nexport db_password='secret'\n", string(body))
+	})
+
+	t.Run("ExportJSON", func(t *testing.T) {
+		service := createMockService()
+		service.On("Export", uint(1), secret.DefaultEnvironment).Return([][]secret.Secret{
+			{{Key: "A", Value: "1"}, {Key: "B", Value: "2"}},
+		}, nil)
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodGet, "/secrets/export?format=json", nil)
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		asserts.Contains(res.Header.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON)
+		payload := make(map[string]string)
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+		asserts.Equal(map[string]string{"A": "1", "B": "2"}, payload)
+	})
+
+	t.Run("ExportErrorIsNotReadAsCompleteDocument", func(t *testing.T) {
+		for _, format := range []secret.Format{secret.FormatJSON, secret.FormatYAML, secret.FormatDotEnv} {
+			service := createMockService()
+			service.On("Export", uint(1), secret.DefaultEnvironment).Return([][]secret.Secret{
+				{{Key: "A", Value: "1"}},
+			}, errors.New("connection lost"))
+			app, _ := setupSecretApp(service, true)
+
+			req := httptest.NewRequest(http.MethodGet, "/secrets/export?format="+string(format), nil)
+			res, err := app.Test(req)
+			asserts.Nil(err)
+			asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+
+			body, err := ioutil.ReadAll(res.Body)
+			asserts.Nil(err)
+			asserts.Contains(string(body), "export failed")
+			asserts.NotContains(string(body), "connection lost")
+
+			_, err = secret.Parse(format, bytes.NewReader(body))
+			asserts.NotNil(err, format)
+		}
+	})
+
+	t.Run("ExportShellNameConflict", func(t *testing.T) {
+		service := createMockService()
+		service.On("Export", uint(1), secret.DefaultEnvironment).Return([][]secret.Secret{
+			{{Key: "db/pass", Value: "1"}, {Key: "db_pass", Value: "2"}},
+		}, nil)
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodGet, "/secrets/export?format=shell", nil)
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+
+		body, err := ioutil.ReadAll(res.Body)
+		asserts.Nil(err)
+		asserts.Contains(string(body), secret.ErrShellNameConflict.Error())
+		asserts.Contains(string(body), "exit 1")
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		service := createMockService()
+		app, _ := setupSecretApp(service, true)
+
+		req := httptest.NewRequest(http.MethodGet, "/secrets/export?format=xml", nil)
+		res, err := app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+}
+
+func TestSecretScopes(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	setup := func(service secret.Service, scopes ...string) *fiber.App {
+		app, v := setupSecretApp(service, false)
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("application", models.ApplicationDto{ID: uint(1), Name: "Test Application"})
+			c.Locals("token", models.TokenDto{ID: uint(1), ApplicationId: uint(1), Scopes: scopes})
+			return c.Next()
+		})
+		RegisterSecretHandlers(v, service, app.Group("/secrets"))
+		return app
+	}
+
+	jsonRequest := func(method, target string, body interface{}) *http.Request {
+		data, err := json.Marshal(body)
+		asserts.Nil(err)
+		req := httptest.NewRequest(method, target, bytes.NewBuffer(data))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return req
+	}
+
+	t.Run("ReadOnlyTokenCannotWrite", func(t *testing.T) {
+		service := createMockService()
+		service.On("Versions", uint(1), secret.DefaultEnvironment, "deploy/key").Return([]secret.Version{}, nil)
+		app := setup(service, "read:deploy/*")
+
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets/deploy%2Fkey/versions", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+
+		res, err = app.Test(jsonRequest(http.MethodPost, "/secrets", fiber.Map{"key": "deploy/key", "value": "overwritten"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+
+		res, err = app.Test(httptest.NewRequest(http.MethodPost, "/secrets/deploy%2Fkey/versions/1/rollback", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+
+		res, err = app.Test(jsonRequest(http.MethodPost, "/secrets/promote", fiber.Map{"from": "staging", "to": "production", "keys": []string{"deploy/key"}}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+
+	t.Run("WriteScopeLimitedToPrefix", func(t *testing.T) {
+		service := createMockService()
+		service.On("Create", uint(1), "feature-flags/new-ui", "on").Return(nil)
+		app := setup(service, "write:feature-flags/*")
+
+		res, err := app.Test(jsonRequest(http.MethodPost, "/secrets", fiber.Map{"key": "feature-flags/new-ui", "value": "on"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusCreated, res.StatusCode)
+
+		res, err = app.Test(jsonRequest(http.MethodPost, "/secrets", fiber.Map{"key": "db/password", "value": "on"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+
+		req := httptest.NewRequest(http.MethodPost, "/secrets/import", bytes.NewBufferString("feature-flags/a=1\ndb/password=2\n"))
+		res, err = app.Test(req)
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+
+	t.Run("ListingAndExportAreFiltered", func(t *testing.T) {
+		service := createMockService()
+		// Storage filters by the read patterns, so pages are not cut short
+		service.On("Paginate", uint(1), secret.DefaultEnvironment, "", secret.KeyFilter{"deploy/*"}, 1, 10).
+			Return(map[string]string{"deploy/key": "1"}, nil)
+		service.On("Tree", uint(1), secret.DefaultEnvironment, "", secret.KeyFilter{"deploy/*"}, 1, 10).Return(secret.Tree{
+			Folders: []string{"deploy/"},
+			Secrets: map[string]string{},
+		}, nil)
+		service.On("Export", uint(1), secret.DefaultEnvironment).Return([][]secret.Secret{
+			{{Key: "db/password", Value: "2"}, {Key: "deploy/key", Value: "1"}},
+		}, nil)
+		app := setup(service, "read:deploy/*")
+
+		res, err := app.Test(httptest.NewRequest(http.MethodGet, "/secrets", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		flat := map[string]string{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&flat))
+		asserts.Equal(map[string]string{"deploy/key": "1"}, flat)
+
+		res, err = app.Test(httptest.NewRequest(http.MethodGet, "/secrets?prefix=", nil))
+		asserts.Nil(err)
+		tree := struct {
+			Folders []string          `json:"folders"`
+			Secrets map[string]string `json:"secrets"`
+		}{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&tree))
+		asserts.Equal([]string{"deploy/"}, tree.Folders)
+		asserts.Empty(tree.Secrets)
+
+		res, err = app.Test(httptest.NewRequest(http.MethodGet, "/secrets/export?format=dotenv", nil))
+		asserts.Nil(err)
+		body, err := ioutil.ReadAll(res.Body)
+		asserts.Nil(err)
+		asserts.Equal("deploy/key=\"1\"\n", string(body))
+	})
+
+	t.Run("CacheInvalidationRequiresAdminScope", func(t *testing.T) {
+		service := createMockService()
+		service.On("InvalidateCache", uint(1)).Return(nil)
+
+		res, err := setup(service, "read:*", "write:*").Test(httptest.NewRequest(http.MethodDelete, "/secrets/invalidate", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+
+		res, err = setup(service, "admin:cache").Test(httptest.NewRequest(http.MethodDelete, "/secrets/invalidate", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusNoContent, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/BrosSquad/vaulguard/services/seal"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/gofiber/fiber/v2"
+)
+
+type sysHandlers struct {
+	tokenCache  *token.Cache
+	secretCache *secret.Cache
+	sealer      *seal.Sealer
+}
+
+// RegisterSysHandlers - Seal routes are registered only when sealer is not nil (shamir key provider)
+func RegisterSysHandlers(tokenCache *token.Cache, secretCache *secret.Cache, sealer *seal.Sealer, r fiber.Router) {
+	sysHandlers := sysHandlers{
+		tokenCache:  tokenCache,
+		secretCache: secretCache,
+		sealer:      sealer,
+	}
+
+	r.Get("/cache", sysHandlers.cacheStats)
+
+	if sealer != nil {
+		r.Get("/seal-status", sysHandlers.sealStatus)
+		r.Post("/unseal", sysHandlers.unseal)
+	}
+}
+
+// cacheStats - Hit/miss counters and usage of the in-process caches
+func (s sysHandlers) cacheStats(c *fiber.Ctx) error {
+	return c.JSON(struct {
+		Tokens  token.CacheStats  `json:"tokens"`
+		Secrets secret.CacheStats `json:"secrets"`
+	}{
+		Tokens:  s.tokenCache.Stats(),
+		Secrets: s.secretCache.Stats(),
+	})
+}
+
+func (s sysHandlers) sealStatus(c *fiber.Ctx) error {
+	return c.JSON(s.sealer.Status())
+}
+
+// unseal - Submits one base64 encoded unseal key share, responds with progress of unsealing
+func (s sysHandlers) unseal(c *fiber.Ctx) error {
+	var p struct {
+		Share string `json:"share"`
+	}
+
+	if err := c.BodyParser(&p); err != nil {
+		return err
+	}
+
+	share, err := base64.StdEncoding.DecodeString(p.Share)
+
+	if err != nil || len(share) == 0 {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "share must be base64 encoded unseal key share")
+	}
+
+	status, err := s.sealer.Unseal(c.Context(), share)
+
+	if errors.Is(err, seal.ErrInvalidShares) {
+		return c.Status(fiber.StatusBadRequest).JSON(struct {
+			seal.Status
+			Message string `json:"message"`
+		}{Status: status, Message: err.Error()})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(status)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/seal"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheStats(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	tokenCache := token.NewCache(10, time.Minute)
+	secretCache := secret.NewCache(secret.CacheConfig{})
+	tokenCache.Set(uint(1), models.TokenDto{ID: uint(1)})
+	_, _ = tokenCache.Get(uint(1))
+	_, _ = secretCache.Get(uint(1), secret.DefaultEnvironment, "A")
+
+	app := fiber.New()
+	RegisterSysHandlers(tokenCache, secretCache, nil, app.Group("/sys"))
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/sys/cache", nil))
+	asserts.Nil(err)
+	asserts.Equal(fiber.StatusOK, res.StatusCode)
+
+	payload := struct {
+		Tokens  token.CacheStats  `json:"tokens"`
+		Secrets secret.CacheStats `json:"secrets"`
+	}{}
+	asserts.Nil(json.NewDecoder(res.Body).Decode(&payload))
+	asserts.Equal(uint64(1), payload.Tokens.Hits)
+	asserts.Equal(1, payload.Tokens.Size)
+	asserts.Equal(uint64(1), payload.Secrets.Misses)
+}
+
+func TestUnseal(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	path, err := ioutil.TempDir("", "vaulguard_unseal")
+	asserts.Nil(err)
+	defer os.RemoveAll(path)
+
+	secretKeyPath := filepath.Join(path, "secret.key")
+	shares, err := seal.Init(context.Background(), secretKeyPath, 3, 2)
+	asserts.Nil(err)
+	sealer, err := seal.New(secretKeyPath, services.DefaultAlgorithm)
+	asserts.Nil(err)
+
+	app := fiber.New()
+	RegisterSysHandlers(token.NewCache(10, time.Minute), secret.NewCache(secret.CacheConfig{}), sealer, app.Group("/sys"))
+
+	unseal := func(share string) (int, seal.Status) {
+		req := httptest.NewRequest(http.MethodPost, "/sys/unseal", strings.NewReader(`{"share":"`+share+`"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		res, err := app.Test(req)
+		asserts.Nil(err)
+
+		var status seal.Status
+		if res.StatusCode == fiber.StatusOK {
+			asserts.Nil(json.NewDecoder(res.Body).Decode(&status))
+		}
+		return res.StatusCode, status
+	}
+
+	code, _ := unseal("not base64!")
+	asserts.Equal(fiber.StatusUnprocessableEntity, code)
+
+	code, status := unseal(base64.StdEncoding.EncodeToString(shares[0]))
+	asserts.Equal(fiber.StatusOK, code)
+	asserts.Equal(seal.Status{Sealed: true, Threshold: 2, Progress: 1}, status)
+
+	code, status = unseal(base64.StdEncoding.EncodeToString(shares[2]))
+	asserts.Equal(fiber.StatusOK, code)
+	asserts.False(status.Sealed)
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/sys/seal-status", nil))
+	asserts.Nil(err)
+	asserts.Nil(json.NewDecoder(res.Body).Decode(&status))
+	asserts.False(status.Sealed)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/gofiber/fiber/v2"
+)
+
+type tokenHandlers struct {
+	service            token.Service
+	applicationService application.Service
+}
+
+// tokenResponse - Token as seen by the administrator, hashed value never leaves the server
+type tokenResponse struct {
+	ID           interface{} `json:"id"`
+	Application  string      `json:"application"`
+	Environments []string    `json:"environments"`
+	Scopes       []string    `json:"scopes"`
+	Active       bool        `json:"active"`
+	ExpiresAt    *time.Time  `json:"expires_at,omitempty"`
+	RevokedAt    *time.Time  `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+func RegisterTokenHandlers(service token.Service, applicationService application.Service, r fiber.Router) {
+	tokenHandlers := tokenHandlers{
+		service:            service,
+		applicationService: applicationService,
+	}
+
+	r.Get("/", tokenHandlers.listTokens)
+	r.Post("/:id/revoke", tokenHandlers.revokeToken)
+	r.Delete("/:id", tokenHandlers.deleteToken)
+}
+
+func tokenIDParam(c *fiber.Ctx) (interface{}, error) {
+	id, err := token.ParseID(c.Params("id"))
+
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusUnprocessableEntity, err.Error())
+	}
+
+	return id, nil
+}
+
+func (t tokenHandlers) listTokens(c *fiber.Ctx) error {
+	name := c.Query("application")
+
+	if name == "" {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "application query parameter is required")
+	}
+
+	app, err := t.applicationService.GetByName(c.Context(), name)
+
+	if err != nil {
+		return err
+	}
+
+	tokens, err := t.service.List(c.Context(), app.ID)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	response := make([]tokenResponse, 0, len(tokens))
+
+	for _, tokenDto := range tokens {
+		response = append(response, tokenResponse{
+			ID:           tokenDto.ID,
+			Application:  app.Name,
+			Environments: nonNilStrings(tokenDto.Environments),
+			Scopes:       nonNilStrings(tokenDto.Scopes),
+			Active:       tokenDto.Active(now),
+			ExpiresAt:    tokenDto.ExpiresAt,
+			RevokedAt:    tokenDto.RevokedAt,
+			CreatedAt:    tokenDto.CreatedAt,
+		})
+	}
+
+	return c.JSON(response)
+}
+
+func (t tokenHandlers) revokeToken(c *fiber.Ctx) error {
+	id, err := tokenIDParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := t.service.Revoke(c.Context(), id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (t tokenHandlers) deleteToken(c *fiber.Ctx) error {
+	id, err := tokenIDParam(c)
+
+	if err != nil {
+		return err
+	}
+
+	if err := t.service.Delete(c.Context(), id); err != nil {
+		return err
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
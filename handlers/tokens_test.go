@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/application"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTokenHandlers(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	asserts := require.New(t)
+	path, err := filepath.Abs("./token_handlers.db")
+	asserts.Nil(err)
+	defer os.Remove(path)
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	asserts.Nil(err)
+	asserts.Nil(db.AutoMigrate(&models.Application{}, &models.Token{}))
+
+	applicationService := application.NewSqlService(db)
+	tokenService := token.NewService(token.NewSqlStorage(db, nil))
+	app, err := applicationService.Create(ctx, "TestApplication")
+	asserts.Nil(err)
+	tokenService.Generate(ctx, app.ID, token.GenerateOptions{Environments: []string{"production"}})
+	value := tokenService.Generate(ctx, app.ID, token.GenerateOptions{})
+	asserts.NotEmpty(value)
+	_, ok := tokenService.Verify(ctx, value)
+	asserts.True(ok)
+
+	english := en.New()
+	uni := ut.New(english, english)
+	englishTranslations, _ := uni.GetTranslator("en")
+	fiberApp := fiber.New(fiber.Config{
+		ErrorHandler: Error(englishTranslations),
+	})
+	RegisterTokenHandlers(tokenService, applicationService, fiberApp.Group("/tokens"))
+
+	t.Run("ListTokens", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/tokens?application=TestApplication", nil)
+		res, err := fiberApp.Test(req)
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusOK, res.StatusCode)
+
+		var tokens []map[string]interface{}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&tokens))
+		asserts.Len(tokens, 2)
+		asserts.Equal([]interface{}{"production"}, tokens[0]["environments"])
+		asserts.Equal(true, tokens[1]["active"])
+		asserts.NotContains(tokens[1], "value")
+	})
+
+	t.Run("ListTokensUnknownApplication", func(t *testing.T) {
+		res, err := fiberApp.Test(httptest.NewRequest(http.MethodGet, "/tokens?application=Missing", nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusNotFound, res.StatusCode)
+
+		res, err = fiberApp.Test(httptest.NewRequest(http.MethodGet, "/tokens", nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+
+	t.Run("RevokeAndDeleteToken", func(t *testing.T) {
+		tokens, err := tokenService.List(ctx, app.ID)
+		asserts.Nil(err)
+		id := strconv.FormatUint(uint64(tokens[1].ID.(uint)), 10)
+
+		res, err := fiberApp.Test(httptest.NewRequest(http.MethodPost, "/tokens/"+id+"/revoke", nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusNoContent, res.StatusCode)
+
+		_, ok := tokenService.Verify(ctx, value)
+		asserts.False(ok)
+
+		res, err = fiberApp.Test(httptest.NewRequest(http.MethodDelete, "/tokens/"+id, nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusNoContent, res.StatusCode)
+
+		res, err = fiberApp.Test(httptest.NewRequest(http.MethodDelete, "/tokens/"+id, nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusNotFound, res.StatusCode)
+
+		res, err = fiberApp.Test(httptest.NewRequest(http.MethodPost, "/tokens/invalid/revoke", nil))
+		asserts.Nil(err)
+		asserts.Equal(fiber.StatusUnprocessableEntity, res.StatusCode)
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/transit"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+)
+
+type transitHandlers struct {
+	validator *validator.Validate
+	service   transit.Service
+}
+
+func RegisterTransitHandlers(validate *validator.Validate, service transit.Service, r fiber.Router) {
+	transitHandlers := transitHandlers{
+		validator: validate,
+		service:   service,
+	}
+
+	r.Post("/encrypt", transitHandlers.encrypt)
+	r.Post("/decrypt", transitHandlers.decrypt)
+	r.Post("/keys/:name/rotate", transitHandlers.rotate)
+}
+
+// encrypt - Plaintext is base64 encoded, so binary payloads can be encrypted as well
+func (t transitHandlers) encrypt(c *fiber.Ctx) error {
+	type payload struct {
+		Key       string `json:"key" validate:"required,max=255"`
+		Plaintext []byte `json:"plaintext" validate:"required"`
+	}
+
+	var p payload
+	app := c.Locals("application").(models.ApplicationDto)
+	if err := c.BodyParser(&p); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if err := t.validator.Struct(p); err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeEncrypt, p.Key); err != nil {
+		return err
+	}
+
+	ciphertext, err := t.service.Encrypt(c.Context(), app.ID, p.Key, p.Plaintext)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(struct {
+		Ciphertext string `json:"ciphertext"`
+	}{Ciphertext: ciphertext})
+}
+
+func (t transitHandlers) decrypt(c *fiber.Ctx) error {
+	type payload struct {
+		Key        string `json:"key" validate:"required,max=255"`
+		Ciphertext string `json:"ciphertext" validate:"required"`
+	}
+
+	var p payload
+	app := c.Locals("application").(models.ApplicationDto)
+	if err := c.BodyParser(&p); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	if err := t.validator.Struct(p); err != nil {
+		return err
+	}
+
+	if err := allowKeys(c, models.ScopeDecrypt, p.Key); err != nil {
+		return err
+	}
+
+	plaintext, err := t.service.Decrypt(c.Context(), app.ID, p.Key, p.Ciphertext)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(struct {
+		Plaintext []byte `json:"plaintext"`
+	}{Plaintext: plaintext})
+}
+
+func (t transitHandlers) rotate(c *fiber.Ctx) error {
+	name := c.Params("name")
+	app := c.Locals("application").(models.ApplicationDto)
+
+	if err := allowKeys(c, models.ScopeAdmin, models.ScopeTransitPrefix+name); err != nil {
+		return err
+	}
+
+	version, err := t.service.Rotate(c.Context(), app.ID, name)
+
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(struct {
+		Key     string `json:"key"`
+		Version uint   `json:"version"`
+	}{Key: name, Version: version})
+}
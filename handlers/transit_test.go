@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/transit"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTransitService struct {
+	mock.Mock
+}
+
+func (m *mockTransitService) Encrypt(ctx context.Context, applicationID interface{}, name string, plaintext []byte) (string, error) {
+	args := m.Called(applicationID, name, plaintext)
+
+	return args.String(0), args.Error(1)
+}
+
+func (m *mockTransitService) Decrypt(ctx context.Context, applicationID interface{}, name, ciphertext string) ([]byte, error) {
+	args := m.Called(applicationID, name, ciphertext)
+
+	if err := args.Error(1); err != nil {
+		return nil, err
+	}
+
+	return args.Get(0).([]byte), nil
+}
+
+func (m *mockTransitService) Rotate(ctx context.Context, applicationID interface{}, name string) (uint, error) {
+	args := m.Called(applicationID, name)
+
+	return args.Get(0).(uint), args.Error(1)
+}
+
+func TestTransit(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	setup := func(service transit.Service, scopes ...string) *fiber.App {
+		english := en.New()
+		englishTranslations, _ := ut.New(english, english).GetTranslator("en")
+		app := fiber.New(fiber.Config{ErrorHandler: Error(englishTranslations)})
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("application", models.ApplicationDto{ID: uint(1), Name: "Test Application"})
+			c.Locals("token", models.TokenDto{ID: uint(1), ApplicationId: uint(1), Scopes: scopes})
+			return c.Next()
+		})
+		RegisterTransitHandlers(validator.New(), service, app.Group("/transit"))
+		return app
+	}
+
+	jsonRequest := func(target string, body interface{}) *http.Request {
+		data, err := json.Marshal(body)
+		asserts.Nil(err)
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewBuffer(data))
+		req.Header.Add(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return req
+	}
+
+	t.Run("EncryptAndDecrypt", func(t *testing.T) {
+		service := &mockTransitService{}
+		service.On("Encrypt", uint(1), "pii", []byte("john@example.com")).Return("vaulguard:v1:c2VhbGVk", nil)
+		service.On("Decrypt", uint(1), "pii", "vaulguard:v1:c2VhbGVk").Return([]byte("john@example.com"), nil)
+		app := setup(service)
+
+		// Plaintext is base64 encoded
+		res, err := app.Test(jsonRequest("/transit/encrypt", fiber.Map{"key": "pii", "plaintext": "am9obkBleGFtcGxlLmNvbQ=="}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+
+		var encrypted struct {
+			Ciphertext string `json:"ciphertext"`
+		}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&encrypted))
+		asserts.Equal("vaulguard:v1:c2VhbGVk", encrypted.Ciphertext)
+
+		res, err = app.Test(jsonRequest("/transit/decrypt", fiber.Map{"key": "pii", "ciphertext": encrypted.Ciphertext}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+
+		var decrypted struct {
+			Plaintext []byte `json:"plaintext"`
+		}
+		asserts.Nil(json.NewDecoder(res.Body).Decode(&decrypted))
+		asserts.Equal([]byte("john@example.com"), decrypted.Plaintext)
+		service.AssertExpectations(t)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		service := &mockTransitService{}
+		service.On("Decrypt", uint(1), "pii", "tampered").Return(nil, transit.ErrInvalidCiphertext)
+		service.On("Decrypt", uint(1), "missing", "vaulguard:v1:c2VhbGVk").Return(nil, transit.ErrKeyNotFound)
+		app := setup(service)
+
+		res, err := app.Test(jsonRequest("/transit/decrypt", fiber.Map{"key": "pii", "ciphertext": "tampered"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+
+		res, err = app.Test(jsonRequest("/transit/decrypt", fiber.Map{"key": "missing", "ciphertext": "vaulguard:v1:c2VhbGVk"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusNotFound, res.StatusCode)
+
+		res, err = app.Test(jsonRequest("/transit/encrypt", fiber.Map{"key": "pii"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusUnprocessableEntity, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+
+	t.Run("Scopes", func(t *testing.T) {
+		service := &mockTransitService{}
+		service.On("Encrypt", uint(1), "pii", []byte("value")).Return("vaulguard:v1:c2VhbGVk", nil)
+		service.On("Rotate", uint(1), "pii").Return(uint(2), nil)
+		app := setup(service, "encrypt:pii", "admin:transit/pii")
+
+		res, err := app.Test(jsonRequest("/transit/encrypt", fiber.Map{"key": "pii", "plaintext": "dmFsdWU="}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+
+		res, err = app.Test(jsonRequest("/transit/decrypt", fiber.Map{"key": "pii", "ciphertext": "vaulguard:v1:c2VhbGVk"}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+
+		res, err = app.Test(jsonRequest("/transit/encrypt", fiber.Map{"key": "other", "plaintext": "dmFsdWU="}))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusForbidden, res.StatusCode)
+
+		res, err = app.Test(httptest.NewRequest(http.MethodPost, "/transit/keys/pii/rotate", nil))
+		asserts.Nil(err)
+		asserts.EqualValues(fiber.StatusOK, res.StatusCode)
+		service.AssertExpectations(t)
+	})
+}
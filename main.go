@@ -20,57 +20,138 @@ var (
 	rootCmd *cobra.Command
 )
 
-func createTokenCommand(tc cmd.Command, command *cobra.Command) *cobra.Command {
+func createTokenCommand(ctx context.Context, command *cobra.Command) *cobra.Command {
 	create := &cobra.Command{
 		Use:  "create",
 		Long: "Create new token for application",
 		Args: cobra.MinimumNArgs(1),
-		RunE: tc.Execute,
+		RunE: func(c *cobra.Command, args []string) error {
+			return cmd.NewTokenCommand(ctx, applicationService, tokenService).Execute(c, args)
+		},
+	}
+	create.Flags().StringSlice("env", nil, "Environments token has access to, all environments if empty")
+	create.Flags().StringSlice("scope", nil, "Scopes in form action:pattern (read:db/*, write:feature-flags/*, admin:cache), full access if empty")
+	create.Flags().Duration("expires", 0, "How long the token is valid (e.g. 720h), token never expires if empty")
+
+	revoke := &cobra.Command{
+		Use:  "revoke",
+		Long: "Revoke token by its ID, revoked token is rejected on every request",
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return cmd.NewTokenRevokeCommand(ctx, tokenService).Execute(c, args)
+		},
 	}
-	command.AddCommand(create)
+
+	list := &cobra.Command{
+		Use:  "list",
+		Long: "List all tokens of application",
+		Args: cobra.ExactArgs(1),
+		RunE: func(c *cobra.Command, args []string) error {
+			return cmd.NewTokenListCommand(ctx, applicationService, tokenService).Execute(c, args)
+		},
+	}
+
+	command.AddCommand(create, revoke, list)
 
 	return command
 }
 
-func main() {
-	ctx := context.Background()
-	rootCmd = &cobra.Command{
+func createKeysCommand() *cobra.Command {
+	keys := &cobra.Command{
+		Use: "keys",
+	}
+
+	rotate := &cobra.Command{
+		Use:  "rotate",
+		Long: "Generate new secret key, secrets are re-encrypted with it by the server on next boot",
+		Args: cobra.NoArgs,
+		RunE: cmd.NewKeysRotateCommand().Execute,
+	}
+	rotate.Flags().String("config", "./config.yml", "Path to config file")
+	rotate.Flags().StringArray("share", nil, "Unseal key share, required threshold times with shamir key provider")
+
+	keys.AddCommand(rotate)
+
+	return keys
+}
+
+func createSealCommands() []*cobra.Command {
+	initialize := &cobra.Command{
+		Use:  "init",
+		Long: "Generate sealed secret key and print unseal key shares (shamir key provider)",
+		Args: cobra.NoArgs,
+		RunE: cmd.NewInitCommand().Execute,
+	}
+	initialize.Flags().String("config", "./config.yml", "Path to config file")
+
+	unseal := &cobra.Command{
+		Use:  "unseal [share]",
+		Long: "Submit unseal key share to the running server, share is read from stdin when not given",
+		Args: cobra.MaximumNArgs(1),
+		RunE: cmd.NewUnsealCommand().Execute,
+	}
+	unseal.Flags().String("config", "./config.yml", "Path to config file")
+	unseal.Flags().String("address", "", "Server URL, defaults to http.address from config")
+
+	return []*cobra.Command{initialize, unseal}
+}
+
+// withServices - Services of the group are created from --config before any of its subcommands
+// runs and closed afterwards, secret service is created only for groups which need the secret key
+func withServices(ctx context.Context, group *cobra.Command, withSecrets bool) *cobra.Command {
+	var opened *cmd.Services
+
+	group.PersistentFlags().String("config", "./config.yml", "Path to config file")
+
+	if withSecrets {
+		group.PersistentFlags().StringArray("share", nil, "Unseal key share, required threshold times with shamir key provider")
+	}
+
+	group.PersistentPreRunE = func(c *cobra.Command, args []string) error {
+		s, err := cmd.OpenServices(ctx, c, withSecrets)
+
+		if err != nil {
+			return err
+		}
+
+		opened = s
+		applicationService = s.Applications
+		tokenService = s.Tokens
+		secretService = s.Secrets
+
+		return nil
+	}
+
+	group.PersistentPostRunE = func(c *cobra.Command, args []string) error {
+		return opened.Close()
+	}
+
+	return group
+}
+
+func newRootCommand(ctx context.Context) *cobra.Command {
+	root := &cobra.Command{
 		Use:   "vaulguard",
 		Short: "VaulGuard CLI",
 		Long:  "Command line interface for VaulGuard secret storage",
 	}
 
-	rootCmd.AddCommand(createTokenCommand(
-		cmd.NewTokenCommand(ctx, applicationService, tokenService),
-		&cobra.Command{
-			Use: "token",
-		},
-	))
+	root.AddCommand(withServices(ctx, createTokenCommand(ctx, &cobra.Command{
+		Use: "token",
+	}), false))
+
+	root.AddCommand(createKeysCommand())
+	root.AddCommand(createSealCommands()...)
+	root.AddCommand(withServices(ctx, applicationCommands(ctx), false))
+	root.AddCommand(withServices(ctx, secretCommands(ctx), true))
+
+	return root
+}
+
+func main() {
+	rootCmd = newRootCommand(context.Background())
 
-	rootCmd.AddCommand(applicationCommands(ctx))
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalf("Command error: %v", err)
 	}
-	//cfg, err := config.NewConfig(true)
-	//
-	//if err != nil {
-	//	log.Fatalf("Error while creating app configuration: %v\n", err)
-	//}
-	//
-	//conn, err := db.ConnectToDatabaseProvider(cfg.Database, cfg.DatabaseDSN)
-	//
-	//if err != nil {
-	//	log.Fatalf("Error while connection to PostgreSQL: %v", err)
-	//}
-	//
-	//if err := db.Migrate(); err != nil {
-	//	log.Fatalf("Auto migration failed: %v", err)
-	//}
-	//
-	//applicationService = application.NewSqlService(conn)
-	//tokenService = token.NewSqlService(conn)
-	//
-	//if err := parseCommands(); err != nil {
-	//	log.Fatal(err)
-	//}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/db"
+	"github.com/BrosSquad/vaulguard/services/kms"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommands(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "vaulguard-cli")
+	asserts.Nil(err)
+	defer os.RemoveAll(dir)
+
+	keys := config.Keys{
+		Private: filepath.Join(dir, "private.key"),
+		Public:  filepath.Join(dir, "public.key"),
+		Secret:  filepath.Join(dir, "secret.key"),
+	}
+
+	// Server migrates the database and generates the keys on first boot
+	conn, err := db.ConnectToDatabaseProvider(db.GormConfig{SQLProvider: db.SQLite, DSN: filepath.Join(dir, "vaulguard.db")})
+	asserts.Nil(err)
+	asserts.Nil(db.SqlMigrate(conn))
+	sqlDB, err := conn.DB()
+	asserts.Nil(err)
+	asserts.Nil(sqlDB.Close())
+
+	manager, err := kms.New(keys, true)
+	asserts.Nil(err)
+	secretKeyFile, err := os.Create(keys.Secret)
+	asserts.Nil(err)
+	_, err = kms.GenerateSecretKey(ctx, manager, secretKeyFile)
+	asserts.Nil(err)
+	asserts.Nil(secretKeyFile.Close())
+
+	configPath := filepath.Join(dir, "config.yml")
+	asserts.Nil(ioutil.WriteFile(configPath, []byte(`sql: true
+locale: en
+databases:
+  sql:
+    provider: sqlite
+    dsn: `+filepath.Join(dir, "vaulguard.db")+`
+http:
+  address: 127.0.0.1:4000
+keys:
+  private: `+keys.Private+`
+  public: `+keys.Public+`
+  secret: `+keys.Secret+`
+`), 0600))
+
+	run := func(args ...string) error {
+		root := newRootCommand(ctx)
+		root.SetArgs(append(args, "--config", configPath))
+		return root.Execute()
+	}
+
+	asserts.Nil(run("app", "create", "Billing"))
+	asserts.Nil(run("token", "create", "Billing", "--env", "prod"))
+	asserts.Nil(run("token", "list", "Billing"))
+	asserts.Nil(run("token", "revoke", "1"))
+	asserts.NotNil(run("token", "create", "Billing", "--env", "prod/db"))
+
+	envPath := filepath.Join(dir, "billing.env")
+	asserts.Nil(ioutil.WriteFile(envPath, []byte("DB_PASSWORD=secret\nAPI_KEY=key\n"), 0600))
+	asserts.Nil(run("secrets", "import", envPath, "--app", "Billing", "--env", "prod"))
+
+	outputPath := filepath.Join(dir, "billing.json")
+	asserts.Nil(run("secrets", "export", "--app", "Billing", "--env", "prod", "--format", "json", "--output", outputPath))
+
+	data, err := ioutil.ReadFile(outputPath)
+	asserts.Nil(err)
+
+	var exported map[string]string
+	asserts.Nil(json.Unmarshal(data, &exported))
+	asserts.Equal(map[string]string{"DB_PASSWORD": "secret", "API_KEY": "key"}, exported)
+
+	asserts.NotNil(run("secrets", "import", envPath, "--app", "Billing", "--env", "prod/db"))
+	asserts.NotNil(run("secrets", "export", "--app", "Missing"))
+}
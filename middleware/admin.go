@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const adminHeaderPrefix = "admin "
+
+// AdminAuth - Guards management routes with the static admin token from the configuration,
+// when no token is configured every request is rejected
+func AdminAuth(adminToken string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if adminToken == "" {
+			return fiber.ErrUnauthorized
+		}
+
+		t, err := extractToken(ctx.Get(fiber.HeaderAuthorization), adminHeaderPrefix, len(adminHeaderPrefix))
+
+		if err != nil {
+			return err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(t), []byte(adminToken)) != 1 {
+			return fiber.ErrUnauthorized
+		}
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminAuth(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	newApp := func(adminToken string) *fiber.App {
+		app := fiber.New()
+		app.Use(AdminAuth(adminToken))
+		app.Get("/", func(ctx *fiber.Ctx) error {
+			return ctx.SendStatus(fiber.StatusNoContent)
+		})
+		return app
+	}
+
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		status     int
+	}{
+		{name: "ValidToken", adminToken: "secret-admin-token", header: "admin secret-admin-token", status: fiber.StatusNoContent},
+		{name: "PrefixIsCaseInsensitive", adminToken: "secret-admin-token", header: "Admin secret-admin-token", status: fiber.StatusNoContent},
+		{name: "InvalidToken", adminToken: "secret-admin-token", header: "admin other-token", status: fiber.StatusUnauthorized},
+		{name: "ApplicationToken", adminToken: "secret-admin-token", header: "token secret-admin-token", status: fiber.StatusUnauthorized},
+		{name: "NoHeader", adminToken: "secret-admin-token", status: fiber.StatusUnauthorized},
+		{name: "AdminTokenNotConfigured", header: "admin ", status: fiber.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			req.Header.Add("Authorization", test.header)
+		}
+
+		resp, err := newApp(test.adminToken).Test(req)
+		asserts.Nil(err, test.name)
+		asserts.Equal(test.status, resp.StatusCode, test.name)
+		asserts.Nil(resp.Body.Close())
+	}
+}
@@ -39,9 +39,10 @@ func TokenAuth(config TokenAuthConfig) fiber.Handler {
 			if err != nil {
 				return err
 			}
-			app, ok := service.Verify(ctx.Context(), t)
+			token, ok := service.Verify(ctx.Context(), t)
 			if ok {
-				ctx.Locals("application", app)
+				ctx.Locals("application", token.Application)
+				ctx.Locals("token", token)
 				return ctx.Next()
 			}
 		}
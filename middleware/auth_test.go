@@ -18,15 +18,30 @@ type mockTokenService struct {
 	mock.Mock
 }
 
-func (m *mockTokenService) Generate(ctx context.Context, i interface{}) string {
+func (m *mockTokenService) Generate(ctx context.Context, i interface{}, options token.GenerateOptions) string {
 	args := m.Called(i)
 	return args.String(0)
 }
 
-func (m *mockTokenService) Verify(ctx context.Context, s string) (models.ApplicationDto, bool) {
+func (m *mockTokenService) Revoke(ctx context.Context, id interface{}) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockTokenService) List(ctx context.Context, applicationId interface{}) ([]models.TokenDto, error) {
+	args := m.Called(applicationId)
+	return args.Get(0).([]models.TokenDto), args.Error(1)
+}
+
+func (m *mockTokenService) Delete(ctx context.Context, id interface{}) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *mockTokenService) Verify(ctx context.Context, s string) (models.TokenDto, bool) {
 	args := m.Called(s)
 
-	return args.Get(0).(models.ApplicationDto), args.Bool(1)
+	return args.Get(0).(models.TokenDto), args.Bool(1)
 }
 
 func TestTokenAuth(t *testing.T) {
@@ -47,11 +62,15 @@ func TestTokenAuth(t *testing.T) {
 		app := fiber.New()
 		mockService := &mockTokenService{}
 
-		mockService.On("Verify", "Test.1.TestToken").Return(models.ApplicationDto{
-			ID:        1,
-			Name:      "TestApplication",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+		mockService.On("Verify", "Test.1.TestToken").Return(models.TokenDto{
+			ID:            uint(1),
+			ApplicationId: uint(1),
+			Application: models.ApplicationDto{
+				ID:        1,
+				Name:      "TestApplication",
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			},
 		}, true)
 
 		app.Use(TokenAuth(TokenAuthConfig{
@@ -80,11 +99,15 @@ func TestTokenAuth(t *testing.T) {
 		app := fiber.New()
 		mockService := &mockTokenService{}
 
-		mockService.On("Verify", "Test.1.TestToken").Return(models.ApplicationDto{
-			ID:        1,
-			Name:      "TestApplication",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+		mockService.On("Verify", "Test.1.TestToken").Return(models.TokenDto{
+			ID:            uint(1),
+			ApplicationId: uint(1),
+			Application: models.ApplicationDto{
+				ID:        1,
+				Name:      "TestApplication",
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			},
 		}, true)
 
 		app.Use(TokenAuth(TokenAuthConfig{
@@ -111,7 +134,7 @@ func TestTokenAuth(t *testing.T) {
 		app := fiber.New()
 		mockService := &mockTokenService{}
 
-		mockService.On("Verify", "Test.1.TestToken").Return(models.ApplicationDto{}, false)
+		mockService.On("Verify", "Test.1.TestToken").Return(models.TokenDto{}, false)
 
 		app.Use(TokenAuth(TokenAuthConfig{
 			Headers:        []string{"authorization"},
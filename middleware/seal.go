@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Unsealed - Rejects requests with 503 Service Unavailable while the server is sealed,
+// sealed is nil when the server does not use shamir key provider
+func Unsealed(sealed func() bool) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		if sealed != nil && sealed() {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "VaulGuard is sealed")
+		}
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsealed(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	sealed := true
+	app := fiber.New()
+	app.Use(Unsealed(func() bool { return sealed }))
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	asserts.Nil(err)
+	asserts.Equal(fiber.StatusServiceUnavailable, resp.StatusCode)
+
+	sealed = false
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	asserts.Nil(err)
+	asserts.Equal(fiber.StatusNoContent, resp.StatusCode)
+}
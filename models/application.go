@@ -4,9 +4,11 @@ import (
 	"time"
 )
 
+// Application - DataKey encrypts secrets of the application, it is stored wrapped by the master key
 type Application struct {
 	ID        uint   `gorm:"primarykey"`
-	Name      string `gorm:"not null;uniqueIndex"`
+	Name      string `gorm:"size:255;not null;uniqueIndex"`
+	DataKey   []byte `gorm:"size:128"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Tokens    []Token `gorm:"foreignKey:ApplicationId;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"errors"
+	"strings"
+)
+
+// Scope actions, scope is written as action:pattern (read:db/*, write:feature-flags/*, admin:cache, encrypt:pii)
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+	// ScopeEncrypt and ScopeDecrypt - Transit actions, resource is the transit key name
+	ScopeEncrypt = "encrypt"
+	ScopeDecrypt = "decrypt"
+)
+
+// ScopeCache - Admin resource for secrets cache invalidation
+const ScopeCache = "cache"
+
+// ScopeTransitPrefix - Admin resource transit/<name> allows rotation of the transit key
+const ScopeTransitPrefix = "transit/"
+
+var ErrInvalidScope = errors.New("scope must be in form action:pattern with action read, write, admin, encrypt or decrypt")
+
+// ValidateScope - Pattern is exact key or ends with * which matches any key with that prefix
+func ValidateScope(scope string) error {
+	action, pattern, ok := splitScope(scope)
+
+	if !ok || pattern == "" || strings.Contains(scope, ",") {
+		return ErrInvalidScope
+	}
+
+	switch action {
+	case ScopeRead, ScopeWrite, ScopeAdmin, ScopeEncrypt, ScopeDecrypt:
+	default:
+		return ErrInvalidScope
+	}
+
+	if i := strings.Index(pattern, "*"); i != -1 && i != len(pattern)-1 {
+		return ErrInvalidScope
+	}
+
+	return nil
+}
+
+// Allows - Token without scopes has full access to the application, otherwise
+// one of its scopes must grant the action on the resource (secret key or admin resource)
+func (t TokenDto) Allows(action, resource string) bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+
+	for _, scope := range t.Scopes {
+		scopeAction, pattern, ok := splitScope(scope)
+
+		if !ok || scopeAction != action {
+			continue
+		}
+
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(resource, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == resource {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Patterns - Patterns the action is granted on, nil for token without scopes
+// (full access) and empty for token which has no scope with the action
+func (t TokenDto) Patterns(action string) []string {
+	if len(t.Scopes) == 0 {
+		return nil
+	}
+
+	patterns := make([]string, 0, len(t.Scopes))
+
+	for _, scope := range t.Scopes {
+		if scopeAction, pattern, ok := splitScope(scope); ok && scopeAction == action {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+func splitScope(scope string) (string, string, bool) {
+	i := strings.Index(scope, ":")
+
+	if i == -1 {
+		return "", "", false
+	}
+
+	return scope[:i], scope[i+1:], true
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateScope(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	for _, scope := range []string{"read:db/*", "write:feature-flags/*", "admin:cache", "read:*", "read:deploy/key", "encrypt:pii", "decrypt:*"} {
+		asserts.Nil(ValidateScope(scope), scope)
+	}
+
+	for _, scope := range []string{"", "read", "read:", "delete:db/*", "read:db/*/password", "read:a,write:b"} {
+		asserts.Equal(ErrInvalidScope, ValidateScope(scope), scope)
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	asserts.True(TokenDto{}.Allows(ScopeWrite, "anything"))
+
+	token := TokenDto{Scopes: []string{"read:deploy/*", "read:db/password", "write:feature-flags/*", "admin:cache"}}
+
+	asserts.True(token.Allows(ScopeRead, "deploy/ssh/key"))
+	asserts.False(token.Allows(ScopeWrite, "deploy/ssh/key"))
+	asserts.True(token.Allows(ScopeRead, "db/password"))
+	asserts.False(token.Allows(ScopeRead, "db/password2"))
+	asserts.True(token.Allows(ScopeWrite, "feature-flags/new-ui"))
+	asserts.False(token.Allows(ScopeRead, "feature-flags/new-ui"))
+	asserts.True(token.Allows(ScopeAdmin, ScopeCache))
+
+	asserts.Nil(TokenDto{}.Patterns(ScopeRead))
+	asserts.Equal([]string{"deploy/*", "db/password"}, token.Patterns(ScopeRead))
+	asserts.NotNil(token.Patterns(ScopeDecrypt))
+	asserts.Empty(token.Patterns(ScopeDecrypt))
+}
+
+func TestValidateEnvironment(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	for _, environment := range []string{"default", "prod", "staging-eu", "feature_1.2"} {
+		asserts.Nil(ValidateEnvironment(environment), environment)
+	}
+
+	for _, environment := range []string{"", "prod/db", "prod,staging", "prod db", strings.Repeat("a", MaxEnvironmentLength+1)} {
+		asserts.Equal(ErrInvalidEnvironment, ValidateEnvironment(environment), environment)
+	}
+}
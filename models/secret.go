@@ -1,15 +1,48 @@
 package models
 
+import (
+	"time"
+)
+
+// Secret - Indexed string columns have explicit size, MySQL cannot index or set default on TEXT
 type Secret struct {
-	ID            uint   `gorm:"primaryKey"`
-	Key           string `gorm:"uniqueIndex:application_id_key_idx;not null;"`
-	ApplicationId uint   `gorm:"not null;uniqueIndex:application_id_key_idx;"`
-	Value         []byte `gorm:"not null;"`
+	ID            uint            `gorm:"primaryKey"`
+	Key           string          `gorm:"size:255;uniqueIndex:application_id_environment_key_idx;not null;"`
+	Environment   string          `gorm:"size:64;uniqueIndex:application_id_environment_key_idx;not null;default:default"`
+	ApplicationId uint            `gorm:"not null;uniqueIndex:application_id_environment_key_idx;"`
+	Value         []byte          `gorm:"not null;"`
+	Version       uint            `gorm:"not null;default:1"`
+	ExpiresAt     *time.Time      `gorm:"index"`
+	Versions      []SecretVersion `gorm:"foreignKey:SecretId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 }
 
 type SecretDto struct {
 	ID            interface{}
 	Key           string
-	ApplicationId uint
+	Environment   string
+	ApplicationId interface{}
 	Value         []byte
+	Version       uint
+	ExpiresAt     *time.Time
+}
+
+// Expired - Reports whether the secret has passed its expiry time
+func (s SecretDto) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !s.ExpiresAt.After(now)
+}
+
+// Expired - Reports whether the secret has passed its expiry time
+func (s Secret) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !s.ExpiresAt.After(now)
+}
+
+// SecretVersion - Immutable snapshot of the encrypted secret value,
+// one row is appended on every create, update and rollback
+type SecretVersion struct {
+	ID        uint   `gorm:"primaryKey"`
+	SecretId  uint   `gorm:"not null;uniqueIndex:secret_id_version_idx;"`
+	Version   uint   `gorm:"not null;uniqueIndex:secret_id_version_idx;"`
+	Value     []byte `gorm:"not null;"`
+	TokenId   *uint
+	CreatedAt time.Time
 }
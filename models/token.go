@@ -1,6 +1,8 @@
 package models
 
 import (
+	"errors"
+	"strings"
 	"time"
 )
 
@@ -9,6 +11,10 @@ type Token struct {
 	Value         []byte      `gorm:"not null"`
 	ApplicationId uint        `gorm:"not null"`
 	Application   Application `gorm:"foreignKey:ApplicationId"`
+	Environments  string      `gorm:"size:1024;not null;default:''"`
+	Scopes        string      `gorm:"size:1024;not null;default:''"`
+	ExpiresAt     *time.Time
+	RevokedAt     *time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
@@ -17,7 +23,71 @@ type TokenDto struct {
 	ID            interface{}
 	Value         []byte
 	ApplicationId interface{}
+	Environments  []string
+	Scopes        []string
+	ExpiresAt     *time.Time
+	RevokedAt     *time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Application   ApplicationDto
 }
+
+// Active - Token is neither revoked nor past its expiry time
+func (t TokenDto) Active(now time.Time) bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+
+	return t.ExpiresAt == nil || t.ExpiresAt.After(now)
+}
+
+// AllowsEnvironment - Token without environments has access to all of them
+func (t TokenDto) AllowsEnvironment(environment string) bool {
+	if len(t.Environments) == 0 {
+		return true
+	}
+
+	for _, env := range t.Environments {
+		if env == environment {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JoinEnvironments - Environments and scopes are stored as comma separated list in SQL
+func JoinEnvironments(environments []string) string {
+	return strings.Join(environments, ",")
+}
+
+func SplitEnvironments(environments string) []string {
+	if environments == "" {
+		return nil
+	}
+
+	return strings.Split(environments, ",")
+}
+
+// MaxEnvironmentLength - Longest environment name, names are stored in comma separated token lists
+const MaxEnvironmentLength = 64
+
+var ErrInvalidEnvironment = errors.New("environment must be 1 to 64 letters, digits, '-', '_' or '.'")
+
+// ValidateEnvironment - Environment names are restricted so they can never contain the key separator
+// or the list separator used to store environments of a token
+func ValidateEnvironment(environment string) error {
+	if environment == "" || len(environment) > MaxEnvironmentLength {
+		return ErrInvalidEnvironment
+	}
+
+	for _, r := range environment {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return ErrInvalidEnvironment
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// TransitKey - One version of the named transit key of the application,
+// key is wrapped by the application data key and never leaves the server
+type TransitKey struct {
+	ID            uint        `gorm:"primaryKey"`
+	ApplicationId uint        `gorm:"not null;uniqueIndex:application_id_name_version_idx"`
+	Application   Application `gorm:"foreignKey:ApplicationId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name          string      `gorm:"size:255;not null;uniqueIndex:application_id_name_version_idx"`
+	Version       uint        `gorm:"not null;uniqueIndex:application_id_name_version_idx"`
+	Key           []byte      `gorm:"size:128;not null"`
+	CreatedAt     time.Time
+}
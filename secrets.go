@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/spf13/cobra"
+)
+
+func secretCommands(ctx context.Context) *cobra.Command {
+	secrets := &cobra.Command{
+		Use: "secrets",
+	}
+
+	importSecrets := &cobra.Command{
+		Use:  "import",
+		Long: "Import secrets for application from dotenv, JSON or YAML file",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			appName, _ := cmd.Flags().GetString("app")
+			environment, _ := cmd.Flags().GetString("env")
+			formatName, _ := cmd.Flags().GetString("format")
+			modeName, _ := cmd.Flags().GetString("mode")
+
+			if err := models.ValidateEnvironment(environment); err != nil {
+				return err
+			}
+
+			mode, err := secret.ParseImportMode(modeName)
+
+			if err != nil {
+				return err
+			}
+
+			format := secret.FormatFromFilename(args[0])
+
+			if formatName != "" {
+				if format, err = secret.ParseFormat(formatName); err != nil {
+					return err
+				}
+			}
+
+			app, err := applicationService.GetByName(ctx, appName)
+
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Open(args[0])
+
+			if err != nil {
+				return err
+			}
+
+			defer file.Close()
+
+			data, err := secret.Parse(format, file)
+
+			if err != nil {
+				return err
+			}
+
+			result, err := secretService.Import(ctx, app.ID, environment, data, mode)
+
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created: %d, Updated: %d, Skipped: %d\n", len(result.Created), len(result.Updated), len(result.Skipped))
+
+			return nil
+		},
+	}
+
+	importSecrets.Flags().String("app", "", "Name of the application secrets belong to")
+	importSecrets.Flags().String("env", secret.DefaultEnvironment, "Environment secrets are imported into")
+	importSecrets.Flags().String("format", "", "File format (dotenv, json, yaml), detected from extension if empty")
+	importSecrets.Flags().String("mode", string(secret.ImportFail), "Policy for existing keys (skip, overwrite, fail)")
+	_ = importSecrets.MarkFlagRequired("app")
+
+	exportSecrets := &cobra.Command{
+		Use:  "export",
+		Long: "Export decrypted secrets of application as dotenv, JSON, YAML or shell script",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			appName, _ := cmd.Flags().GetString("app")
+			environment, _ := cmd.Flags().GetString("env")
+			formatName, _ := cmd.Flags().GetString("format")
+			output, _ := cmd.Flags().GetString("output")
+
+			if err := models.ValidateEnvironment(environment); err != nil {
+				return err
+			}
+
+			format, err := secret.ParseFormat(formatName)
+
+			if err != nil {
+				return err
+			}
+
+			app, err := applicationService.GetByName(ctx, appName)
+
+			if err != nil {
+				return err
+			}
+
+			out := os.Stdout
+
+			// Output file is replaced only after the whole export succeeded
+			if output != "" {
+				if out, err = ioutil.TempFile(filepath.Dir(output), ".vaulguard-export-*"); err != nil {
+					return err
+				}
+
+				defer os.Remove(out.Name())
+				defer out.Close()
+			}
+
+			writer := secret.NewWriter(format, out)
+
+			if err := secretService.Export(ctx, app.ID, environment, 100, writer.Write); err != nil {
+				if output == "" {
+					_ = writer.Abort(err)
+				}
+
+				return err
+			}
+
+			if err := writer.Close(); err != nil {
+				return err
+			}
+
+			if output == "" {
+				return nil
+			}
+
+			if err := out.Close(); err != nil {
+				return err
+			}
+
+			return os.Rename(out.Name(), output)
+		},
+	}
+
+	exportSecrets.Flags().String("app", "", "Name of the application secrets belong to")
+	exportSecrets.Flags().String("env", secret.DefaultEnvironment, "Environment secrets are exported from")
+	exportSecrets.Flags().String("format", string(secret.FormatDotEnv), "Output format (dotenv, json, yaml, shell)")
+	exportSecrets.Flags().String("output", "", "File secrets are written to, standard output if empty")
+	_ = exportSecrets.MarkFlagRequired("app")
+
+	secrets.AddCommand(importSecrets, exportSecrets)
+
+	return secrets
+}
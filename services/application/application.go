@@ -2,15 +2,42 @@ package application
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
+
 	"github.com/BrosSquad/vaulguard/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var ErrInvalidID = errors.New("application id must be a number or MongoDB ObjectID")
+
 type Service interface {
 	List(context.Context, int, func([]models.ApplicationDto) error) error
 	GetByName(context.Context, string) (models.ApplicationDto, error)
 	Create(context.Context, string) (models.ApplicationDto, error)
 	Get(context.Context, int, int) ([]models.ApplicationDto, error)
+	// Search - Page of applications whose name contains the query, case insensitive
+	Search(ctx context.Context, query string, page, perPage int) ([]models.ApplicationDto, error)
 	GetOne(context.Context, interface{}) (models.ApplicationDto, error)
 	Update(context.Context, interface{}, string) (models.ApplicationDto, error)
 	Delete(context.Context, interface{}) error
 }
+
+// ParseID - Application ID from the URL, uint for SQL and ObjectID for MongoDB
+func ParseID(id string) (interface{}, error) {
+	if sqlID, err := strconv.ParseUint(id, 10, 64); err == nil && sqlID > 0 {
+		return uint(sqlID), nil
+	}
+
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		return objectID, nil
+	}
+
+	return nil, ErrInvalidID
+}
+
+// escapeLike - Escapes LIKE wildcards in the query, used with ESCAPE '!'
+func escapeLike(query string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(query)
+}
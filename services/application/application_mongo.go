@@ -2,40 +2,242 @@ package application
 
 import (
 	"context"
+	"regexp"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/db"
 	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type mongoService struct {
 	client *mongo.Collection
 }
 
+type mongoApplication struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Name      string             `bson:"Name"`
+	DataKey   []byte             `bson:"DataKey,omitempty"`
+	CreatedAt time.Time          `bson:"CreatedAt"`
+	UpdatedAt time.Time          `bson:"UpdatedAt"`
+}
+
 func (m mongoService) List(ctx context.Context, size int, cb func([]models.ApplicationDto) error) error {
-	panic("implement me")
+	findOptions := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetBatchSize(int32(size))
+
+	cursor, err := m.client.Find(ctx, bson.M{}, findOptions)
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+	appsDto := make([]models.ApplicationDto, 0, size)
+
+	for cursor.Next(ctx) {
+		var app mongoApplication
+
+		if err := cursor.Decode(&app); err != nil {
+			return err
+		}
+
+		appsDto = append(appsDto, app.dto())
+
+		if len(appsDto) == size {
+			if err := cb(appsDto); err != nil {
+				return err
+			}
+			appsDto = appsDto[:0]
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if len(appsDto) > 0 {
+		return cb(appsDto)
+	}
+
+	return nil
 }
 
 func (m mongoService) GetByName(ctx context.Context, name string) (models.ApplicationDto, error) {
-	panic("implement me")
+	var app mongoApplication
+
+	if err := m.client.FindOne(ctx, bson.M{"Name": name}).Decode(&app); err != nil {
+		return models.ApplicationDto{}, err
+	}
+
+	return app.dto(), nil
 }
 
 func (m mongoService) Create(ctx context.Context, name string) (models.ApplicationDto, error) {
-	panic("implement me")
+	now := time.Now()
+	app := mongoApplication{
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	result, err := m.client.InsertOne(ctx, app)
+
+	// Unique Name index is created in db.MongoMigrate
+	if services.IsDuplicateKeyError(err) {
+		return models.ApplicationDto{}, services.ErrAlreadyExists
+	}
+
+	if err != nil {
+		return models.ApplicationDto{}, err
+	}
+
+	app.ID = result.InsertedID.(primitive.ObjectID)
+
+	return app.dto(), nil
 }
 
 func (m mongoService) Get(ctx context.Context, page, perPage int) ([]models.ApplicationDto, error) {
-	panic("implement me")
+	var apps []mongoApplication
+
+	if page < 0 {
+		page *= -1
+	}
+
+	if page == 0 {
+		page = 1
+	}
+
+	if perPage < 0 {
+		perPage *= -1
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+
+	cursor, err := m.client.Find(ctx, bson.M{}, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cursor.All(ctx, &apps); err != nil {
+		return nil, err
+	}
+
+	appsDto := make([]models.ApplicationDto, 0, len(apps))
+
+	for _, app := range apps {
+		appsDto = append(appsDto, app.dto())
+	}
+
+	return appsDto, nil
+}
+
+func (m mongoService) Search(ctx context.Context, query string, page, perPage int) ([]models.ApplicationDto, error) {
+	var apps []mongoApplication
+
+	if page < 1 {
+		page = 1
+	}
+
+	if perPage < 0 {
+		perPage *= -1
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetSkip(int64((page - 1) * perPage)).
+		SetLimit(int64(perPage))
+
+	filter := bson.M{"Name": bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}}
+	cursor, err := m.client.Find(ctx, filter, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cursor.All(ctx, &apps); err != nil {
+		return nil, err
+	}
+
+	appsDto := make([]models.ApplicationDto, 0, len(apps))
+
+	for _, app := range apps {
+		appsDto = append(appsDto, app.dto())
+	}
+
+	return appsDto, nil
 }
 
 func (m mongoService) GetOne(ctx context.Context, id interface{}) (models.ApplicationDto, error) {
-	panic("implement me")
+	var app mongoApplication
+
+	if err := m.client.FindOne(ctx, bson.M{"_id": id}).Decode(&app); err != nil {
+		return models.ApplicationDto{}, err
+	}
+
+	return app.dto(), nil
 }
 
 func (m mongoService) Update(ctx context.Context, id interface{}, name string) (models.ApplicationDto, error) {
-	panic("implement me")
+	var app mongoApplication
+
+	err := m.client.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"Name":      name,
+			"UpdatedAt": time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&app)
+
+	if services.IsDuplicateKeyError(err) {
+		return models.ApplicationDto{}, services.ErrAlreadyExists
+	}
+
+	if err != nil {
+		return models.ApplicationDto{}, err
+	}
+
+	return app.dto(), nil
 }
 
+// Delete - Removes the application with all of its tokens, secrets and transit keys,
+// tokens go first so the application loses access before anything else
 func (m mongoService) Delete(ctx context.Context, id interface{}) error {
-	panic("implement me")
+	database := m.client.Database()
+	filter := bson.M{"ApplicationId": id}
+
+	if _, err := database.Collection(db.TokensMongoCollection).DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	if _, err := database.Collection(db.SecretsMongoCollection).DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	if _, err := database.Collection(db.TransitKeysMongoCollection).DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	_, err := m.client.DeleteOne(ctx, bson.M{"_id": id})
+
+	return err
+}
+
+func (a mongoApplication) dto() models.ApplicationDto {
+	return models.ApplicationDto{
+		ID:        a.ID,
+		Name:      a.Name,
+		CreatedAt: a.CreatedAt,
+		UpdatedAt: a.UpdatedAt,
+	}
 }
 
 func NewMongoService(client *mongo.Collection) Service {
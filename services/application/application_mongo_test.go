@@ -0,0 +1,134 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/db"
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMongoApplicationService(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+	mongoURI := os.Getenv("VAULGUARD_MONGO_TESTING")
+	if mongoURI == "" {
+		mongoURI = "mongodb://localhost:27017"
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI).SetServerSelectionTimeout(5 * time.Second))
+	asserts.Nil(err)
+	asserts.Nil(client.Connect(ctx))
+	defer client.Disconnect(ctx)
+
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("MongoDB is not available on %s (set VAULGUARD_MONGO_TESTING): %v", mongoURI, err)
+	}
+
+	database := client.Database("vaulguard_application_test")
+	defer database.Drop(ctx)
+	asserts.Nil(db.MongoMigrate(ctx, database))
+
+	service := NewMongoService(database.Collection(db.ApplicationMongoCollection))
+
+	t.Run("CreateApplication", func(t *testing.T) {
+		app, err := service.Create(ctx, "Test Application")
+		asserts.Nil(err)
+		asserts.False(app.ID.(primitive.ObjectID).IsZero())
+		asserts.EqualValues("Test Application", app.Name)
+		asserts.False(app.CreatedAt.IsZero())
+	})
+
+	t.Run("Create2ApplicationWithSameName", func(t *testing.T) {
+		_, err := service.Create(ctx, "Test Application 2")
+		asserts.Nil(err)
+		_, err = service.Create(ctx, "Test Application 2")
+		asserts.True(errors.Is(err, services.ErrAlreadyExists))
+	})
+
+	t.Run("GetByNameAndGetOne", func(t *testing.T) {
+		created, err := service.Create(ctx, "Test App GetOne")
+		asserts.Nil(err)
+
+		app, err := service.GetByName(ctx, "Test App GetOne")
+		asserts.Nil(err)
+		asserts.Equal(created.ID, app.ID)
+
+		app, err = service.GetOne(ctx, created.ID)
+		asserts.Nil(err)
+		asserts.EqualValues("Test App GetOne", app.Name)
+
+		_, err = service.GetByName(ctx, "Missing App")
+		asserts.True(errors.Is(err, mongo.ErrNoDocuments))
+	})
+
+	t.Run("UpdateApplication", func(t *testing.T) {
+		app, err := service.Create(ctx, "Test Application 4")
+		asserts.Nil(err)
+		app, err = service.Update(ctx, app.ID, "Changed Name")
+		asserts.Nil(err)
+		asserts.EqualValues("Changed Name", app.Name)
+
+		_, err = service.Update(ctx, app.ID, "Test Application")
+		asserts.True(errors.Is(err, services.ErrAlreadyExists))
+	})
+
+	t.Run("ListAndGet", func(t *testing.T) {
+		count := 0
+		batches := 0
+		asserts.Nil(service.List(ctx, 2, func(dtos []models.ApplicationDto) error {
+			asserts.LessOrEqual(len(dtos), 2)
+			count += len(dtos)
+			batches++
+			return nil
+		}))
+		asserts.Equal(4, count)
+		asserts.Equal(2, batches)
+
+		apps, err := service.Get(ctx, 2, 3)
+		asserts.Nil(err)
+		asserts.Len(apps, 1)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		apps, err := service.Search(ctx, "application 2", 1, 10)
+		asserts.Nil(err)
+		asserts.Len(apps, 1)
+		asserts.EqualValues("Test Application 2", apps[0].Name)
+
+		apps, err = service.Search(ctx, "app.", 1, 10)
+		asserts.Nil(err)
+		asserts.Empty(apps, "query is not a regular expression")
+	})
+
+	t.Run("DeleteCascades", func(t *testing.T) {
+		app, err := service.Create(ctx, "Test Application Delete")
+		asserts.Nil(err)
+
+		for _, collection := range []string{db.TokensMongoCollection, db.SecretsMongoCollection, db.TransitKeysMongoCollection} {
+			_, err := database.Collection(collection).InsertOne(ctx, bson.M{"ApplicationId": app.ID, "Key": "KEY", "Environment": "default"})
+			asserts.Nil(err)
+		}
+
+		asserts.Nil(service.Delete(ctx, app.ID))
+
+		_, err = service.GetOne(ctx, app.ID)
+		asserts.True(errors.Is(err, mongo.ErrNoDocuments))
+
+		for _, collection := range []string{db.TokensMongoCollection, db.SecretsMongoCollection, db.TransitKeysMongoCollection} {
+			count, err := database.Collection(collection).CountDocuments(ctx, bson.M{"ApplicationId": app.ID})
+			asserts.Nil(err)
+			asserts.Zero(count)
+		}
+	})
+}
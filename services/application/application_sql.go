@@ -2,6 +2,9 @@ package application
 
 import (
 	"context"
+	"strings"
+
+	"github.com/BrosSquad/vaulguard/db"
 	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services"
 	"gorm.io/gorm"
@@ -38,7 +41,7 @@ func (s sqlService) List(ctx context.Context, size int, cb func([]models.Applica
 func (s sqlService) GetByName(ctx context.Context, name string) (models.ApplicationDto, error) {
 	app := models.Application{}
 
-	if err := s.db.WithContext(ctx).Where("name = ?", name).Limit(1).Find(&app).Error; err != nil {
+	if err := s.db.WithContext(ctx).Where("name = ?", name).First(&app).Error; err != nil {
 		return models.ApplicationDto{}, err
 	}
 
@@ -51,26 +54,13 @@ func (s sqlService) GetByName(ctx context.Context, name string) (models.Applicat
 }
 
 func (s sqlService) Create(ctx context.Context, name string) (models.ApplicationDto, error) {
-	app := models.Application{}
-	var count int64
-	tx := s.db.WithContext(ctx).Model(&app).Where("name = ?", name).Count(&count)
-
-	if tx.Error != nil {
-		return models.ApplicationDto{}, nil
-	}
-
-	if count > 0 {
-		return models.ApplicationDto{}, services.ErrAlreadyExists
-	}
-
-	app = models.Application{
+	app := models.Application{
 		Name: name,
 	}
 
-	tx = s.db.Create(&app)
-
-	if tx.Error != nil {
-		return models.ApplicationDto{}, tx.Error
+	// Unique index on the name rejects concurrent creates as well
+	if err := s.db.WithContext(ctx).Create(&app).Error; err != nil {
+		return models.ApplicationDto{}, uniqueName(err)
 	}
 
 	return models.ApplicationDto{
@@ -112,10 +102,71 @@ func (s sqlService) Get(ctx context.Context, page, perPage int) ([]models.Applic
 	return appsDto, nil
 }
 
+func (s sqlService) Search(ctx context.Context, query string, page, perPage int) ([]models.ApplicationDto, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	if perPage < 0 {
+		perPage *= -1
+	}
+
+	apps := make([]models.Application, 0, perPage)
+
+	err := s.db.WithContext(ctx).
+		Where("LOWER(name) LIKE ? ESCAPE '!'", "%"+escapeLike(strings.ToLower(query))+"%").
+		Order("id").
+		Limit(perPage).
+		Offset((page - 1) * perPage).
+		Find(&apps).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	appsDto := make([]models.ApplicationDto, 0, len(apps))
+
+	for _, app := range apps {
+		appsDto = append(appsDto, models.ApplicationDto{
+			ID:        app.ID,
+			Name:      app.Name,
+			CreatedAt: app.CreatedAt,
+			UpdatedAt: app.UpdatedAt,
+		})
+	}
+
+	return appsDto, nil
+}
+
+// uniqueName - Name taken by another application is reported like by the MongoDB service
+func uniqueName(err error) error {
+	if db.IsUniqueViolation(err) {
+		return services.ErrAlreadyExists
+	}
+
+	return err
+}
+
+// sqlID - MongoDB IDs never match SQL rows
+func sqlID(id interface{}) (uint, error) {
+	appID, ok := id.(uint)
+
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	return appID, nil
+}
+
 func (s sqlService) GetOne(ctx context.Context, id interface{}) (models.ApplicationDto, error) {
 	app := models.Application{}
+	appID, err := sqlID(id)
+
+	if err != nil {
+		return models.ApplicationDto{}, err
+	}
 
-	if err := s.db.WithContext(ctx).First(&app, id.(uint)).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&app, appID).Error; err != nil {
 		return models.ApplicationDto{}, err
 	}
 
@@ -129,17 +180,21 @@ func (s sqlService) GetOne(ctx context.Context, id interface{}) (models.Applicat
 
 func (s sqlService) Update(ctx context.Context, id interface{}, name string) (models.ApplicationDto, error) {
 	app := models.Application{}
+	appID, err := sqlID(id)
 
-	if err := s.db.WithContext(ctx).First(&app, id).Error; err != nil {
+	if err != nil {
 		return models.ApplicationDto{}, err
 	}
 
-	app.Name = name
-
-	if err := s.db.WithContext(ctx).Save(&app).Error; err != nil {
+	if err := s.db.WithContext(ctx).First(&app, appID).Error; err != nil {
 		return models.ApplicationDto{}, err
 	}
 
+	// Only the name is written, Save would overwrite data key generated concurrently
+	if err := s.db.WithContext(ctx).Model(&app).Update("name", name).Error; err != nil {
+		return models.ApplicationDto{}, uniqueName(err)
+	}
+
 	return models.ApplicationDto{
 		ID:        app.ID,
 		Name:      app.Name,
@@ -148,9 +203,36 @@ func (s sqlService) Update(ctx context.Context, id interface{}, name string) (mo
 	}, nil
 }
 
+// Delete - Removes the application with all of its tokens, secrets and transit keys,
+// tokens go first so the application loses access before anything else
 func (s sqlService) Delete(ctx context.Context, id interface{}) error {
-	app := models.Application{}
-	return s.db.WithContext(ctx).Unscoped().Delete(&app, id).Error
+	appID, err := sqlID(id)
+
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("application_id = ?", appID).Delete(&models.Token{}).Error; err != nil {
+			return err
+		}
+
+		secrets := tx.Model(&models.Secret{}).Select("id").Where("application_id = ?", appID)
+
+		if err := tx.Where("secret_id IN (?)", secrets).Delete(&models.SecretVersion{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("application_id = ?", appID).Delete(&models.Secret{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("application_id = ?", appID).Delete(&models.TransitKey{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&models.Application{}, appID).Error
+	})
 }
 
 func NewSqlService(db *gorm.DB) Service {
@@ -23,7 +23,7 @@ func TestApplicationService(t *testing.T) {
 	defer db.Close()
 
 	asserts.Nil(err)
-	asserts.Nil(conn.AutoMigrate(&models.Application{}, &models.Token{}))
+	asserts.Nil(conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}, &models.TransitKey{}))
 	service := NewSqlService(conn)
 
 	t.Run("ListApplications", func(t *testing.T) {
@@ -72,6 +72,73 @@ func TestApplicationService(t *testing.T) {
 		asserts.EqualValues("Changed Name", app.Name)
 	})
 
+	t.Run("UpdateApplicationDuplicateName", func(t *testing.T) {
+		ctx := context.Background()
+		app, err := service.Create(ctx, "Test Application 5")
+		asserts.Nil(err)
+		_, err = service.Create(ctx, "Test Application 6")
+		asserts.Nil(err)
+
+		_, err = service.Update(ctx, app.ID, "Test Application 6")
+		asserts.True(errors.Is(err, services.ErrAlreadyExists))
+
+		_, err = service.Update(ctx, app.ID, "Test Application 5")
+		asserts.Nil(err, "keeping the name is not a conflict")
+	})
+
+	t.Run("DeleteCascades", func(t *testing.T) {
+		ctx := context.Background()
+		app, err := service.Create(ctx, "Test Application Delete")
+		asserts.Nil(err)
+		appID := app.ID.(uint)
+
+		secret := models.Secret{Key: "KEY", ApplicationId: appID, Value: []byte("value")}
+		asserts.Nil(conn.Create(&secret).Error)
+		asserts.Nil(conn.Create(&models.SecretVersion{SecretId: secret.ID, Version: 1, Value: []byte("value")}).Error)
+		asserts.Nil(conn.Create(&models.Token{ApplicationId: appID, Value: []byte("token")}).Error)
+		asserts.Nil(conn.Create(&models.TransitKey{ApplicationId: appID, Name: "pii", Version: 1, Key: []byte("key")}).Error)
+
+		asserts.Nil(service.Delete(ctx, app.ID))
+
+		_, err = service.GetOne(ctx, app.ID)
+		asserts.True(errors.Is(err, gorm.ErrRecordNotFound))
+
+		for _, model := range []interface{}{&models.Secret{}, &models.Token{}, &models.TransitKey{}} {
+			var count int64
+			asserts.Nil(conn.Model(model).Where("application_id = ?", appID).Count(&count).Error)
+			asserts.Zero(count)
+		}
+
+		var versions int64
+		asserts.Nil(conn.Model(&models.SecretVersion{}).Where("secret_id = ?", secret.ID).Count(&versions).Error)
+		asserts.Zero(versions)
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		ctx := context.Background()
+		for _, appName := range []string{"Search Billing", "search billing-api", "Search 100%"} {
+			_, err := service.Create(ctx, appName)
+			asserts.Nil(err)
+		}
+
+		apps, err := service.Search(ctx, "BILLING", 1, 10)
+		asserts.Nil(err)
+		asserts.Len(apps, 2)
+		asserts.EqualValues("Search Billing", apps[0].Name)
+
+		apps, err = service.Search(ctx, "BILLING", 2, 1)
+		asserts.Nil(err)
+		asserts.Len(apps, 1)
+		asserts.EqualValues("search billing-api", apps[0].Name)
+
+		apps, err = service.Search(ctx, "0%", 1, 10)
+		asserts.Nil(err)
+		asserts.Len(apps, 1)
+
+		_, err = service.GetOne(ctx, "not an id")
+		asserts.True(errors.Is(err, gorm.ErrRecordNotFound))
+	})
+
 	t.Run("UpdateApplicationNotFound", func(t *testing.T) {
 		ctx := context.Background()
 		_, err := service.Update(ctx, uint(152000), "New Name")
@@ -93,6 +160,9 @@ func TestApplicationService(t *testing.T) {
 		asserts.EqualValues("Test App2", app.Name)
 		asserts.False(app.CreatedAt.IsZero())
 		asserts.False(app.UpdatedAt.IsZero())
+
+		_, err = service.GetByName(ctx, "Missing App")
+		asserts.True(errors.Is(err, gorm.ErrRecordNotFound))
 	})
 
 	t.Run("GetOne", func(t *testing.T) {
@@ -0,0 +1,223 @@
+package datakey
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/gofiber/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultBatchSize - Applications loaded at once by Rewrap when batch size is not set
+const DefaultBatchSize = 100
+
+var ErrInvalidDataKey = errors.New("data key of the application cannot be unwrapped with the master key")
+
+// Storage - Wrapped data keys stored alongside the applications
+type Storage interface {
+	// Get - Wrapped data key of the application, nil when the application has none yet
+	Get(ctx context.Context, applicationID interface{}) ([]byte, error)
+	// SetIfEmpty - Stores the wrapped data key unless the application already has one,
+	// the key stored by whoever came first is returned
+	SetIfEmpty(ctx context.Context, applicationID interface{}, wrapped []byte) ([]byte, error)
+	// Each - Calls cb with wrapped data keys of applications which have one, batch is keyed by application ID
+	Each(ctx context.Context, batchSize int, cb func(map[interface{}][]byte) error) error
+	// Replace - Swaps the wrapped data key, key changed in the meantime is left as it is
+	Replace(ctx context.Context, applicationID interface{}, old, wrapped []byte) error
+}
+
+// KeyRing - Per application data encryption keys, each wrapped by the master key and bound to its application.
+// Data key is generated on first use, so applications created before data keys existed get one lazily.
+// Unwrapped keys are kept for the life of the process, one entry per application
+type KeyRing struct {
+	mutex     sync.RWMutex
+	master    services.Encryption
+	storage   Storage
+	algorithm services.Algorithm
+	keys      map[interface{}]services.Encryption
+}
+
+// NewKeyRing - Values are sealed by data keys with the algorithm, data keys are wrapped by the master key
+func NewKeyRing(master services.Encryption, storage Storage, algorithm services.Algorithm) *KeyRing {
+	return &KeyRing{
+		master:    master,
+		storage:   storage,
+		algorithm: algorithm,
+		keys:      make(map[interface{}]services.Encryption),
+	}
+}
+
+// Algorithm - Cipher new values are sealed with, keys derived from data keys should use it as well
+func (k *KeyRing) Algorithm() services.Algorithm {
+	return k.algorithm
+}
+
+// Encryption - Encryption of the application secrets, values sealed with the
+// master key before the application got its data key are still decrypted
+func (k *KeyRing) Encryption(ctx context.Context, applicationID interface{}) (services.Encryption, error) {
+	k.mutex.RLock()
+	encryption, ok := k.keys[applicationID]
+	k.mutex.RUnlock()
+
+	if ok {
+		return encryption, nil
+	}
+
+	wrapped, err := k.storage.Get(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if wrapped == nil {
+		if wrapped, err = k.generate(ctx, applicationID); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := k.master.DecryptWithAD(nil, wrapped, associatedData(applicationID))
+
+	if err != nil {
+		return nil, ErrInvalidDataKey
+	}
+
+	dataKey, err := services.NewKeyedEncryptionWithAlgorithm(k.algorithm, key)
+	keyID := services.KeyID(key)
+	locked.Wipe(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryption = applicationEncryption{Encryption: dataKey, keyID: keyID, master: k.master}
+
+	k.mutex.Lock()
+	k.keys[applicationID] = encryption
+	k.mutex.Unlock()
+
+	return encryption, nil
+}
+
+// Rewrap - Wraps every data key with the current master key, used after master key rotation
+// so the previous master key can be retired. Data keys themselves do not change
+func (k *KeyRing) Rewrap(ctx context.Context, batchSize int) (int, error) {
+	rewrapped := 0
+
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	err := k.storage.Each(ctx, batchSize, func(keys map[interface{}][]byte) error {
+		for applicationID, wrapped := range keys {
+			key, err := k.master.DecryptWithAD(nil, wrapped, associatedData(applicationID))
+
+			if err != nil {
+				return ErrInvalidDataKey
+			}
+
+			rewrap, err := k.master.EncryptStringWithAD(utils.GetString(key), associatedData(applicationID))
+			locked.Wipe(key)
+
+			if err != nil {
+				return err
+			}
+
+			if err := k.storage.Replace(ctx, applicationID, wrapped, rewrap); err != nil {
+				return err
+			}
+
+			rewrapped++
+		}
+
+		return nil
+	})
+
+	return rewrapped, err
+}
+
+// Forget - Drops the unwrapped key of the deleted application
+func (k *KeyRing) Forget(applicationID interface{}) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	delete(k.keys, applicationID)
+}
+
+func (k *KeyRing) generate(ctx context.Context, applicationID interface{}) ([]byte, error) {
+	key := make([]byte, services.SecretKeyLength)
+	n, err := rand.Read(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n != services.SecretKeyLength {
+		return nil, services.ErrNotEnoughBytes
+	}
+
+	// EncryptString prepares the envelope prefix secret key encryption expects in dst
+	wrapped, err := k.master.EncryptStringWithAD(utils.GetString(key), associatedData(applicationID))
+	locked.Wipe(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return k.storage.SetIfEmpty(ctx, applicationID, wrapped)
+}
+
+// associatedData - Binds the wrapped data key to its application, so it cannot be
+// unwrapped as the key of another application or opened as a secret value
+func associatedData(applicationID interface{}) []byte {
+	var id string
+
+	switch v := applicationID.(type) {
+	case uint:
+		id = strconv.FormatUint(uint64(v), 10)
+	case primitive.ObjectID:
+		id = v.Hex()
+	default:
+		id = fmt.Sprint(v)
+	}
+
+	return []byte("vaulguard:datakey:" + id)
+}
+
+// applicationEncryption - Encrypts with the data key, values which were not sealed with the data key
+// (by envelope key ID) are legacy values written directly with the master key before data keys existed
+type applicationEncryption struct {
+	services.Encryption
+	keyID  uint32
+	master services.Encryption
+}
+
+func (a applicationEncryption) Decrypt(dst, msg []byte) ([]byte, error) {
+	return a.DecryptWithAD(dst, msg, nil)
+}
+
+func (a applicationEncryption) DecryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	if keyID, ok := services.CiphertextKeyID(msg); ok && keyID == a.keyID {
+		return a.Encryption.DecryptWithAD(dst, msg, additionalData)
+	}
+
+	return a.master.DecryptWithAD(dst, msg, additionalData)
+}
+
+func (a applicationEncryption) DecryptString(msg []byte) (string, error) {
+	return a.DecryptStringWithAD(msg, nil)
+}
+
+func (a applicationEncryption) DecryptStringWithAD(msg, additionalData []byte) (string, error) {
+	message, err := a.DecryptWithAD(nil, msg, additionalData)
+
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GetString(message), nil
+}
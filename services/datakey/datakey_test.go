@@ -0,0 +1,212 @@
+package datakey
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestKeyRing(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	conn, err := gorm.Open(sqlite.Open("datakey_test.db"), &gorm.Config{})
+	asserts.Nil(err)
+	db, _ := conn.DB()
+	defer os.Remove("datakey_test.db")
+	defer db.Close()
+
+	asserts.Nil(conn.AutoMigrate(&models.Application{}))
+
+	first := models.Application{Name: "First"}
+	second := models.Application{Name: "Second"}
+	asserts.Nil(conn.Create(&first).Error)
+	asserts.Nil(conn.Create(&second).Error)
+
+	key := make([]byte, services.SecretKeyLength)
+	_, _ = rand.Read(key)
+	master, err := services.NewSecretKeyEncryption(key)
+	asserts.Nil(err)
+
+	storage := NewSqlStorage(conn)
+	keys := NewKeyRing(master, storage, services.DefaultAlgorithm)
+
+	t.Run("DataKeyIsGeneratedAndWrapped", func(t *testing.T) {
+		asserts := require.New(t)
+		encryption, err := keys.Encryption(ctx, first.ID)
+		asserts.Nil(err)
+
+		wrapped, err := storage.Get(ctx, first.ID)
+		asserts.Nil(err)
+		asserts.NotEmpty(wrapped)
+
+		dataKey, err := master.DecryptWithAD(nil, wrapped, associatedData(first.ID))
+		asserts.Nil(err)
+		asserts.Len(dataKey, services.SecretKeyLength)
+
+		// Bound to the application, cannot be unwrapped without it or as the key of another application
+		_, err = master.Decrypt(nil, wrapped)
+		asserts.NotNil(err)
+		_, err = master.DecryptWithAD(nil, wrapped, associatedData(second.ID))
+		asserts.NotNil(err)
+
+		encrypted, err := encryption.EncryptString("value")
+		asserts.Nil(err)
+
+		_, err = master.DecryptString(encrypted)
+		asserts.NotNil(err)
+	})
+
+	t.Run("ApplicationsDoNotShareKeys", func(t *testing.T) {
+		asserts := require.New(t)
+		firstEncryption, err := keys.Encryption(ctx, first.ID)
+		asserts.Nil(err)
+		secondEncryption, err := keys.Encryption(ctx, second.ID)
+		asserts.Nil(err)
+
+		encrypted, err := firstEncryption.EncryptString("value")
+		asserts.Nil(err)
+
+		_, err = secondEncryption.DecryptString(encrypted)
+		asserts.NotNil(err)
+
+		decrypted, err := firstEncryption.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("value", decrypted)
+	})
+
+	t.Run("KeyIsSharedBetweenKeyRings", func(t *testing.T) {
+		asserts := require.New(t)
+		encryption, err := keys.Encryption(ctx, first.ID)
+		asserts.Nil(err)
+
+		other, err := NewKeyRing(master, storage, services.DefaultAlgorithm).Encryption(ctx, first.ID)
+		asserts.Nil(err)
+
+		encrypted, err := encryption.EncryptString("value")
+		asserts.Nil(err)
+
+		decrypted, err := other.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("value", decrypted)
+	})
+
+	t.Run("SetIfEmptyKeepsExistingKey", func(t *testing.T) {
+		asserts := require.New(t)
+		existing, err := storage.Get(ctx, first.ID)
+		asserts.Nil(err)
+
+		stored, err := storage.SetIfEmpty(ctx, first.ID, []byte("other"))
+		asserts.Nil(err)
+		asserts.Equal(existing, stored)
+	})
+
+	t.Run("LegacyValuesAreDecrypted", func(t *testing.T) {
+		asserts := require.New(t)
+		legacy, err := master.EncryptString("legacy")
+		asserts.Nil(err)
+
+		encryption, err := keys.Encryption(ctx, second.ID)
+		asserts.Nil(err)
+
+		decrypted, err := encryption.DecryptString(legacy)
+		asserts.Nil(err)
+		asserts.Equal("legacy", decrypted)
+	})
+
+	t.Run("WrappedKeyIsNotDecryptedAsValue", func(t *testing.T) {
+		asserts := require.New(t)
+		firstEncryption, err := keys.Encryption(ctx, first.ID)
+		asserts.Nil(err)
+		secondEncryption, err := keys.Encryption(ctx, second.ID)
+		asserts.Nil(err)
+
+		wrapped, err := storage.Get(ctx, second.ID)
+		asserts.Nil(err)
+
+		for _, encryption := range []services.Encryption{firstEncryption, secondEncryption} {
+			_, err = encryption.Decrypt(nil, wrapped)
+			asserts.NotNil(err)
+			_, err = encryption.DecryptWithAD(nil, wrapped, []byte("vaulguard:secret:1:production:API_KEY"))
+			asserts.NotNil(err)
+		}
+	})
+
+	t.Run("DataKeyValuesAreNotOpenedWithMaster", func(t *testing.T) {
+		asserts := require.New(t)
+		encryption, err := keys.Encryption(ctx, first.ID)
+		asserts.Nil(err)
+
+		encrypted, err := encryption.EncryptString("value")
+		asserts.Nil(err)
+		keyID, ok := services.CiphertextKeyID(encrypted)
+		asserts.True(ok)
+		asserts.Equal(encryption.(applicationEncryption).keyID, keyID)
+
+		// Tampered value sealed with the data key is an error, not a retry with the master key
+		encrypted[len(encrypted)-1] ^= 1
+		_, err = encryption.DecryptString(encrypted)
+		asserts.NotNil(err)
+	})
+
+	t.Run("RewrapWithRotatedMaster", func(t *testing.T) {
+		asserts := require.New(t)
+		encryption, err := keys.Encryption(ctx, first.ID)
+		asserts.Nil(err)
+		encrypted, err := encryption.EncryptString("value")
+		asserts.Nil(err)
+
+		newKey := make([]byte, services.SecretKeyLength)
+		_, _ = rand.Read(newKey)
+		rotated, err := services.NewKeyedEncryption(newKey, key)
+		asserts.Nil(err)
+
+		rewrapped, err := NewKeyRing(rotated, storage, services.DefaultAlgorithm).Rewrap(ctx, 1)
+		asserts.Nil(err)
+		asserts.Equal(2, rewrapped)
+
+		newMaster, err := services.NewKeyedEncryption(newKey)
+		asserts.Nil(err)
+		retired, err := NewKeyRing(newMaster, storage, services.DefaultAlgorithm).Encryption(ctx, first.ID)
+		asserts.Nil(err)
+
+		decrypted, err := retired.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("value", decrypted)
+
+		// Rotated back, the rest of the subtests use the original master key
+		_, err = NewKeyRing(mustKeyed(t, key, newKey), storage, services.DefaultAlgorithm).Rewrap(ctx, 1)
+		asserts.Nil(err)
+	})
+
+	t.Run("UnknownApplication", func(t *testing.T) {
+		asserts := require.New(t)
+		_, err := keys.Encryption(ctx, uint(1000))
+		asserts.Equal(gorm.ErrRecordNotFound, err)
+	})
+
+	t.Run("WrongMasterKey", func(t *testing.T) {
+		asserts := require.New(t)
+		other := make([]byte, services.SecretKeyLength)
+		_, _ = rand.Read(other)
+		otherMaster, err := services.NewSecretKeyEncryption(other)
+		asserts.Nil(err)
+
+		_, err = NewKeyRing(otherMaster, storage, services.DefaultAlgorithm).Encryption(ctx, first.ID)
+		asserts.Equal(ErrInvalidDataKey, err)
+	})
+}
+
+func mustKeyed(t *testing.T, current []byte, previous ...[]byte) services.Encryption {
+	encryption, err := services.NewKeyedEncryption(current, previous...)
+	require.Nil(t, err)
+	return encryption
+}
@@ -0,0 +1,162 @@
+package datakey
+
+import (
+	"context"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+type sqlStorage struct {
+	db *gorm.DB
+}
+
+type mongoStorage struct {
+	collection *mongo.Collection
+}
+
+// mongoDataKey - Only the data key of the application document
+type mongoDataKey struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	DataKey []byte             `bson:"DataKey,omitempty"`
+}
+
+// NewSqlStorage - Data keys are stored in the data_key column of the applications table
+func NewSqlStorage(db *gorm.DB) Storage {
+	return sqlStorage{db: db}
+}
+
+// NewMongoStorage - Data keys are stored in the DataKey field of the application documents
+func NewMongoStorage(collection *mongo.Collection) Storage {
+	return mongoStorage{collection: collection}
+}
+
+func (s sqlStorage) Get(ctx context.Context, applicationID interface{}) ([]byte, error) {
+	app := models.Application{}
+
+	if err := s.db.WithContext(ctx).Select("id", "data_key").First(&app, applicationID).Error; err != nil {
+		return nil, err
+	}
+
+	return app.DataKey, nil
+}
+
+func (s sqlStorage) SetIfEmpty(ctx context.Context, applicationID interface{}, wrapped []byte) ([]byte, error) {
+	err := s.db.
+		WithContext(ctx).
+		Model(&models.Application{}).
+		Where(map[string]interface{}{"id": applicationID, "data_key": nil}).
+		Update("data_key", wrapped).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, applicationID)
+}
+
+func (s sqlStorage) Each(ctx context.Context, batchSize int, cb func(map[interface{}][]byte) error) error {
+	results := make([]models.Application, 0, batchSize)
+
+	return s.db.
+		WithContext(ctx).
+		Select("id", "data_key").
+		Where("data_key IS NOT NULL").
+		Order("id").
+		FindInBatches(&results, batchSize, func(tx *gorm.DB, batch int) error {
+			keys := make(map[interface{}][]byte, len(results))
+			for _, result := range results {
+				keys[result.ID] = result.DataKey
+			}
+			results = results[:0]
+			return cb(keys)
+		}).Error
+}
+
+func (s sqlStorage) Replace(ctx context.Context, applicationID interface{}, old, wrapped []byte) error {
+	return s.db.
+		WithContext(ctx).
+		Model(&models.Application{}).
+		Where("id = ? AND data_key = ?", applicationID, old).
+		Update("data_key", wrapped).Error
+}
+
+func (m mongoStorage) Get(ctx context.Context, applicationID interface{}) ([]byte, error) {
+	var app mongoDataKey
+
+	findOptions := options.FindOne().SetProjection(bson.M{"DataKey": 1})
+
+	if err := m.collection.FindOne(ctx, bson.M{"_id": applicationID}, findOptions).Decode(&app); err != nil {
+		return nil, err
+	}
+
+	return app.DataKey, nil
+}
+
+func (m mongoStorage) SetIfEmpty(ctx context.Context, applicationID interface{}, wrapped []byte) ([]byte, error) {
+	// Null filter matches documents without the field as well
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": applicationID, "DataKey": nil}, bson.M{
+		"$set": bson.M{"DataKey": wrapped},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Get(ctx, applicationID)
+}
+
+func (m mongoStorage) Each(ctx context.Context, batchSize int, cb func(map[interface{}][]byte) error) error {
+	findOptions := options.Find().
+		SetProjection(bson.M{"DataKey": 1}).
+		SetSort(bson.M{"_id": 1}).
+		SetBatchSize(int32(batchSize))
+
+	cursor, err := m.collection.Find(ctx, bson.M{"DataKey": bson.M{"$ne": nil}}, findOptions)
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+	keys := make(map[interface{}][]byte, batchSize)
+
+	for cursor.Next(ctx) {
+		var app mongoDataKey
+
+		if err := cursor.Decode(&app); err != nil {
+			return err
+		}
+
+		keys[app.ID] = app.DataKey
+
+		if len(keys) == batchSize {
+			if err := cb(keys); err != nil {
+				return err
+			}
+			keys = make(map[interface{}][]byte, batchSize)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		return cb(keys)
+	}
+
+	return nil
+}
+
+func (m mongoStorage) Replace(ctx context.Context, applicationID interface{}, old, wrapped []byte) error {
+	_, err := m.collection.UpdateOne(ctx, bson.M{"_id": applicationID, "DataKey": old}, bson.M{
+		"$set": bson.M{"DataKey": wrapped},
+	})
+
+	return err
+}
@@ -5,95 +5,166 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"github.com/BrosSquad/vaulguard/services/locked"
 	"github.com/gofiber/utils"
 	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/nacl/box"
 	"io"
+	"unsafe"
 )
 
 const (
 	SecretKeyLength  = chacha20poly1305.KeySize
 	PublicKeyLength  = 32
 	PrivateKeyLength = 32
+
+	// aeadOverhead - Size of the Poly1305 and GCM tags
+	aeadOverhead = 16
 )
 
 var (
 	ErrNotEnoughBytes = errors.New("not enough bytes read from crypto random source")
 	ErrKeyLength      = errors.New("key has to be 32 bytes long")
+
+	ErrAssociatedDataNotSupported = errors.New("public key encryption does not support associated data")
 )
 
-// Encryption - Interface for encryption and decryption
+// Encryption - Interface for encryption and decryption, WithAD variants authenticate
+// additional data which is not stored in the ciphertext, the same data is required to decrypt it
 type Encryption interface {
 	Encrypt(dst, msg []byte) ([]byte, error)
 	EncryptString(msg string) ([]byte, error)
 	Decrypt(dst, msg []byte) ([]byte, error)
 	DecryptString(msg []byte) (string, error)
+	EncryptWithAD(dst, msg, additionalData []byte) ([]byte, error)
+	EncryptStringWithAD(msg string, additionalData []byte) ([]byte, error)
+	DecryptWithAD(dst, msg, additionalData []byte) ([]byte, error)
+	DecryptStringWithAD(msg, additionalData []byte) (string, error)
 }
 
+// secretKeyEncryption - Key is kept in locked memory, AEAD is created for every operation,
+// so the key is copied into the Go heap only for the duration of the call
 type secretKeyEncryption struct {
-	cipher cipher.AEAD
-	key    []byte
+	algorithm Algorithm
+	id        uint32
+	key       *locked.Buffer
 }
 
-// NewSecretKeyEncryption - Creates new instance of Encryption
+// NewSecretKeyEncryption - Creates new instance of Encryption with the default cipher, key is copied into locked memory
 func NewSecretKeyEncryption(key []byte) (Encryption, error) {
-	c, err := chacha20poly1305.NewX(key)
+	return NewSecretKeyEncryptionWithAlgorithm(key, DefaultAlgorithm)
+}
+
+// NewSecretKeyEncryptionWithAlgorithm - Values are sealed with the algorithm,
+// values sealed with any other secret key algorithm are still opened
+func NewSecretKeyEncryptionWithAlgorithm(key []byte, algorithm Algorithm) (Encryption, error) {
+	if len(key) != SecretKeyLength {
+		return nil, ErrKeyLength
+	}
+
+	if algorithm.NonceSize() <= 0 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	buffer, err := locked.Copy(key)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return secretKeyEncryption{
-		key:    key,
-		cipher: c,
-	}, nil
+	return secretKeyEncryption{algorithm: algorithm, id: KeyID(key), key: buffer}, nil
+}
+
+// newCipher - XChaCha20-Poly1305 with the key from locked memory, fails after the key is destroyed.
+// Legacy values without envelope are always XChaCha20-Poly1305
+func newCipher(key *locked.Buffer) (c cipher.AEAD, err error) {
+	err = key.With(func(k []byte) error {
+		c, err = chacha20poly1305.NewX(k)
+		return err
+	})
+
+	return c, err
+}
+
+func randomNonce(nonce []byte) error {
+	n, err := rand.Read(nonce)
+
+	if err != nil {
+		return err
+	}
+
+	if n != len(nonce) {
+		return errors.New("cannot generate random nonce")
+	}
+
+	return nil
 }
 
 func (s secretKeyEncryption) EncryptString(msg string) ([]byte, error) {
-	capacity := s.cipher.NonceSize() + len(msg) + s.cipher.Overhead()
+	return s.EncryptStringWithAD(msg, nil)
+}
 
-	dst := make([]byte, s.cipher.NonceSize(), capacity)
+func (s secretKeyEncryption) EncryptStringWithAD(msg string, additionalData []byte) ([]byte, error) {
+	prefix := envelopeHeaderLength + s.algorithm.NonceSize()
+	dst := make([]byte, prefix, prefix+len(msg)+aeadOverhead)
 
-	return s.Encrypt(dst, utils.GetBytes(msg))
+	return s.EncryptWithAD(dst, utils.GetBytes(msg), additionalData)
 }
 
 func (s secretKeyEncryption) Encrypt(dst, msg []byte) ([]byte, error) {
-	capacity := s.cipher.NonceSize() + len(msg) + s.cipher.Overhead()
+	return s.EncryptWithAD(dst, msg, nil)
+}
+
+// EncryptWithAD - dst is the space for envelope header and nonce (as prepared by EncryptString),
+// with capacity for the sealed message
+func (s secretKeyEncryption) EncryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	prefix := envelopeHeaderLength + s.algorithm.NonceSize()
+	capacity := prefix + len(msg) + aeadOverhead
 
-	if len(dst) != s.cipher.NonceSize() || cap(dst) != capacity {
+	if len(dst) != prefix || cap(dst) != capacity {
 		return nil, fmt.Errorf("not enough bytes in dst, expected %d, given %d", capacity, cap(dst))
 	}
 
-	n, err := rand.Read(dst)
+	return sealEnvelope(s.algorithm, s.key, s.id, dst[:0], msg, additionalData)
+}
 
-	if err != nil {
-		return nil, err
-	}
+func (s secretKeyEncryption) Decrypt(dst, msg []byte) ([]byte, error) {
+	return s.DecryptWithAD(dst, msg, nil)
+}
 
-	if n != len(dst) {
-		return nil, errors.New("cannot generate random nonce")
-	}
+// DecryptWithAD - Opens the envelope, legacy nonce||sealed values are opened as well
+func (s secretKeyEncryption) DecryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	var envelopeErr error
 
-	return s.cipher.Seal(dst, dst, msg, nil), nil
-}
+	if e, ok := ParseEnvelope(msg); ok {
+		if e.KeyID != s.id {
+			envelopeErr = ErrUnknownKey
+		} else {
+			decrypted, err := openEnvelope(s.key, dst, e, additionalData)
 
-func (s secretKeyEncryption) Decrypt(dst, msg []byte) ([]byte, error) {
-	if len(msg) < s.cipher.NonceSize() {
-		return nil, errors.New("size of message is less than nonce size")
+			if err == nil || errors.Is(err, locked.ErrDestroyed) {
+				return decrypted, err
+			}
+
+			envelopeErr = err
+		}
 	}
-	nonce, ciphertext := msg[:s.cipher.NonceSize()], msg[s.cipher.NonceSize():]
 
-	decrypted, err := s.cipher.Open(dst, nonce, ciphertext, nil)
+	decrypted, err := open(s.key, dst, msg, additionalData)
 
-	if err != nil {
-		return nil, err
+	if err != nil && envelopeErr != nil {
+		return nil, envelopeErr
 	}
 
-	return decrypted, nil
+	return decrypted, err
 }
 
 func (s secretKeyEncryption) DecryptString(msg []byte) (string, error) {
-	message, err := s.Decrypt(nil, msg)
+	return s.DecryptStringWithAD(msg, nil)
+}
+
+func (s secretKeyEncryption) DecryptStringWithAD(msg, additionalData []byte) (string, error) {
+	message, err := s.DecryptWithAD(nil, msg, additionalData)
 
 	if err != nil {
 		return "", err
@@ -117,47 +188,104 @@ func readKey(out []byte, r io.Reader) error {
 
 func NewPublicKeyEncryption(publicKey, privateKey io.Reader) (Encryption, error) {
 	var publicKeyBytes [32]byte
-	var privateKeyBytes [32]byte
 
 	if err := readKey(publicKeyBytes[:], publicKey); err != nil {
 		return nil, err
 	}
 
-	if err := readKey(privateKeyBytes[:], privateKey); err != nil {
+	// Private key is read straight into locked memory
+	privateKeyBuffer, err := locked.New(PrivateKeyLength)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readKey(privateKeyBuffer.Bytes(), privateKey); err != nil {
+		_ = privateKeyBuffer.Destroy()
 		return nil, err
 	}
 
 	return publicKeyEncryption{
-		privateKey: &privateKeyBytes,
+		id:         KeyID(publicKeyBytes[:]),
+		privateKey: privateKeyBuffer,
 		publicKey:  &publicKeyBytes,
 	}, nil
 }
 
+// publicKeyEncryption - Sealed boxes in an envelope, key ID is the fingerprint of the public key
 type publicKeyEncryption struct {
-	privateKey *[32]byte
+	id         uint32
+	privateKey *locked.Buffer
 	publicKey  *[32]byte
 }
 
+// Encrypt - Appends envelope with the sealed box to dst
 func (p publicKeyEncryption) Encrypt(dst, msg []byte) ([]byte, error) {
+	dst = appendEnvelopeHeader(dst, AlgorithmSealedBox, false, p.id)
+
 	return box.SealAnonymous(dst, msg, p.publicKey, rand.Reader)
 }
 
+// EncryptWithAD - Sealed box has no additional data, public key encryption only wraps keys
+func (p publicKeyEncryption) EncryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	if additionalData != nil {
+		return nil, ErrAssociatedDataNotSupported
+	}
+
+	return p.Encrypt(dst, msg)
+}
+
 func (p publicKeyEncryption) EncryptString(msg string) ([]byte, error) {
 	return p.Encrypt(nil, utils.GetBytes(msg))
 }
 
+func (p publicKeyEncryption) EncryptStringWithAD(msg string, additionalData []byte) ([]byte, error) {
+	return p.EncryptWithAD(nil, utils.GetBytes(msg), additionalData)
+}
+
+// Decrypt - Opens the envelope, legacy values are bare sealed boxes
 func (p publicKeyEncryption) Decrypt(dst, msg []byte) ([]byte, error) {
-	message, ok := box.OpenAnonymous(dst, msg, p.publicKey, p.privateKey)
+	if e, ok := ParseEnvelope(msg); ok && e.Algorithm == AlgorithmSealedBox && e.KeyID == p.id {
+		if message, err := p.open(dst, e.Payload); err == nil || errors.Is(err, locked.ErrDestroyed) {
+			return message, err
+		}
+	}
+
+	return p.open(dst, msg)
+}
+
+func (p publicKeyEncryption) open(dst, msg []byte) ([]byte, error) {
+	var message []byte
 
-	if !ok {
-		return nil, errors.New("decryption failed")
+	err := p.privateKey.With(func(privateKey []byte) error {
+		var ok bool
+		// Array pointer into locked memory, private key is not copied
+		message, ok = box.OpenAnonymous(dst, msg, p.publicKey, (*[PrivateKeyLength]byte)(unsafe.Pointer(&privateKey[0])))
+
+		if !ok {
+			return errors.New("decryption failed")
+		}
+
+		return nil
+	})
+
+	return message, err
+}
+
+func (p publicKeyEncryption) DecryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	if additionalData != nil {
+		return nil, ErrAssociatedDataNotSupported
 	}
 
-	return message, nil
+	return p.Decrypt(dst, msg)
 }
 
 func (p publicKeyEncryption) DecryptString(msg []byte) (string, error) {
-	message, err := p.Decrypt(nil, msg)
+	return p.DecryptStringWithAD(msg, nil)
+}
+
+func (p publicKeyEncryption) DecryptStringWithAD(msg, additionalData []byte) (string, error) {
+	message, err := p.DecryptWithAD(nil, msg, additionalData)
 
 	if err != nil {
 		return "", err
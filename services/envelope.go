@@ -0,0 +1,250 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Envelope format written by every Encryption:
+//
+//	magic "VE" | version (1 byte) | algorithm (1 byte) | flags (1 byte) | key ID (4 bytes, big endian) | nonce | payload
+//
+// Nonce length depends on the algorithm. AEAD algorithms authenticate the header together with
+// the additional data, so algorithm, flags and key ID cannot be swapped without failing decryption
+const (
+	// EnvelopeVersion - Version of the envelope written by this build
+	EnvelopeVersion = 1
+
+	// envelopeBound - Flag of values sealed with additional data
+	envelopeBound = 1 << 0
+
+	envelopeHeaderLength = len(envelopeMagic) + 3 + KeyIDLength
+)
+
+// envelopeMagic - Prefix of versioned ciphertexts, values without it are legacy formats
+var envelopeMagic = [...]byte{'V', 'E'}
+
+// Algorithm - Cipher which sealed the payload of the envelope
+type Algorithm uint8
+
+const (
+	// AlgorithmXChaCha20Poly1305 - Secret key encryption with random 24 byte nonces
+	AlgorithmXChaCha20Poly1305 Algorithm = 1
+	// AlgorithmSealedBox - Anonymous NaCl box (X25519, XSalsa20-Poly1305), nonce is derived from the ephemeral key
+	AlgorithmSealedBox Algorithm = 2
+	// AlgorithmAES256GCM - AES-256-GCM with random 24 byte nonces, first half of the nonce derives
+	// the key of the value (HKDF-SHA256) and the second half is the GCM nonce. Random 12 byte
+	// GCM nonces under one key are safe only for about 2^32 values, derived keys remove the limit
+	AlgorithmAES256GCM Algorithm = 3
+
+	// DefaultAlgorithm - Secret key encryption cipher used when none is configured
+	DefaultAlgorithm = AlgorithmXChaCha20Poly1305
+
+	aesGCMDerivationLength = 12
+	aesGCMNonceLength      = 12
+)
+
+var ErrUnsupportedAlgorithm = errors.New("value is encrypted with unsupported algorithm")
+
+// ParseAlgorithm - Secret key encryption cipher by its name (xchacha20-poly1305 or aes-256-gcm)
+func ParseAlgorithm(name string) (Algorithm, error) {
+	for _, algorithm := range []Algorithm{AlgorithmXChaCha20Poly1305, AlgorithmAES256GCM} {
+		if algorithm.String() == name {
+			return algorithm, nil
+		}
+	}
+
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// NonceSize - Bytes of the nonce stored in the envelope, -1 for unknown algorithms
+func (a Algorithm) NonceSize() int {
+	switch a {
+	case AlgorithmXChaCha20Poly1305:
+		return chacha20poly1305.NonceSizeX
+	case AlgorithmSealedBox:
+		return 0
+	case AlgorithmAES256GCM:
+		return aesGCMDerivationLength + aesGCMNonceLength
+	default:
+		return -1
+	}
+}
+
+func (a Algorithm) String() string {
+	switch a {
+	case AlgorithmXChaCha20Poly1305:
+		return "xchacha20-poly1305"
+	case AlgorithmSealedBox:
+		return "sealed-box"
+	case AlgorithmAES256GCM:
+		return "aes-256-gcm"
+	default:
+		return "unknown"
+	}
+}
+
+// Envelope - Parsed ciphertext, slices point into the parsed value
+type Envelope struct {
+	Version   uint8
+	Algorithm Algorithm
+	// Bound - Value was sealed with additional data, it never opens without the same data
+	Bound   bool
+	KeyID   uint32
+	Nonce   []byte
+	Payload []byte
+	// header - Magic, version, algorithm and key ID as stored
+	header []byte
+}
+
+// ParseEnvelope - Splits the value into envelope fields, false for legacy values written before the envelope.
+// Legacy nonce which happens to start with the magic can be parsed as well, callers fall back to the legacy format
+func ParseEnvelope(msg []byte) (Envelope, bool) {
+	if len(msg) < envelopeHeaderLength || msg[0] != envelopeMagic[0] || msg[1] != envelopeMagic[1] {
+		return Envelope{}, false
+	}
+
+	flags := msg[len(envelopeMagic)+2]
+	e := Envelope{
+		Version:   msg[len(envelopeMagic)],
+		Algorithm: Algorithm(msg[len(envelopeMagic)+1]),
+		Bound:     flags&envelopeBound != 0,
+		KeyID:     binary.BigEndian.Uint32(msg[len(envelopeMagic)+3 : envelopeHeaderLength]),
+		header:    msg[:envelopeHeaderLength],
+	}
+
+	nonceSize := e.Algorithm.NonceSize()
+
+	if e.Version != EnvelopeVersion || flags&^envelopeBound != 0 || nonceSize < 0 || len(msg) < envelopeHeaderLength+nonceSize {
+		return Envelope{}, false
+	}
+
+	e.Nonce = msg[envelopeHeaderLength : envelopeHeaderLength+nonceSize]
+	e.Payload = msg[envelopeHeaderLength+nonceSize:]
+
+	return e, true
+}
+
+// IsBound - Reports whether the value was sealed with additional data. Flag is authenticated,
+// so bound value cannot be passed off as unbound one and opened without its additional data
+func IsBound(msg []byte) bool {
+	e, ok := ParseEnvelope(msg)
+
+	return ok && e.Bound
+}
+
+// associatedData - Header of the envelope followed by the caller's additional data
+func (e Envelope) associatedData(additionalData []byte) []byte {
+	return envelopeAssociatedData(e.header, additionalData)
+}
+
+func envelopeAssociatedData(header, additionalData []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(additionalData))
+	ad = append(ad, header...)
+
+	return append(ad, additionalData...)
+}
+
+// appendEnvelopeHeader - Appends magic, version, algorithm, flags and key ID to dst
+func appendEnvelopeHeader(dst []byte, algorithm Algorithm, bound bool, keyID uint32) []byte {
+	var flags byte
+
+	if bound {
+		flags |= envelopeBound
+	}
+
+	dst = append(dst, envelopeMagic[:]...)
+	dst = append(dst, EnvelopeVersion, byte(algorithm), flags)
+	dst = append(dst, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(dst[len(dst)-KeyIDLength:], keyID)
+
+	return dst
+}
+
+// newAEAD - Cipher of the algorithm for the value with the nonce from the envelope,
+// returned nonce is the part of it the cipher expects
+func newAEAD(algorithm Algorithm, key *locked.Buffer, nonce []byte) (cipher.AEAD, []byte, error) {
+	switch algorithm {
+	case AlgorithmXChaCha20Poly1305:
+		c, err := newCipher(key)
+		return c, nonce, err
+	case AlgorithmAES256GCM:
+		c, err := newAESGCM(key, nonce[:aesGCMDerivationLength])
+		return c, nonce[aesGCMDerivationLength:], err
+	default:
+		return nil, nil, ErrUnsupportedAlgorithm
+	}
+}
+
+// newAESGCM - AES-256-GCM with the key of the value derived from the secret key and the nonce
+func newAESGCM(key *locked.Buffer, derivation []byte) (c cipher.AEAD, err error) {
+	err = key.With(func(k []byte) error {
+		derived := make([]byte, SecretKeyLength)
+		defer locked.Wipe(derived)
+
+		info := append([]byte("vaulguard aes-256-gcm"), derivation...)
+
+		if _, err := io.ReadFull(hkdf.New(sha256.New, k, nil, info), derived); err != nil {
+			return err
+		}
+
+		block, err := aes.NewCipher(derived)
+
+		if err != nil {
+			return err
+		}
+
+		c, err = cipher.NewGCM(block)
+		return err
+	})
+
+	return c, err
+}
+
+// sealEnvelope - Appends envelope with the value sealed by the secret key to dst
+func sealEnvelope(algorithm Algorithm, key *locked.Buffer, keyID uint32, dst, msg, additionalData []byte) ([]byte, error) {
+	nonceSize := algorithm.NonceSize()
+
+	if nonceSize <= 0 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	start := len(dst)
+	dst = appendEnvelopeHeader(dst, algorithm, len(additionalData) > 0, keyID)
+	dst = append(dst, make([]byte, nonceSize)...)
+
+	nonce := dst[start+envelopeHeaderLength:]
+
+	if err := randomNonce(nonce); err != nil {
+		return nil, err
+	}
+
+	c, cipherNonce, err := newAEAD(algorithm, key, nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ad := envelopeAssociatedData(dst[start:start+envelopeHeaderLength], additionalData)
+
+	return c.Seal(dst, cipherNonce, msg, ad), nil
+}
+
+// openEnvelope - Opens envelope sealed by the secret key, cipher is chosen by the algorithm in the envelope
+func openEnvelope(key *locked.Buffer, dst []byte, e Envelope, additionalData []byte) ([]byte, error) {
+	c, nonce, err := newAEAD(e.Algorithm, key, e.Nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Open(dst, nonce, e.Payload, e.associatedData(additionalData))
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func legacySeal(t *testing.T, key, msg, additionalData []byte) []byte {
+	c, err := chacha20poly1305.NewX(key)
+	require.Nil(t, err)
+
+	nonce := make([]byte, c.NonceSize())
+	_, err = rand.Read(nonce)
+	require.Nil(t, err)
+
+	return c.Seal(nonce, nonce, msg, additionalData)
+}
+
+func TestEnvelope(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	key := randomKey(t)
+
+	secretKey, err := NewSecretKeyEncryption(key)
+	asserts.Nil(err)
+
+	keyed, err := NewKeyedEncryption(key)
+	asserts.Nil(err)
+
+	secretKeyAES, err := NewSecretKeyEncryptionWithAlgorithm(key, AlgorithmAES256GCM)
+	asserts.Nil(err)
+
+	keyedAES, err := NewKeyedEncryptionWithAlgorithm(AlgorithmAES256GCM, key)
+	asserts.Nil(err)
+
+	public, private, err := box.GenerateKey(rand.Reader)
+	asserts.Nil(err)
+
+	publicKey, err := NewPublicKeyEncryption(bytes.NewReader(public[:]), bytes.NewReader(private[:]))
+	asserts.Nil(err)
+
+	t.Run("Header", func(t *testing.T) {
+		asserts := require.New(t)
+		implementations := map[string]struct {
+			encryption Encryption
+			algorithm  Algorithm
+			keyID      uint32
+		}{
+			"SecretKey":    {secretKey, AlgorithmXChaCha20Poly1305, KeyID(key)},
+			"Keyed":        {keyed, AlgorithmXChaCha20Poly1305, KeyID(key)},
+			"PublicKey":    {publicKey, AlgorithmSealedBox, KeyID(public[:])},
+			"SecretKeyAES": {secretKeyAES, AlgorithmAES256GCM, KeyID(key)},
+			"KeyedAES":     {keyedAES, AlgorithmAES256GCM, KeyID(key)},
+		}
+
+		for name, implementation := range implementations {
+			encrypted, err := implementation.encryption.EncryptString("Hello World")
+			asserts.Nil(err, name)
+
+			e, ok := ParseEnvelope(encrypted)
+			asserts.True(ok, name)
+			asserts.Equal(uint8(EnvelopeVersion), e.Version, name)
+			asserts.Equal(implementation.algorithm, e.Algorithm, name)
+			asserts.Equal(implementation.keyID, e.KeyID, name)
+			asserts.Len(e.Nonce, implementation.algorithm.NonceSize(), name)
+
+			decrypted, err := implementation.encryption.DecryptString(encrypted)
+			asserts.Nil(err, name)
+			asserts.Equal("Hello World", decrypted, name)
+		}
+	})
+
+	t.Run("CiphersCoexist", func(t *testing.T) {
+		asserts := require.New(t)
+		implementations := []Encryption{secretKey, keyed, secretKeyAES, keyedAES}
+
+		for _, encryption := range implementations {
+			encrypted, err := encryption.EncryptStringWithAD("Hello World", []byte("application:key"))
+			asserts.Nil(err)
+
+			for _, other := range implementations {
+				decrypted, err := other.DecryptStringWithAD(encrypted, []byte("application:key"))
+				asserts.Nil(err)
+				asserts.Equal("Hello World", decrypted)
+			}
+		}
+	})
+
+	t.Run("AlgorithmIsAuthenticated", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := keyedAES.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		encrypted[len(envelopeMagic)+1] = byte(AlgorithmXChaCha20Poly1305)
+
+		_, err = keyed.DecryptString(encrypted)
+		asserts.NotNil(err)
+	})
+
+	t.Run("ParseAlgorithm", func(t *testing.T) {
+		asserts := require.New(t)
+		algorithm, err := ParseAlgorithm("aes-256-gcm")
+		asserts.Nil(err)
+		asserts.Equal(AlgorithmAES256GCM, algorithm)
+
+		_, err = ParseAlgorithm("sealed-box")
+		asserts.Equal(ErrUnsupportedAlgorithm, err)
+
+		_, err = NewSecretKeyEncryptionWithAlgorithm(key, AlgorithmSealedBox)
+		asserts.Equal(ErrUnsupportedAlgorithm, err)
+	})
+
+	t.Run("HeaderIsAuthenticated", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := secretKey.EncryptStringWithAD("Hello World", []byte("application:key"))
+		asserts.Nil(err)
+
+		encrypted[len(envelopeMagic)] = EnvelopeVersion + 1
+
+		_, err = secretKey.DecryptStringWithAD(encrypted, []byte("application:key"))
+		asserts.NotNil(err)
+	})
+
+	t.Run("BoundFlag", func(t *testing.T) {
+		asserts := require.New(t)
+		bound, err := keyed.EncryptStringWithAD("Hello World", []byte("application:key"))
+		asserts.Nil(err)
+
+		unbound, err := keyed.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		asserts.True(IsBound(bound))
+		asserts.False(IsBound(unbound))
+
+		// Clearing the flag must not turn a bound value into one readable without associated data
+		bound[len(envelopeMagic)+2] = 0
+		asserts.False(IsBound(bound))
+
+		_, err = keyed.DecryptString(bound)
+		asserts.NotNil(err)
+		_, err = keyed.DecryptStringWithAD(bound, []byte("application:key"))
+		asserts.NotNil(err)
+	})
+
+	t.Run("LegacyNonceAndSealed", func(t *testing.T) {
+		asserts := require.New(t)
+		legacy := legacySeal(t, key, []byte("Hello World"), []byte("application:key"))
+
+		for _, encryption := range []Encryption{secretKey, keyed} {
+			decrypted, err := encryption.DecryptStringWithAD(legacy, []byte("application:key"))
+			asserts.Nil(err)
+			asserts.Equal("Hello World", decrypted)
+		}
+	})
+
+	t.Run("LegacySealedBox", func(t *testing.T) {
+		asserts := require.New(t)
+		legacy, err := box.SealAnonymous(nil, []byte("Hello World"), public, rand.Reader)
+		asserts.Nil(err)
+
+		decrypted, err := publicKey.DecryptString(legacy)
+		asserts.Nil(err)
+		asserts.Equal("Hello World", decrypted)
+	})
+
+	t.Run("OtherKey", func(t *testing.T) {
+		asserts := require.New(t)
+		other, err := NewSecretKeyEncryption(randomKey(t))
+		asserts.Nil(err)
+
+		encrypted, err := other.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		_, err = secretKey.DecryptString(encrypted)
+		asserts.Equal(ErrUnknownKey, err)
+	})
+}
@@ -1,5 +1,34 @@
 package services
 
-import "errors"
+import (
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
 
 var ErrAlreadyExists = errors.New("model already exists")
+
+// IsDuplicateKeyError - Reports whether MongoDB rejected the write because of an unique index
+func IsDuplicateKeyError(err error) bool {
+	var writeException mongo.WriteException
+
+	if errors.As(err, &writeException) {
+		for _, e := range writeException.WriteErrors {
+			if e.Code == 11000 {
+				return true
+			}
+		}
+	}
+
+	var commandError mongo.CommandError
+
+	return errors.As(err, &commandError) && commandError.Code == 11000
+}
+
+// IsTransactionNotSupportedError - Reports whether MongoDB rejected the transaction because it is a standalone server
+func IsTransactionNotSupportedError(err error) bool {
+	var commandError mongo.CommandError
+
+	return errors.As(err, &commandError) && commandError.Code == 20 && strings.Contains(commandError.Message, "Transaction numbers")
+}
@@ -0,0 +1,111 @@
+package invalidation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultChannel - Redis channel and Postgres notification channel used when none is configured
+const DefaultChannel = "vaulguard_invalidation"
+
+// Kind - What changed, determines which cache entries other processes drop
+type Kind string
+
+const (
+	// KindSecrets - Keys of the application environment changed, no keys means whole application
+	KindSecrets Kind = "secrets"
+	// KindToken - Token was revoked or deleted
+	KindToken Kind = "token"
+	// KindApplication - Application was deleted or changed, all of its secrets and tokens are dropped
+	KindApplication Kind = "application"
+	// KindPurge - Delivered locally when events could have been missed (bus reconnected)
+	KindPurge Kind = "purge"
+)
+
+var (
+	ErrProviderNotSupported = errors.New("invalidation provider not supported (local, redis, postgres)")
+	ErrInvalidID            = errors.New("invalidation event contains invalid ID")
+)
+
+// Event - Cache change broadcast to every worker, IDs are encoded as strings
+// so SQL (uint) and MongoDB (ObjectID) IDs survive the JSON round trip
+type Event struct {
+	Kind        Kind     `json:"kind"`
+	Origin      string   `json:"origin"`
+	Application string   `json:"application,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	Keys        []string `json:"keys,omitempty"`
+	Token       string   `json:"token,omitempty"`
+}
+
+// Bus - Delivers invalidation events to all processes, including the publisher
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+	// Listen - Blocks and calls handler for every event until ctx is done
+	Listen(ctx context.Context, handler func(Event)) error
+	Close() error
+}
+
+// FormatID - Encodes application or token ID for the event
+func FormatID(id interface{}) string {
+	switch v := id.(type) {
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case primitive.ObjectID:
+		return "oid:" + v.Hex()
+	}
+
+	return ""
+}
+
+// ParseID - Decodes ID encoded by FormatID into the type used as cache key
+func ParseID(id string) (interface{}, error) {
+	if len(id) > 4 && id[:4] == "oid:" {
+		objectID, err := primitive.ObjectIDFromHex(id[4:])
+
+		if err != nil {
+			return nil, ErrInvalidID
+		}
+
+		return objectID, nil
+	}
+
+	sqlID, err := strconv.ParseUint(id, 10, 64)
+
+	if err != nil {
+		return nil, ErrInvalidID
+	}
+
+	return uint(sqlID), nil
+}
+
+func encode(event Event) (string, error) {
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func decode(payload string) (Event, error) {
+	var event Event
+	err := json.Unmarshal([]byte(payload), &event)
+	return event, err
+}
+
+// newOrigin - Random ID of this process, events published by it are not applied twice
+func newOrigin() string {
+	data := make([]byte, 8)
+	_, _ = rand.Read(data)
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,152 @@
+package invalidation
+
+import (
+	"context"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/token"
+)
+
+// publishTimeout - Invalidation is published while the request is handled, slow bus must not block it forever
+const publishTimeout = 5 * time.Second
+
+// Caches - In-process caches kept consistent across processes, nil cache is ignored
+type Caches struct {
+	Tokens  *token.Cache
+	Secrets *secret.Cache
+	// Keys - Unwrapped data key is dropped when the application changes, so deleted application leaves nothing behind
+	Keys *datakey.KeyRing
+}
+
+// Invalidator - Publishes invalidations made by this process and applies the ones made by others
+type Invalidator struct {
+	bus     Bus
+	origin  string
+	caches  Caches
+	onError func(error)
+}
+
+// NewInvalidator - Hooks into the caches, every local invalidation is published on the bus.
+// Errors are reported to onError, cache ttl bounds the staleness when bus is unavailable
+func NewInvalidator(bus Bus, caches Caches, onError func(error)) *Invalidator {
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	i := &Invalidator{
+		bus:     bus,
+		origin:  newOrigin(),
+		caches:  caches,
+		onError: onError,
+	}
+
+	if caches.Secrets != nil {
+		caches.Secrets.OnInvalidate(func(applicationID interface{}, environment string, keys []string) {
+			i.publish(Event{
+				Kind:        KindSecrets,
+				Application: FormatID(applicationID),
+				Environment: environment,
+				Keys:        keys,
+			})
+		})
+	}
+
+	if caches.Tokens != nil {
+		caches.Tokens.OnInvalidate(func(id interface{}) {
+			i.publish(Event{Kind: KindToken, Token: FormatID(id)})
+		})
+	}
+
+	return i
+}
+
+// ApplicationChanged - Drops all secrets, tokens and the data key of the application in every process
+func (i *Invalidator) ApplicationChanged(applicationID interface{}) {
+	event := Event{Kind: KindApplication, Application: FormatID(applicationID)}
+	i.apply(event)
+	i.publish(event)
+}
+
+// Run - Applies events published by other processes until ctx is done
+func (i *Invalidator) Run(ctx context.Context) error {
+	return i.bus.Listen(ctx, func(event Event) {
+		if event.Origin == i.origin {
+			return
+		}
+
+		i.apply(event)
+	})
+}
+
+func (i *Invalidator) publish(event Event) {
+	event.Origin = i.origin
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if err := i.bus.Publish(ctx, event); err != nil {
+		i.onError(err)
+	}
+}
+
+func (i *Invalidator) apply(event Event) {
+	if event.Kind == KindPurge {
+		if i.caches.Secrets != nil {
+			i.caches.Secrets.Purge()
+		}
+
+		if i.caches.Tokens != nil {
+			i.caches.Tokens.Purge()
+		}
+
+		return
+	}
+
+	if event.Kind == KindToken {
+		id, err := ParseID(event.Token)
+
+		if err != nil {
+			i.onError(err)
+			return
+		}
+
+		if i.caches.Tokens != nil {
+			i.caches.Tokens.Evict(id)
+		}
+
+		return
+	}
+
+	applicationID, err := ParseID(event.Application)
+
+	if err != nil {
+		i.onError(err)
+		return
+	}
+
+	switch event.Kind {
+	case KindSecrets:
+		if i.caches.Secrets == nil {
+			return
+		}
+
+		if event.Environment == "" {
+			i.caches.Secrets.EvictApplication(applicationID)
+		} else {
+			i.caches.Secrets.Evict(applicationID, event.Environment, event.Keys...)
+		}
+	case KindApplication:
+		if i.caches.Secrets != nil {
+			i.caches.Secrets.EvictApplication(applicationID)
+		}
+
+		if i.caches.Tokens != nil {
+			i.caches.Tokens.InvalidateApplication(applicationID)
+		}
+
+		if i.caches.Keys != nil {
+			i.caches.Keys.Forget(applicationID)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package invalidation
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services/secret"
+	"github.com/BrosSquad/vaulguard/services/token"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type worker struct {
+	caches      Caches
+	invalidator *Invalidator
+}
+
+func newWorker(ctx context.Context, bus Bus) worker {
+	caches := Caches{
+		Tokens:  token.NewCache(10, time.Minute),
+		Secrets: secret.NewCache(secret.CacheConfig{}),
+	}
+
+	invalidator := NewInvalidator(bus, caches, nil)
+	go invalidator.Run(ctx)
+
+	return worker{caches: caches, invalidator: invalidator}
+}
+
+func secretDto(key string) models.SecretDto {
+	return models.SecretDto{Key: key, Environment: secret.DefaultEnvironment, Value: []byte("value")}
+}
+
+// testInvalidation - Change made in the first worker has to evict the cache of the second one,
+// change is repeated until the listener of the second worker is subscribed
+func testInvalidation(t *testing.T, first, second Bus) {
+	asserts := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := newWorker(ctx, first)
+	b := newWorker(ctx, second)
+	applicationID := uint(1)
+	objectID := primitive.NewObjectID()
+
+	t.Run("Secrets", func(t *testing.T) {
+		asserts.Eventually(func() bool {
+			b.caches.Secrets.Set(applicationID, secretDto("A"))
+			a.caches.Secrets.Remove(applicationID, secret.DefaultEnvironment, "A")
+			time.Sleep(10 * time.Millisecond)
+			_, ok := b.caches.Secrets.Get(applicationID, secret.DefaultEnvironment, "A")
+			return !ok
+		}, 5*time.Second, 50*time.Millisecond)
+
+		b.caches.Secrets.Set(objectID, secretDto("A"), secretDto("B"))
+		a.caches.Secrets.InvalidateApplication(objectID)
+		asserts.Eventually(func() bool {
+			return b.caches.Secrets.Stats().Entries == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Tokens", func(t *testing.T) {
+		b.caches.Tokens.Set(uint(5), models.TokenDto{ID: uint(5), ApplicationId: applicationID})
+		a.caches.Tokens.Invalidate(uint(5))
+		asserts.Eventually(func() bool {
+			_, ok := b.caches.Tokens.Get(uint(5))
+			return !ok
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Application", func(t *testing.T) {
+		b.caches.Tokens.Set(uint(6), models.TokenDto{ID: uint(6), ApplicationId: applicationID})
+		b.caches.Secrets.Set(applicationID, secretDto("C"))
+		a.caches.Secrets.Set(applicationID, secretDto("C"))
+		a.invalidator.ApplicationChanged(applicationID)
+
+		_, ok := a.caches.Secrets.Get(applicationID, secret.DefaultEnvironment, "C")
+		asserts.False(ok)
+
+		asserts.Eventually(func() bool {
+			_, tokenCached := b.caches.Tokens.Get(uint(6))
+			_, secretCached := b.caches.Secrets.Get(applicationID, secret.DefaultEnvironment, "C")
+			return !tokenCached && !secretCached
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("OwnEventsAreIgnored", func(t *testing.T) {
+		a.caches.Secrets.Set(applicationID, secretDto("D"))
+		a.caches.Secrets.Remove(applicationID, secret.DefaultEnvironment, "E")
+		time.Sleep(50 * time.Millisecond)
+
+		_, ok := a.caches.Secrets.Get(applicationID, secret.DefaultEnvironment, "D")
+		asserts.True(ok)
+	})
+}
+
+func TestLocalInvalidation(t *testing.T) {
+	t.Parallel()
+	bus := NewLocal()
+	testInvalidation(t, bus, bus)
+}
+
+func TestRedisInvalidation(t *testing.T) {
+	t.Parallel()
+	addr := os.Getenv("VAULGUARD_REDIS_TESTING")
+
+	if addr == "" {
+		t.Skip("VAULGUARD_REDIS_TESTING is not set")
+	}
+
+	config := RedisConfig{Addr: addr, Channel: "vaulguard_invalidation_test"}
+	first, second := NewRedis(config), NewRedis(config)
+	defer first.Close()
+	defer second.Close()
+
+	testInvalidation(t, first, second)
+}
+
+func TestPostgresInvalidation(t *testing.T) {
+	t.Parallel()
+	dsn := os.Getenv("VAULGUARD_POSTGRES_TESTING")
+
+	if dsn == "" {
+		t.Skip("VAULGUARD_POSTGRES_TESTING is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.Nil(t, err)
+
+	config := PostgresConfig{DB: db, DSN: dsn, Channel: "vaulguard_invalidation_test"}
+	testInvalidation(t, NewPostgres(config), NewPostgres(config))
+}
+
+func TestFormatAndParseID(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	objectID := primitive.NewObjectID()
+
+	for _, id := range []interface{}{uint(42), objectID} {
+		parsed, err := ParseID(FormatID(id))
+		asserts.Nil(err)
+		asserts.Equal(id, parsed)
+	}
+
+	_, err := ParseID("oid:invalid")
+	asserts.Equal(ErrInvalidID, err)
+
+	_, err = ParseID("")
+	asserts.Equal(ErrInvalidID, err)
+}
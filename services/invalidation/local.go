@@ -0,0 +1,51 @@
+package invalidation
+
+import (
+	"context"
+	"sync"
+)
+
+// local - In-process bus, used when VaulGuard runs as a single process (no prefork)
+// and there is nobody else to notify
+type local struct {
+	mutex    sync.RWMutex
+	handlers map[int]func(Event)
+	nextID   int
+}
+
+func NewLocal() Bus {
+	return &local{
+		handlers: make(map[int]func(Event)),
+	}
+}
+
+func (l *local) Publish(_ context.Context, event Event) error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	for _, handler := range l.handlers {
+		handler(event)
+	}
+
+	return nil
+}
+
+func (l *local) Listen(ctx context.Context, handler func(Event)) error {
+	l.mutex.Lock()
+	id := l.nextID
+	l.nextID++
+	l.handlers[id] = handler
+	l.mutex.Unlock()
+
+	<-ctx.Done()
+
+	l.mutex.Lock()
+	delete(l.handlers, id)
+	l.mutex.Unlock()
+
+	return nil
+}
+
+func (l *local) Close() error {
+	return nil
+}
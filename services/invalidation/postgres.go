@@ -0,0 +1,108 @@
+package invalidation
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"gorm.io/gorm"
+)
+
+// reconnectDelay - Pause before listener connection is opened again
+const reconnectDelay = time.Second
+
+// postgresBus - Events are sent with pg_notify through the pooled gorm connection,
+// while listening requires its own dedicated connection
+type postgresBus struct {
+	db      *gorm.DB
+	dsn     string
+	channel string
+}
+
+// PostgresConfig - DSN is the same one used by gorm, pgx understands both key=value and URL form
+type PostgresConfig struct {
+	DB      *gorm.DB
+	DSN     string
+	Channel string
+}
+
+func NewPostgres(config PostgresConfig) Bus {
+	if config.Channel == "" {
+		config.Channel = DefaultChannel
+	}
+
+	return postgresBus{
+		db:      config.DB,
+		dsn:     config.DSN,
+		channel: config.Channel,
+	}
+}
+
+func (p postgresBus) Publish(ctx context.Context, event Event) error {
+	payload, err := encode(event)
+
+	if err != nil {
+		return err
+	}
+
+	return p.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", p.channel, payload).Error
+}
+
+// Listen - Connection is reopened when it breaks, notifications sent in the
+// meantime are lost so KindPurge is delivered after every reconnect
+func (p postgresBus) Listen(ctx context.Context, handler func(Event)) error {
+	conn, err := p.listen(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+
+		if err == nil {
+			if event, err := decode(notification.Payload); err == nil {
+				handler(event)
+			}
+			continue
+		}
+
+		_ = conn.Close(context.Background())
+
+		for {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(reconnectDelay):
+			}
+
+			if conn, err = p.listen(ctx); err == nil {
+				handler(Event{Kind: KindPurge})
+				break
+			}
+		}
+	}
+}
+
+func (p postgresBus) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, p.dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{p.channel}.Sanitize()); err != nil {
+		_ = conn.Close(context.Background())
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (p postgresBus) Close() error {
+	return nil
+}
@@ -0,0 +1,81 @@
+package invalidation
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type redisBus struct {
+	client  *redis.Client
+	channel string
+}
+
+// RedisConfig - Connection is configured by databases.redis section
+type RedisConfig struct {
+	Addr     string
+	Password string
+	Channel  string
+}
+
+func NewRedis(config RedisConfig) Bus {
+	if config.Channel == "" {
+		config.Channel = DefaultChannel
+	}
+
+	return redisBus{
+		client: redis.NewClient(&redis.Options{
+			Addr:     config.Addr,
+			Password: config.Password,
+		}),
+		channel: config.Channel,
+	}
+}
+
+func (r redisBus) Publish(ctx context.Context, event Event) error {
+	payload, err := encode(event)
+
+	if err != nil {
+		return err
+	}
+
+	return r.client.Publish(ctx, r.channel, payload).Err()
+}
+
+// Listen - go-redis resubscribes after connection loss, every subscription after
+// the first one is reported as KindPurge because events could have been published meanwhile
+func (r redisBus) Listen(ctx context.Context, handler func(Event)) error {
+	pubSub := r.client.Subscribe(ctx, r.channel)
+	defer pubSub.Close()
+
+	// Waits for the confirmation, so events published after Listen returns are not lost
+	if _, err := pubSub.Receive(ctx); err != nil {
+		return err
+	}
+
+	messages := pubSub.ChannelWithSubscriptions(ctx, 100)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case message, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			switch m := message.(type) {
+			case *redis.Subscription:
+				handler(Event{Kind: KindPurge})
+			case *redis.Message:
+				if event, err := decode(m.Payload); err == nil {
+					handler(event)
+				}
+			}
+		}
+	}
+}
+
+func (r redisBus) Close() error {
+	return r.client.Close()
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/gofiber/utils"
+)
+
+// KeyIDLength - Bytes of the key ID stored in the envelope of every ciphertext
+const KeyIDLength = 4
+
+var ErrUnknownKey = errors.New("value is encrypted with key which is not loaded")
+
+// KeyID - Fingerprint of the secret key, stored in ciphertexts so they can be matched with the key after rotation
+func KeyID(key []byte) uint32 {
+	sum := sha256.Sum256(append([]byte("vaulguard key id"), key...))
+	return binary.BigEndian.Uint32(sum[:KeyIDLength])
+}
+
+// CiphertextKeyID - ID of the key which sealed the value, false for legacy values without envelope
+func CiphertextKeyID(msg []byte) (uint32, bool) {
+	if e, ok := ParseEnvelope(msg); ok {
+		return e.KeyID, true
+	}
+
+	return 0, false
+}
+
+// keyedEncryption - Secret key encryption which records ID of the key in every ciphertext.
+// Values are always sealed with the current key, previous keys are only used to open values
+// which were not yet re-encrypted after rotation
+type keyedEncryption struct {
+	algorithm Algorithm
+	current   uint32
+	keys      map[uint32]*locked.Buffer
+	// order - Current key first, legacy values are tried in this order
+	order []*locked.Buffer
+}
+
+// NewKeyedEncryption - Encryption with the current key and the default cipher, previous keys stay readable during rotation
+func NewKeyedEncryption(current []byte, previous ...[]byte) (Encryption, error) {
+	return NewKeyedEncryptionWithAlgorithm(DefaultAlgorithm, current, previous...)
+}
+
+// NewKeyedEncryptionWithAlgorithm - Values are sealed with the algorithm, values sealed
+// with any other secret key algorithm are still opened
+func NewKeyedEncryptionWithAlgorithm(algorithm Algorithm, current []byte, previous ...[]byte) (Encryption, error) {
+	if algorithm.NonceSize() <= 0 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	k := keyedEncryption{
+		algorithm: algorithm,
+		current:   KeyID(current),
+		keys:      make(map[uint32]*locked.Buffer, len(previous)+1),
+		order:     make([]*locked.Buffer, 0, len(previous)+1),
+	}
+
+	for _, key := range append([][]byte{current}, previous...) {
+		if len(key) != SecretKeyLength {
+			return nil, ErrKeyLength
+		}
+
+		id := KeyID(key)
+
+		if _, ok := k.keys[id]; ok {
+			continue
+		}
+
+		buffer, err := locked.Copy(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		k.keys[id] = buffer
+		k.order = append(k.order, buffer)
+	}
+
+	return k, nil
+}
+
+// Encrypt - Appends envelope sealed with the current key to dst
+func (k keyedEncryption) Encrypt(dst, msg []byte) ([]byte, error) {
+	return k.EncryptWithAD(dst, msg, nil)
+}
+
+func (k keyedEncryption) EncryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	return sealEnvelope(k.algorithm, k.keys[k.current], k.current, dst, msg, additionalData)
+}
+
+func (k keyedEncryption) EncryptString(msg string) ([]byte, error) {
+	return k.EncryptStringWithAD(msg, nil)
+}
+
+func (k keyedEncryption) EncryptStringWithAD(msg string, additionalData []byte) ([]byte, error) {
+	dst := make([]byte, 0, envelopeHeaderLength+k.algorithm.NonceSize()+len(msg)+aeadOverhead)
+
+	return k.EncryptWithAD(dst, utils.GetBytes(msg), additionalData)
+}
+
+func (k keyedEncryption) Decrypt(dst, msg []byte) ([]byte, error) {
+	return k.DecryptWithAD(dst, msg, nil)
+}
+
+func (k keyedEncryption) DecryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	var (
+		keyed, known bool
+		key          *locked.Buffer
+	)
+
+	if e, ok := ParseEnvelope(msg); ok {
+		keyed = true
+
+		if key, known = k.keys[e.KeyID]; known {
+			decrypted, err := openEnvelope(key, dst, e, additionalData)
+
+			if err == nil || errors.Is(err, locked.ErrDestroyed) {
+				return decrypted, err
+			}
+		}
+	}
+
+	// Legacy value (or nonce which happens to start with the magic), every loaded key is tried
+	for _, key := range k.order {
+		if decrypted, err := open(key, dst, msg, additionalData); err == nil {
+			return decrypted, nil
+		}
+	}
+
+	if keyed && !known {
+		return nil, ErrUnknownKey
+	}
+
+	return nil, errors.New("decryption failed")
+}
+
+func (k keyedEncryption) DecryptString(msg []byte) (string, error) {
+	return k.DecryptStringWithAD(msg, nil)
+}
+
+func (k keyedEncryption) DecryptStringWithAD(msg, additionalData []byte) (string, error) {
+	message, err := k.DecryptWithAD(nil, msg, additionalData)
+
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GetString(message), nil
+}
+
+func open(key *locked.Buffer, dst, msg, additionalData []byte) ([]byte, error) {
+	c, err := newCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg) < c.NonceSize() {
+		return nil, errors.New("size of message is less than nonce size")
+	}
+
+	return c.Open(dst, msg[:c.NonceSize()], msg[c.NonceSize():], additionalData)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func randomKey(t *testing.T) []byte {
+	key := make([]byte, SecretKeyLength)
+	_, err := rand.Read(key)
+	require.Nil(t, err)
+	return key
+}
+
+func TestKeyedEncryption(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	oldKey, newKey := randomKey(t), randomKey(t)
+
+	old, err := NewKeyedEncryption(oldKey)
+	asserts.Nil(err)
+
+	rotated, err := NewKeyedEncryption(newKey, oldKey)
+	asserts.Nil(err)
+
+	t.Run("CiphertextContainsKeyID", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := rotated.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		id, ok := CiphertextKeyID(encrypted)
+		asserts.True(ok)
+		asserts.Equal(KeyID(newKey), id)
+
+		decrypted, err := rotated.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("Hello World", decrypted)
+	})
+
+	t.Run("PreviousKeyIsReadable", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := old.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		decrypted, err := rotated.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("Hello World", decrypted)
+	})
+
+	t.Run("LegacyValueIsReadable", func(t *testing.T) {
+		asserts := require.New(t)
+		legacy, err := NewSecretKeyEncryption(oldKey)
+		asserts.Nil(err)
+
+		encrypted, err := legacy.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		decrypted, err := rotated.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("Hello World", decrypted)
+	})
+
+	t.Run("RetiredKey", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := old.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		current, err := NewKeyedEncryption(newKey)
+		asserts.Nil(err)
+
+		_, err = current.DecryptString(encrypted)
+		asserts.Equal(ErrUnknownKey, err)
+	})
+
+	t.Run("TamperedValue", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := rotated.EncryptString("Hello World")
+		asserts.Nil(err)
+
+		encrypted[len(encrypted)-1] ^= 1
+
+		_, err = rotated.DecryptString(encrypted)
+		asserts.NotNil(err)
+	})
+
+	t.Run("EncryptAppendsToDst", func(t *testing.T) {
+		asserts := require.New(t)
+		encrypted, err := rotated.Encrypt([]byte("prefix"), []byte("Hello World"))
+		asserts.Nil(err)
+		asserts.Equal("prefix", string(encrypted[:6]))
+
+		decrypted, err := rotated.Decrypt(nil, encrypted[6:])
+		asserts.Nil(err)
+		asserts.Equal("Hello World", string(decrypted))
+	})
+}
+
+func TestAssociatedData(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	secretKey, err := NewSecretKeyEncryption(randomKey(t))
+	asserts.Nil(err)
+
+	keyed, err := NewKeyedEncryption(randomKey(t))
+	asserts.Nil(err)
+
+	implementations := map[string]Encryption{
+		"SecretKey": secretKey,
+		"Keyed":     keyed,
+	}
+
+	for name, encryption := range implementations {
+		encryption := encryption
+
+		t.Run(name, func(t *testing.T) {
+			asserts := require.New(t)
+			encrypted, err := encryption.EncryptStringWithAD("Hello World", []byte("application:key"))
+			asserts.Nil(err)
+
+			decrypted, err := encryption.DecryptStringWithAD(encrypted, []byte("application:key"))
+			asserts.Nil(err)
+			asserts.Equal("Hello World", decrypted)
+
+			_, err = encryption.DecryptStringWithAD(encrypted, []byte("application:other"))
+			asserts.NotNil(err)
+
+			_, err = encryption.DecryptString(encrypted)
+			asserts.NotNil(err)
+		})
+	}
+
+	t.Run("PublicKey", func(t *testing.T) {
+		asserts := require.New(t)
+		public, private, err := box.GenerateKey(rand.Reader)
+		asserts.Nil(err)
+		publicKey, err := NewPublicKeyEncryption(bytes.NewReader(public[:]), bytes.NewReader(private[:]))
+		asserts.Nil(err)
+
+		_, err = publicKey.EncryptStringWithAD("Hello World", []byte("application:key"))
+		asserts.Equal(ErrAssociatedDataNotSupported, err)
+	})
+}
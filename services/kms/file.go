@@ -0,0 +1,204 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/BrosSquad/vaulguard/utils"
+)
+
+const DefaultKeysPermission = 0700
+
+// PrivateKeyProtection - Private key is written sealed with the passphrase when Encrypt is set,
+// existing plain private key is sealed on next start. Sealed private key is always opened with the passphrase
+type PrivateKeyProtection struct {
+	Encrypt bool
+	// Passphrase - Called only when the passphrase is needed, confirm is set when new private key is sealed
+	Passphrase func(confirm bool) ([]byte, error)
+	Params     Argon2Params
+}
+
+// fileKeyPair - Secret key sealed with NaCl box key pair stored on disk
+type fileKeyPair struct {
+	encryption services.Encryption
+}
+
+// NewFileKeyPair - Key pair is generated when create is set and neither key exists,
+// one key without the other is an error, since secret key could not be unwrapped anymore
+func NewFileKeyPair(privateKeyPath, publicKeyPath string, create bool, protection PrivateKeyProtection) (KeyManager, error) {
+	privateKeyPath, err := utils.GetAbsolutePath(privateKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	publicKeyPath, err = utils.GetAbsolutePath(publicKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyExists, publicKeyExists := utils.FileExists(privateKeyPath), utils.FileExists(publicKeyPath)
+
+	if err := checkKeyPairExistence(privateKeyExists, publicKeyExists); err != nil {
+		return nil, err
+	}
+
+	if !publicKeyExists && !create {
+		return nil, errors.New("key pair does not exist, start the server to generate it")
+	}
+
+	encryption, err := GenerateKeyPair(privateKeyPath, publicKeyPath, !publicKeyExists, protection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return fileKeyPair{encryption: encryption}, nil
+}
+
+func (f fileKeyPair) Wrap(_ context.Context, key []byte) ([]byte, error) {
+	return f.encryption.Encrypt(nil, key)
+}
+
+func (f fileKeyPair) Unwrap(_ context.Context, wrapped []byte) ([]byte, error) {
+	key, err := f.encryption.Decrypt(nil, wrapped)
+
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+
+	return key, nil
+}
+
+// GenerateKeyPair - Opens the key pair, keys are generated first when create is set
+func GenerateKeyPair(privateKeyPath, publicKeyPath string, create bool, protection PrivateKeyProtection) (services.Encryption, error) {
+	if err := utils.CreateDirs(DefaultKeysPermission, filepath.Dir(privateKeyPath), filepath.Dir(publicKeyPath)); err != nil {
+		return nil, err
+	}
+
+	if create {
+		var public, private bytes.Buffer
+
+		// Generate key pair
+		if err := services.NewKeyPairGenerator(&public, &private).Generate(); err != nil {
+			return nil, err
+		}
+
+		if err := ioutil.WriteFile(publicKeyPath, public.Bytes(), DefaultKeysPermission); err != nil {
+			return nil, err
+		}
+
+		err := writePrivateKey(privateKeyPath, private.Bytes(), protection)
+		locked.Wipe(private.Bytes())
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	public, err := ioutil.ReadFile(publicKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := readPrivateKey(privateKeyPath, protection)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer locked.Wipe(private)
+
+	return services.NewPublicKeyEncryption(bytes.NewReader(public), bytes.NewReader(private))
+}
+
+// readPrivateKey - Plain private key is exactly PrivateKeyLength bytes, anything else has to be sealed
+func readPrivateKey(path string, protection PrivateKeyProtection) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == services.PrivateKeyLength {
+		if protection.Encrypt {
+			// Private key written before encryption was enabled
+			if err := writePrivateKey(path, data, protection); err != nil {
+				return nil, err
+			}
+		}
+
+		return data, nil
+	}
+
+	if !IsSealedWithPassphrase(data) {
+		return nil, services.ErrKeyLength
+	}
+
+	if protection.Passphrase == nil {
+		return nil, ErrPassphraseEmpty
+	}
+
+	passphrase, err := protection.Passphrase(false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := OpenWithPassphrase(passphrase, data)
+
+	if err != nil {
+		return nil, errors.New("private key cannot be decrypted, passphrase is wrong")
+	}
+
+	return private, nil
+}
+
+// writePrivateKey - Key is written to temporary file first, so the existing key is replaced atomically
+func writePrivateKey(path string, private []byte, protection PrivateKeyProtection) error {
+	data := private
+
+	if protection.Encrypt {
+		if protection.Passphrase == nil {
+			return ErrPassphraseEmpty
+		}
+
+		passphrase, err := protection.Passphrase(true)
+
+		if err != nil {
+			return err
+		}
+
+		if data, err = SealWithPassphrase(passphrase, private, protection.Params); err != nil {
+			return err
+		}
+	}
+
+	tmp := path + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, DefaultKeysPermission); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func checkKeyPairExistence(privateKeyExists, publicKeyExists bool) error {
+	if privateKeyExists && !publicKeyExists {
+		return errors.New("public key does not exit while private exists")
+	}
+
+	if !privateKeyExists && publicKeyExists {
+		return errors.New("private key does not exit while public exists")
+	}
+
+	return nil
+}
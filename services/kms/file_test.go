@@ -0,0 +1,126 @@
+package kms
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	path, err := ioutil.TempDir("", "generate_vaulguard_keys")
+	asserts.Nil(err)
+
+	t.Run("SuccessfulGeneration", func(t *testing.T) {
+		publicKeyPath := filepath.Join(path, "public_success.key")
+		privateKeyPath := filepath.Join(path, "private_success.key")
+		_, err := GenerateKeyPair(privateKeyPath, publicKeyPath, true, PrivateKeyProtection{})
+		asserts.Nil(err)
+		asserts.FileExists(publicKeyPath)
+		asserts.FileExists(privateKeyPath)
+		asserts.Nil(os.Remove(publicKeyPath))
+		asserts.Nil(os.Remove(privateKeyPath))
+	})
+
+	t.Run("PrivateKeyNotFound", func(t *testing.T) {
+		publicKeyPath := filepath.Join(path, "public_success.key")
+		privateKeyPath := filepath.Join(path, "private_success.key")
+		file, err := os.Create(publicKeyPath)
+		asserts.Nil(err)
+		asserts.Nil(file.Close())
+		asserts.FileExists(publicKeyPath)
+		_, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, PrivateKeyProtection{})
+		asserts.NotNil(err)
+	})
+
+	t.Run("PublicKeyNotFound", func(t *testing.T) {
+		publicKeyPath := filepath.Join(path, "public_success.key")
+		privateKeyPath := filepath.Join(path, "private_success.key")
+		file, err := os.Create(privateKeyPath)
+		asserts.Nil(err)
+		asserts.Nil(file.Close())
+		asserts.FileExists(publicKeyPath)
+		_, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, PrivateKeyProtection{})
+		asserts.NotNil(err)
+	})
+
+	t.Run("EmptyKeyFiles", func(t *testing.T) {
+		publicKeyPath := filepath.Join(path, "public_success.key")
+		privateKeyPath := filepath.Join(path, "private_success.key")
+		file1, err := os.Create(publicKeyPath)
+		asserts.Nil(err)
+		asserts.Nil(file1.Close())
+		file2, err := os.Create(privateKeyPath)
+		asserts.Nil(err)
+		asserts.Nil(file2.Close())
+		asserts.FileExists(publicKeyPath)
+		asserts.FileExists(privateKeyPath)
+		_, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, PrivateKeyProtection{})
+		asserts.NotNil(err)
+	})
+
+	t.Run("EncryptedPrivateKey", func(t *testing.T) {
+		publicKeyPath := filepath.Join(path, "public_encrypted.key")
+		privateKeyPath := filepath.Join(path, "private_encrypted.key")
+		passphrase := func(pass string) func(bool) ([]byte, error) {
+			return func(bool) ([]byte, error) {
+				return []byte(pass), nil
+			}
+		}
+		protection := PrivateKeyProtection{Encrypt: true, Passphrase: passphrase("correct horse"), Params: testArgon2}
+
+		encryption, err := GenerateKeyPair(privateKeyPath, publicKeyPath, true, protection)
+		asserts.Nil(err)
+
+		private, err := ioutil.ReadFile(privateKeyPath)
+		asserts.Nil(err)
+		asserts.True(IsSealedWithPassphrase(private))
+
+		wrapped, err := encryption.Encrypt(nil, []byte("secret key"))
+		asserts.Nil(err)
+
+		// Sealed private key is opened even when encryption is not requested anymore
+		encryption, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, PrivateKeyProtection{Passphrase: passphrase("correct horse")})
+		asserts.Nil(err)
+		key, err := encryption.Decrypt(nil, wrapped)
+		asserts.Nil(err)
+		asserts.Equal([]byte("secret key"), key)
+
+		_, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, PrivateKeyProtection{Passphrase: passphrase("battery staple")})
+		asserts.NotNil(err)
+
+		_, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, PrivateKeyProtection{})
+		asserts.Equal(ErrPassphraseEmpty, err)
+	})
+
+	t.Run("PlainPrivateKeyIsEncrypted", func(t *testing.T) {
+		publicKeyPath := filepath.Join(path, "public_plain.key")
+		privateKeyPath := filepath.Join(path, "private_plain.key")
+
+		_, err := GenerateKeyPair(privateKeyPath, publicKeyPath, true, PrivateKeyProtection{})
+		asserts.Nil(err)
+		plain, err := ioutil.ReadFile(privateKeyPath)
+		asserts.Nil(err)
+		asserts.Len(plain, 32)
+
+		protection := PrivateKeyProtection{
+			Encrypt:    true,
+			Passphrase: func(bool) ([]byte, error) { return []byte("correct horse"), nil },
+			Params:     testArgon2,
+		}
+		_, err = GenerateKeyPair(privateKeyPath, publicKeyPath, false, protection)
+		asserts.Nil(err)
+
+		sealed, err := ioutil.ReadFile(privateKeyPath)
+		asserts.Nil(err)
+		asserts.True(IsSealedWithPassphrase(sealed))
+
+		private, err := OpenWithPassphrase([]byte("correct horse"), sealed)
+		asserts.Nil(err)
+		asserts.Equal(plain, private)
+	})
+}
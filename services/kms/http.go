@@ -0,0 +1,119 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPConfig - External KMS which keeps the wrapping key, key never leaves the KMS
+type HTTPConfig struct {
+	URL     string
+	KeyID   string
+	Token   string
+	Timeout time.Duration
+	// Client - Defaults to http.Client with Timeout
+	Client *http.Client
+}
+
+// httpKMS - Wraps the secret key with POST {url}/v1/keys/{key_id}/wrap and unwraps it with .../unwrap,
+// plaintext and ciphertext are sent base64 encoded in JSON body
+type httpKMS struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+type (
+	wrapRequest struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+
+	wrapResponse struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+
+	unwrapRequest struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+
+	unwrapResponse struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+)
+
+func NewHTTP(cfg HTTPConfig) KeyManager {
+	client := cfg.Client
+
+	if client == nil {
+		client = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	return httpKMS{
+		endpoint: strings.TrimRight(cfg.URL, "/") + "/v1/keys/" + url.PathEscape(cfg.KeyID),
+		token:    cfg.Token,
+		client:   client,
+	}
+}
+
+func (h httpKMS) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	var res wrapResponse
+
+	if err := h.do(ctx, "/wrap", wrapRequest{Plaintext: key}, &res); err != nil {
+		return nil, err
+	}
+
+	return res.Ciphertext, nil
+}
+
+func (h httpKMS) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var res unwrapResponse
+
+	if err := h.do(ctx, "/unwrap", unwrapRequest{Ciphertext: wrapped}, &res); err != nil {
+		return nil, err
+	}
+
+	return res.Plaintext, nil
+}
+
+func (h httpKMS) do(ctx context.Context, action string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.endpoint+action, bytes.NewReader(data))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	res, err := h.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("kms %s failed with status %d: %s", action[1:], res.StatusCode, bytes.TrimSpace(message))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
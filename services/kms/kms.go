@@ -0,0 +1,124 @@
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/locked"
+)
+
+var ErrUnwrap = errors.New("secret key cannot be unwrapped")
+
+// KeyManager - Wraps the secret key before it is written to disk, the wrapping key
+// never has to live next to the wrapped secret key (passphrase, external KMS)
+type KeyManager interface {
+	Wrap(ctx context.Context, key []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// New - Key manager selected by keys.provider, file key pair is generated when create is set and it does not exist
+func New(keys config.Keys, create bool) (KeyManager, error) {
+	switch keys.Provider.Name {
+	case "", config.KeyProviderFile:
+		// Passphrase is needed only until the private key is open
+		passphrase := &cachedPassphrase{file: keys.Provider.Passphrase.File}
+		defer passphrase.wipe()
+
+		return NewFileKeyPair(keys.Private, keys.Public, create, PrivateKeyProtection{
+			Encrypt:    keys.EncryptPrivateKey,
+			Passphrase: passphrase.read,
+			Params:     argon2Params(keys.Provider.Passphrase),
+		})
+	case config.KeyProviderPassphrase:
+		passphrase, err := ReadPassphrase(keys.Provider.Passphrase.File)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewPassphrase(passphrase, argon2Params(keys.Provider.Passphrase))
+	case config.KeyProviderKMS:
+		return NewHTTP(HTTPConfig{
+			URL:     keys.Provider.KMS.URL,
+			KeyID:   keys.Provider.KMS.KeyID,
+			Token:   keys.Provider.KMS.Token,
+			Timeout: keys.Provider.KMS.Timeout,
+		}), nil
+	case config.KeyProviderShamir:
+		return nil, ErrUnsealRequired
+	}
+
+	return nil, config.ErrKeyProvider
+}
+
+func argon2Params(passphrase config.PassphraseProvider) Argon2Params {
+	return Argon2Params{
+		Time:        passphrase.Time,
+		Memory:      passphrase.Memory,
+		Parallelism: passphrase.Parallelism,
+	}
+}
+
+// cachedPassphrase - Passphrase is read at most once, so new private key is not sealed
+// and opened with passphrases typed twice
+type cachedPassphrase struct {
+	file       string
+	passphrase []byte
+}
+
+func (c *cachedPassphrase) read(confirm bool) ([]byte, error) {
+	if c.passphrase != nil {
+		return c.passphrase, nil
+	}
+
+	var err error
+
+	if confirm {
+		c.passphrase, err = ReadNewPassphrase(c.file)
+	} else {
+		c.passphrase, err = ReadPassphrase(c.file)
+	}
+
+	return c.passphrase, err
+}
+
+func (c *cachedPassphrase) wipe() {
+	locked.Wipe(c.passphrase)
+	c.passphrase = nil
+}
+
+// GenerateSecretKey - Writes new wrapped secret key to w and returns the plain key
+func GenerateSecretKey(ctx context.Context, manager KeyManager, w io.Writer) ([]byte, error) {
+	key := make([]byte, services.SecretKeyLength)
+	n, err := rand.Read(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n != services.SecretKeyLength {
+		return nil, services.ErrNotEnoughBytes
+	}
+
+	wrapped, err := manager.Wrap(ctx, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	n, err = w.Write(wrapped)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if n != len(wrapped) {
+		return nil, io.ErrShortWrite
+	}
+
+	return key, nil
+}
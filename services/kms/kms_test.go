@@ -0,0 +1,144 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/kms/kmstest"
+	"github.com/stretchr/testify/require"
+)
+
+var testArgon2 = Argon2Params{Time: 1, Memory: 1024, Parallelism: 1}
+
+func TestPassphrase(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		pass := []byte("correct horse")
+		manager, err := NewPassphrase(pass, testArgon2)
+		asserts.Nil(err)
+		asserts.Equal(make([]byte, len(pass)), pass, "passphrase is moved to locked memory")
+
+		var buf bytes.Buffer
+		key, err := GenerateSecretKey(ctx, manager, &buf)
+		asserts.Nil(err)
+		asserts.Len(key, services.SecretKeyLength)
+		asserts.NotContains(buf.String(), string(key))
+
+		unwrapped, err := manager.Unwrap(ctx, buf.Bytes())
+		asserts.Nil(err)
+		asserts.Equal(key, unwrapped)
+
+		// Parameters are read from the header, not from the manager
+		manager, err = NewPassphrase([]byte("correct horse"), Argon2Params{})
+		asserts.Nil(err)
+		unwrapped, err = manager.Unwrap(ctx, buf.Bytes())
+		asserts.Nil(err)
+		asserts.Equal(key, unwrapped)
+	})
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		wrapped, err := SealWithPassphrase([]byte("correct horse"), []byte("key"), testArgon2)
+		asserts.Nil(err)
+
+		_, err = OpenWithPassphrase([]byte("battery staple"), wrapped)
+		asserts.Equal(ErrUnwrap, err)
+	})
+
+	t.Run("TamperedHeader", func(t *testing.T) {
+		wrapped, err := SealWithPassphrase([]byte("correct horse"), []byte("key"), testArgon2)
+		asserts.Nil(err)
+
+		wrapped[len(passphraseMagic)+SaltLength] ^= 1
+		_, err = OpenWithPassphrase([]byte("correct horse"), wrapped)
+		asserts.Equal(ErrUnwrap, err)
+
+		_, err = OpenWithPassphrase([]byte("correct horse"), []byte("not sealed"))
+		asserts.Equal(ErrPassphraseFormat, err)
+	})
+
+	t.Run("Argon2Bounds", func(t *testing.T) {
+		wrapped, err := SealWithPassphrase([]byte("correct horse"), []byte("key"), testArgon2)
+		asserts.Nil(err)
+
+		// Memory cost from the header is checked before anything is allocated
+		binary.BigEndian.PutUint32(wrapped[6:], MaxArgon2Memory+1)
+		_, err = OpenWithPassphrase([]byte("correct horse"), wrapped)
+		asserts.Equal(ErrArgon2Params, err)
+
+		for _, params := range []Argon2Params{
+			{Time: MaxArgon2Time + 1},
+			{Memory: MaxArgon2Memory + 1},
+			{Parallelism: MaxArgon2Parallelism + 1},
+		} {
+			_, err = SealWithPassphrase([]byte("correct horse"), []byte("key"), params)
+			asserts.Equal(ErrArgon2Params, err)
+		}
+	})
+}
+
+func TestReadPassphrase(t *testing.T) {
+	asserts := require.New(t)
+
+	path, err := ioutil.TempDir("", "vaulguard_passphrase")
+	asserts.Nil(err)
+	defer os.RemoveAll(path)
+
+	file := filepath.Join(path, "passphrase")
+	asserts.Nil(ioutil.WriteFile(file, []byte("from file\n"), 0600))
+
+	asserts.Nil(os.Unsetenv(PassphraseEnv))
+	pass, err := ReadPassphrase(file)
+	asserts.Nil(err)
+	asserts.Equal([]byte("from file"), pass)
+
+	_, err = ReadPassphrase("")
+	asserts.Equal(ErrPassphraseEmpty, err)
+
+	asserts.Nil(os.Setenv(PassphraseEnv, "from env"))
+	defer os.Unsetenv(PassphraseEnv)
+
+	pass, err = ReadPassphrase(file)
+	asserts.Nil(err)
+	asserts.Equal([]byte("from env"), pass)
+}
+
+func TestHTTP(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	server := kmstest.NewServer("master", "token")
+	defer server.Close()
+
+	manager, err := New(config.Keys{
+		Provider: config.KeyProvider{
+			Name: config.KeyProviderKMS,
+			KMS:  config.KMSProvider{URL: server.URL, KeyID: "master", Token: "token"},
+		},
+	}, false)
+	asserts.Nil(err)
+
+	var buf bytes.Buffer
+	key, err := GenerateSecretKey(ctx, manager, &buf)
+	asserts.Nil(err)
+
+	unwrapped, err := manager.Unwrap(ctx, buf.Bytes())
+	asserts.Nil(err)
+	asserts.Equal(key, unwrapped)
+
+	_, err = NewHTTP(HTTPConfig{URL: server.URL, KeyID: "master", Token: "wrong"}).Unwrap(ctx, buf.Bytes())
+	asserts.NotNil(err)
+
+	_, err = NewHTTP(HTTPConfig{URL: server.URL, KeyID: "other", Token: "token"}).Unwrap(ctx, buf.Bytes())
+	asserts.NotNil(err)
+}
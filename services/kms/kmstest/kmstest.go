@@ -0,0 +1,88 @@
+// Package kmstest - In memory KMS server which speaks the protocol of kms.NewHTTP, used in tests
+package kmstest
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+type Server struct {
+	*httptest.Server
+	KeyID string
+	Token string
+}
+
+// NewServer - Server with a single random key, requests for other keys or with wrong token are rejected
+func NewServer(keyID, token string) *Server {
+	key := make([]byte, chacha20poly1305.KeySize)
+
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+
+	c, err := chacha20poly1305.NewX(key)
+
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{KeyID: keyID, Token: token}
+	prefix := "/v1/keys/" + keyID + "/"
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, prefix) {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body struct {
+			Plaintext  []byte `json:"plaintext"`
+			Ciphertext []byte `json:"ciphertext"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch strings.TrimPrefix(r.URL.Path, prefix) {
+		case "wrap":
+			nonce := make([]byte, c.NonceSize(), c.NonceSize()+len(body.Plaintext)+c.Overhead())
+
+			if _, err := rand.Read(nonce); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"ciphertext": c.Seal(nonce, nonce, body.Plaintext, nil)})
+		case "unwrap":
+			if len(body.Ciphertext) < c.NonceSize() {
+				http.Error(w, "invalid ciphertext", http.StatusBadRequest)
+				return
+			}
+
+			plaintext, err := c.Open(nil, body.Ciphertext[:c.NonceSize()], body.Ciphertext[c.NonceSize():], nil)
+
+			if err != nil {
+				http.Error(w, "invalid ciphertext", http.StatusBadRequest)
+				return
+			}
+
+			_ = json.NewEncoder(w).Encode(map[string][]byte{"plaintext": plaintext})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	return s
+}
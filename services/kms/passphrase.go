@@ -0,0 +1,282 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/BrosSquad/vaulguard/utils"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	DefaultArgon2Time        = 3
+	DefaultArgon2Memory      = 64 * 1024
+	DefaultArgon2Parallelism = 4
+
+	// Upper bounds of the Argon2id cost, parameters are read from the sealed value
+	// so a tampered header could otherwise make the server allocate any amount of memory
+	MaxArgon2Time        = 32
+	MaxArgon2Memory      = 1024 * 1024
+	MaxArgon2Parallelism = 64
+
+	SaltLength = 16
+
+	// PassphraseEnv - Passphrase is read from this variable before the passphrase file
+	PassphraseEnv = config.EnvironmentalVariablesPrefix + "KEY_PASSPHRASE"
+
+	tagLength = 16
+
+	// magic, time, memory, parallelism, salt
+	passphraseHeaderLength = len(passphraseMagic) + 4 + 4 + 1 + SaltLength
+)
+
+var passphraseMagic = [...]byte{'V', 'P'}
+
+var (
+	ErrPassphraseEmpty    = errors.New("passphrase is not set, use " + PassphraseEnv + ", passphrase file or terminal")
+	ErrPassphraseFormat   = errors.New("value is not sealed with passphrase")
+	ErrPassphraseMismatch = errors.New("passphrases do not match")
+	ErrArgon2Params       = errors.New("argon2 time must be 1 to 32, memory at most 1048576 KiB and parallelism 1 to 64")
+)
+
+// Argon2Params - Argon2id cost, zero values are replaced with defaults
+type Argon2Params struct {
+	Time        uint32
+	Memory      uint32
+	Parallelism uint8
+}
+
+func (p Argon2Params) withDefaults() Argon2Params {
+	if p.Time == 0 {
+		p.Time = DefaultArgon2Time
+	}
+
+	if p.Memory == 0 {
+		p.Memory = DefaultArgon2Memory
+	}
+
+	if p.Parallelism == 0 {
+		p.Parallelism = DefaultArgon2Parallelism
+	}
+
+	return p
+}
+
+// valid - Argon2 panics on zero time or parallelism, huge values would exhaust the memory
+func (p Argon2Params) valid() bool {
+	return p.Time > 0 && p.Time <= MaxArgon2Time &&
+		p.Memory <= MaxArgon2Memory &&
+		p.Parallelism > 0 && p.Parallelism <= MaxArgon2Parallelism
+}
+
+// passphrase - Secret key wrapped with key derived from passphrase
+type passphrase struct {
+	passphrase *locked.Buffer
+	params     Argon2Params
+}
+
+// NewPassphrase - Passphrase is moved to locked memory, pass is wiped
+func NewPassphrase(pass []byte, params Argon2Params) (KeyManager, error) {
+	buffer, err := locked.Move(pass)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return passphrase{passphrase: buffer, params: params}, nil
+}
+
+func (p passphrase) Wrap(_ context.Context, key []byte) (wrapped []byte, err error) {
+	err = p.passphrase.With(func(pass []byte) error {
+		wrapped, err = SealWithPassphrase(pass, key, p.params)
+		return err
+	})
+
+	return wrapped, err
+}
+
+func (p passphrase) Unwrap(_ context.Context, wrapped []byte) (key []byte, err error) {
+	err = p.passphrase.With(func(pass []byte) error {
+		key, err = OpenWithPassphrase(pass, wrapped)
+		return err
+	})
+
+	return key, err
+}
+
+// SealWithPassphrase - Argon2id parameters and salt are stored in the header and authenticated,
+// so the cost can be changed without breaking values sealed before
+func SealWithPassphrase(pass, msg []byte, params Argon2Params) ([]byte, error) {
+	params = params.withDefaults()
+
+	if !params.valid() {
+		return nil, ErrArgon2Params
+	}
+
+	header := make([]byte, passphraseHeaderLength, passphraseHeaderLength+chacha20poly1305.NonceSizeX+len(msg)+tagLength)
+	copy(header, passphraseMagic[:])
+	binary.BigEndian.PutUint32(header[2:], params.Time)
+	binary.BigEndian.PutUint32(header[6:], params.Memory)
+	header[10] = params.Parallelism
+
+	if _, err := rand.Read(header[11:passphraseHeaderLength]); err != nil {
+		return nil, err
+	}
+
+	c, err := newPassphraseCipher(pass, header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dst := header[:passphraseHeaderLength+c.NonceSize()]
+	nonce := dst[passphraseHeaderLength:]
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.Seal(dst, nonce, msg, header[:passphraseHeaderLength]), nil
+}
+
+// OpenWithPassphrase - Opens value sealed by SealWithPassphrase
+func OpenWithPassphrase(pass, sealed []byte) ([]byte, error) {
+	if !IsSealedWithPassphrase(sealed) {
+		return nil, ErrPassphraseFormat
+	}
+
+	header := sealed[:passphraseHeaderLength]
+
+	if !headerParams(header).valid() {
+		return nil, ErrArgon2Params
+	}
+
+	c, err := newPassphraseCipher(pass, header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := sealed[passphraseHeaderLength:]
+	msg, err := c.Open(nil, body[:c.NonceSize()], body[c.NonceSize():], header)
+
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+
+	return msg, nil
+}
+
+// IsSealedWithPassphrase - Reports whether the value was sealed by SealWithPassphrase
+func IsSealedWithPassphrase(value []byte) bool {
+	return len(value) >= passphraseHeaderLength+chacha20poly1305.NonceSizeX+tagLength && bytes.HasPrefix(value, passphraseMagic[:])
+}
+
+// ReadPassphrase - Passphrase from the environment, from the file or from the terminal, trailing new line is removed
+func ReadPassphrase(file string) ([]byte, error) {
+	return readPassphrase(file, false)
+}
+
+// ReadNewPassphrase - Like ReadPassphrase, passphrase typed in the terminal has to be repeated
+func ReadNewPassphrase(file string) ([]byte, error) {
+	return readPassphrase(file, true)
+}
+
+func readPassphrase(file string, confirm bool) ([]byte, error) {
+	if pass := os.Getenv(PassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+
+	if file == "" {
+		return promptPassphrase(confirm)
+	}
+
+	path, err := utils.GetAbsolutePath(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pass, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pass = bytes.TrimRight(pass, "\r\n")
+
+	if len(pass) == 0 {
+		return nil, ErrPassphraseEmpty
+	}
+
+	return pass, nil
+}
+
+// promptPassphrase - Asks on the terminal, server started without terminal needs the variable or the file
+func promptPassphrase(confirm bool) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+
+	if !terminal.IsTerminal(fd) {
+		return nil, ErrPassphraseEmpty
+	}
+
+	fmt.Fprint(os.Stderr, "Key passphrase: ")
+	pass, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pass) == 0 {
+		return nil, ErrPassphraseEmpty
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat key passphrase: ")
+		repeated, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+
+		if err != nil {
+			locked.Wipe(pass)
+			return nil, err
+		}
+
+		defer locked.Wipe(repeated)
+
+		if !bytes.Equal(pass, repeated) {
+			locked.Wipe(pass)
+			return nil, ErrPassphraseMismatch
+		}
+	}
+
+	return pass, nil
+}
+
+func headerParams(header []byte) Argon2Params {
+	return Argon2Params{
+		Time:        binary.BigEndian.Uint32(header[2:]),
+		Memory:      binary.BigEndian.Uint32(header[6:]),
+		Parallelism: header[10],
+	}
+}
+
+// newPassphraseCipher - Cipher keeps its own copy of the derived key, so it is wiped right away
+func newPassphraseCipher(pass, header []byte) (cipher.AEAD, error) {
+	params := headerParams(header)
+	key := argon2.IDKey(pass, header[11:passphraseHeaderLength], params.Time, params.Memory, params.Parallelism, chacha20poly1305.KeySize)
+	defer locked.Wipe(key)
+
+	return chacha20poly1305.NewX(key)
+}
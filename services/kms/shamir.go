@@ -0,0 +1,119 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+
+	"github.com/BrosSquad/vaulguard/services/shamir"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// magic, threshold
+const shamirHeaderLength = len(shamirMagic) + 1
+
+var shamirMagic = [...]byte{'V', 'S'}
+
+var (
+	ErrShamirFormat   = errors.New("secret key is not sealed with unseal key")
+	ErrUnsealRequired = errors.New("shamir key provider needs unseal key shares, use vaulguard unseal")
+)
+
+// unsealKey - Secret key wrapped with the key which only exists split into Shamir shares,
+// threshold is stored in the header, so the server knows how many shares to wait for
+type unsealKey struct {
+	key       []byte
+	threshold int
+}
+
+// NewUnsealKey - Key manager for unseal key recovered from shares
+func NewUnsealKey(key []byte, threshold int) KeyManager {
+	return unsealKey{key: key, threshold: threshold}
+}
+
+// NewUnsealKeyFromShares - Combines the shares, wrong shares are detected only when the secret key is unwrapped
+func NewUnsealKeyFromShares(shares [][]byte, threshold int) (KeyManager, error) {
+	if len(shares) < threshold {
+		return nil, shamir.ErrThreshold
+	}
+
+	key, err := shamir.Combine(shares)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUnsealKey(key, threshold), nil
+}
+
+// GenerateUnsealKey - New unseal key split into shares
+func GenerateUnsealKey(shares, threshold int) (KeyManager, [][]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+
+	parts, err := shamir.Split(key, shares, threshold)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewUnsealKey(key, threshold), parts, nil
+}
+
+// UnsealThreshold - Number of shares needed to unwrap the secret key
+func UnsealThreshold(wrapped []byte) (int, error) {
+	if len(wrapped) < shamirHeaderLength || !bytes.HasPrefix(wrapped, shamirMagic[:]) {
+		return 0, ErrShamirFormat
+	}
+
+	return int(wrapped[len(shamirMagic)]), nil
+}
+
+func (u unsealKey) Wrap(_ context.Context, key []byte) ([]byte, error) {
+	c, err := chacha20poly1305.NewX(u.key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dst := make([]byte, shamirHeaderLength+c.NonceSize(), shamirHeaderLength+c.NonceSize()+len(key)+c.Overhead())
+	copy(dst, shamirMagic[:])
+	dst[len(shamirMagic)] = byte(u.threshold)
+	nonce := dst[shamirHeaderLength:]
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return c.Seal(dst, nonce, key, dst[:shamirHeaderLength]), nil
+}
+
+func (u unsealKey) Unwrap(_ context.Context, wrapped []byte) ([]byte, error) {
+	if _, err := UnsealThreshold(wrapped); err != nil {
+		return nil, err
+	}
+
+	c, err := chacha20poly1305.NewX(u.key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	body := wrapped[shamirHeaderLength:]
+
+	if len(body) < c.NonceSize() {
+		return nil, ErrShamirFormat
+	}
+
+	key, err := c.Open(nil, body[:c.NonceSize()], body[c.NonceSize():], wrapped[:shamirHeaderLength])
+
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+
+	return key, nil
+}
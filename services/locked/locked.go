@@ -0,0 +1,146 @@
+// Package locked - Key material kept outside of the Go heap, in memory which is locked (never swapped),
+// excluded from core dumps and zeroed explicitly when it is no longer needed
+package locked
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrDestroyed = errors.New("key material was destroyed")
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[*Buffer]struct{})
+
+	// onWipe - Called with zeroed memory before it is released, used by tests
+	onWipe func([]byte)
+)
+
+// Buffer - Fixed size buffer for key material, Destroy zeroes and releases the memory.
+// Every live buffer is destroyed by DestroyAll on shutdown
+type Buffer struct {
+	mutex  sync.RWMutex
+	memory []byte
+	data   []byte
+	locked bool
+}
+
+// New - Zeroed buffer, memory is only excluded from core dumps when mlock is not permitted (RLIMIT_MEMLOCK)
+func New(size int) (*Buffer, error) {
+	if size <= 0 {
+		return nil, errors.New("locked buffer size must be positive")
+	}
+
+	memory, locked, err := alloc(size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Buffer{memory: memory, data: memory[:size:size], locked: locked}
+
+	registryMutex.Lock()
+	registry[b] = struct{}{}
+	registryMutex.Unlock()
+
+	return b, nil
+}
+
+// Copy - Buffer with copy of data, caller still has to wipe its own copy
+func Copy(data []byte) (*Buffer, error) {
+	b, err := New(len(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	copy(b.data, data)
+
+	return b, nil
+}
+
+// Move - Like Copy, data is wiped afterwards
+func Move(data []byte) (*Buffer, error) {
+	b, err := Copy(data)
+	Wipe(data)
+
+	return b, err
+}
+
+// Bytes - Contents of the buffer, nil after Destroy. Slice must not be used after the buffer is destroyed
+func (b *Buffer) Bytes() []byte {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	return b.data
+}
+
+// With - Calls fn with contents of the buffer, buffer is not destroyed while fn runs
+func (b *Buffer) With(fn func([]byte) error) error {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	if b.data == nil {
+		return ErrDestroyed
+	}
+
+	return fn(b.data)
+}
+
+// Locked - Reports whether the memory is locked, it is still excluded from core dumps when it is not
+func (b *Buffer) Locked() bool {
+	return b.locked
+}
+
+// Destroy - Zeroes and releases the memory, calling it again does nothing
+func (b *Buffer) Destroy() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	registryMutex.Lock()
+	delete(registry, b)
+	registryMutex.Unlock()
+
+	if b.memory == nil {
+		return nil
+	}
+
+	Wipe(b.memory)
+
+	if onWipe != nil {
+		onWipe(b.memory)
+	}
+
+	err := free(b.memory, b.locked)
+	b.memory, b.data = nil, nil
+
+	return err
+}
+
+// DestroyAll - Destroys every live buffer, called on shutdown
+func DestroyAll() error {
+	registryMutex.Lock()
+	buffers := make([]*Buffer, 0, len(registry))
+	for b := range registry {
+		buffers = append(buffers, b)
+	}
+	registryMutex.Unlock()
+
+	var err error
+
+	for _, b := range buffers {
+		if destroyErr := b.Destroy(); destroyErr != nil && err == nil {
+			err = destroyErr
+		}
+	}
+
+	return err
+}
+
+// Wipe - Zeroes transient copies of key material and decrypted values
+func Wipe(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
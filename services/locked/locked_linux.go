@@ -0,0 +1,49 @@
+//go:build linux
+// +build linux
+
+package locked
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// alloc - Anonymous mapping outside of the Go heap, so the garbage collector never copies it
+func alloc(size int) ([]byte, bool, error) {
+	pageSize := os.Getpagesize()
+	length := (size + pageSize - 1) / pageSize * pageSize
+
+	memory, err := unix.Mmap(-1, 0, length, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := unix.Madvise(memory, unix.MADV_DONTDUMP); err != nil {
+		_ = unix.Munmap(memory)
+		return nil, false, err
+	}
+
+	return memory, unix.Mlock(memory) == nil, nil
+}
+
+func free(memory []byte, locked bool) error {
+	if locked {
+		if err := unix.Munlock(memory); err != nil {
+			return err
+		}
+	}
+
+	return unix.Munmap(memory)
+}
+
+// DisableCoreDumps - Process memory (keys in the Go heap included) is never written to core dump
+// and the process cannot be attached to by other processes of the same user
+func DisableCoreDumps() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{}); err != nil {
+		return err
+	}
+
+	return unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+}
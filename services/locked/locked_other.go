@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package locked
+
+// alloc - Memory cannot be locked on this platform, it is still zeroed on Destroy
+func alloc(size int) ([]byte, bool, error) {
+	return make([]byte, size), false, nil
+}
+
+func free([]byte, bool) error {
+	return nil
+}
+
+// DisableCoreDumps - Not supported on this platform
+func DisableCoreDumps() error {
+	return nil
+}
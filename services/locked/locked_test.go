@@ -0,0 +1,59 @@
+package locked
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuffer(t *testing.T) {
+	asserts := require.New(t)
+
+	var wiped [][]byte
+	onWipe = func(memory []byte) {
+		wiped = append(wiped, append([]byte(nil), memory...))
+	}
+	defer func() { onWipe = nil }()
+
+	key := bytes.Repeat([]byte{0xAB}, 32)
+
+	t.Run("MoveWipesSource", func(t *testing.T) {
+		source := append([]byte(nil), key...)
+		b, err := Move(source)
+		asserts.Nil(err)
+		asserts.Equal(key, b.Bytes())
+		asserts.Equal(make([]byte, 32), source)
+		asserts.Nil(b.Destroy())
+	})
+
+	t.Run("DestroyWipesAndReleases", func(t *testing.T) {
+		wiped = nil
+		b, err := Copy(key)
+		asserts.Nil(err)
+		asserts.Len(b.Bytes(), 32)
+
+		asserts.Nil(b.Destroy())
+		asserts.Nil(b.Bytes())
+		asserts.Nil(b.Destroy(), "second destroy does nothing")
+		asserts.Len(wiped, 1)
+		asserts.Equal(make([]byte, len(wiped[0])), wiped[0])
+	})
+
+	t.Run("DestroyAllOnShutdown", func(t *testing.T) {
+		wiped = nil
+		first, err := Copy(key)
+		asserts.Nil(err)
+		second, err := Copy(key[:16])
+		asserts.Nil(err)
+
+		asserts.Nil(DestroyAll())
+		asserts.Nil(first.Bytes())
+		asserts.Nil(second.Bytes())
+		asserts.Len(wiped, 2)
+
+		for _, memory := range wiped {
+			asserts.Equal(make([]byte, len(memory)), memory)
+		}
+	})
+}
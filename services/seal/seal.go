@@ -0,0 +1,315 @@
+// Package seal - Server started with shamir key provider has no secret key until operators
+// submit enough unseal key shares, until then every encryption fails with ErrSealed
+package seal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/kms"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/BrosSquad/vaulguard/services/shamir"
+	"github.com/BrosSquad/vaulguard/utils"
+)
+
+const keysPermission = 0700
+
+var (
+	ErrSealed        = errors.New("vaulguard is sealed")
+	ErrInvalidShares = errors.New("unseal key shares are invalid, submit the shares again")
+	ErrEmptyShare    = errors.New("unseal key share is empty")
+)
+
+// Status - Progress of unsealing
+type Status struct {
+	Sealed    bool `json:"sealed"`
+	Threshold int  `json:"threshold"`
+	Progress  int  `json:"progress"`
+}
+
+// Sealer - Encryption which is usable only after the secret key is unwrapped with unseal key shares.
+// Services are created with the sealer instead of the master key, so they can be built before unsealing
+type Sealer struct {
+	mutex           sync.RWMutex
+	secretKeyPath   string
+	previousKeyPath string
+	threshold       int
+	algorithm       services.Algorithm
+	shares          [][]byte
+	encryption      services.Encryption
+	rotating        bool
+	unsealed        chan struct{}
+}
+
+// New - Sealer for the secret key written by `vaulguard init`, values are sealed with the algorithm once unsealed
+func New(secretKeyPath string, algorithm services.Algorithm) (*Sealer, error) {
+	wrapped, err := ioutil.ReadFile(secretKeyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	threshold, err := kms.UnsealThreshold(wrapped)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealer{
+		secretKeyPath:   secretKeyPath,
+		previousKeyPath: config.PreviousSecretKeyPath(secretKeyPath),
+		threshold:       threshold,
+		algorithm:       algorithm,
+		unsealed:        make(chan struct{}),
+	}, nil
+}
+
+// Unseal - Adds the share, secret key is unwrapped once threshold is reached.
+// When the shares do not unwrap the key, submitted shares are discarded
+func (s *Sealer) Unseal(ctx context.Context, share []byte) (Status, error) {
+	if len(share) == 0 {
+		return s.Status(), ErrEmptyShare
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.encryption != nil {
+		return s.status(), nil
+	}
+
+	for _, submitted := range s.shares {
+		if bytes.Equal(submitted, share) {
+			return s.status(), nil
+		}
+	}
+
+	s.shares = append(s.shares, append([]byte(nil), share...))
+
+	if len(s.shares) < s.threshold {
+		return s.status(), nil
+	}
+
+	err := s.unseal(ctx)
+	s.reset()
+
+	if err != nil {
+		return s.status(), err
+	}
+
+	close(s.unsealed)
+
+	return s.status(), nil
+}
+
+func (s *Sealer) unseal(ctx context.Context) error {
+	unsealKey, err := shamir.Combine(s.shares)
+
+	if err != nil {
+		return ErrInvalidShares
+	}
+
+	defer locked.Wipe(unsealKey)
+
+	manager := kms.NewUnsealKey(unsealKey, s.threshold)
+	key, err := unwrap(ctx, manager, s.secretKeyPath)
+
+	if err != nil {
+		if errors.Is(err, kms.ErrUnwrap) {
+			return ErrInvalidShares
+		}
+
+		return err
+	}
+
+	defer locked.Wipe(key)
+
+	var previousKeys [][]byte
+
+	if utils.FileExists(s.previousKeyPath) {
+		previous, err := unwrap(ctx, manager, s.previousKeyPath)
+
+		if err != nil {
+			return err
+		}
+
+		defer locked.Wipe(previous)
+
+		s.rotating = true
+		previousKeys = append(previousKeys, previous)
+	}
+
+	encryption, err := services.NewKeyedEncryptionWithAlgorithm(s.algorithm, key, previousKeys...)
+
+	if err != nil {
+		return err
+	}
+
+	s.encryption = encryption
+
+	return nil
+}
+
+func (s *Sealer) reset() {
+	for _, share := range s.shares {
+		for i := range share {
+			share[i] = 0
+		}
+	}
+
+	s.shares = nil
+}
+
+func (s *Sealer) Status() Status {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.status()
+}
+
+func (s *Sealer) status() Status {
+	return Status{
+		Sealed:    s.encryption == nil,
+		Threshold: s.threshold,
+		Progress:  len(s.shares),
+	}
+}
+
+func (s *Sealer) Sealed() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.encryption == nil
+}
+
+// Unsealed - Closed once the secret key is unwrapped
+func (s *Sealer) Unsealed() <-chan struct{} {
+	return s.unsealed
+}
+
+// RotationInProgress - Previous key left by `vaulguard keys rotate` was loaded while unsealing
+func (s *Sealer) RotationInProgress() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.rotating
+}
+
+func (s *Sealer) current() (services.Encryption, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.encryption == nil {
+		return nil, ErrSealed
+	}
+
+	return s.encryption, nil
+}
+
+func (s *Sealer) Encrypt(dst, msg []byte) ([]byte, error) {
+	return s.EncryptWithAD(dst, msg, nil)
+}
+
+func (s *Sealer) EncryptString(msg string) ([]byte, error) {
+	return s.EncryptStringWithAD(msg, nil)
+}
+
+func (s *Sealer) Decrypt(dst, msg []byte) ([]byte, error) {
+	return s.DecryptWithAD(dst, msg, nil)
+}
+
+func (s *Sealer) DecryptString(msg []byte) (string, error) {
+	return s.DecryptStringWithAD(msg, nil)
+}
+
+func (s *Sealer) EncryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	encryption, err := s.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.EncryptWithAD(dst, msg, additionalData)
+}
+
+func (s *Sealer) EncryptStringWithAD(msg string, additionalData []byte) ([]byte, error) {
+	encryption, err := s.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.EncryptStringWithAD(msg, additionalData)
+}
+
+func (s *Sealer) DecryptWithAD(dst, msg, additionalData []byte) ([]byte, error) {
+	encryption, err := s.current()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.DecryptWithAD(dst, msg, additionalData)
+}
+
+func (s *Sealer) DecryptStringWithAD(msg, additionalData []byte) (string, error) {
+	encryption, err := s.current()
+
+	if err != nil {
+		return "", err
+	}
+
+	return encryption.DecryptStringWithAD(msg, additionalData)
+}
+
+// Init - Generates the secret key wrapped with new unseal key and returns the unseal key shares,
+// shares are not stored anywhere, losing more than shares - threshold of them loses every secret
+func Init(ctx context.Context, secretKeyPath string, shares, threshold int) ([][]byte, error) {
+	manager, parts, err := kms.GenerateUnsealKey(shares, threshold)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.CreateDirs(keysPermission, filepath.Dir(secretKeyPath)); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(secretKeyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, keysPermission)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	key, err := kms.GenerateSecretKey(ctx, manager, file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Server gets the key only after unsealing
+	for i := range key {
+		key[i] = 0
+	}
+
+	return parts, file.Sync()
+}
+
+func unwrap(ctx context.Context, manager kms.KeyManager, path string) ([]byte, error) {
+	wrapped, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return manager.Unwrap(ctx, wrapped)
+}
@@ -0,0 +1,108 @@
+package seal
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/config"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealer(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	path, err := ioutil.TempDir("", "vaulguard_seal")
+	asserts.Nil(err)
+	defer os.RemoveAll(path)
+
+	secretKeyPath := filepath.Join(path, "keys", "secret.key")
+	shares, err := Init(ctx, secretKeyPath, 5, 3)
+	asserts.Nil(err)
+	asserts.Len(shares, 5)
+
+	_, err = Init(ctx, secretKeyPath, 5, 3)
+	asserts.NotNil(err, "existing secret key must not be overwritten")
+
+	t.Run("SealedUntilThreshold", func(t *testing.T) {
+		sealer, err := New(secretKeyPath, services.DefaultAlgorithm)
+		asserts.Nil(err)
+		asserts.True(sealer.Sealed())
+
+		_, err = sealer.EncryptString("value")
+		asserts.Equal(ErrSealed, err)
+
+		status, err := sealer.Unseal(ctx, shares[4])
+		asserts.Nil(err)
+		asserts.Equal(Status{Sealed: true, Threshold: 3, Progress: 1}, status)
+
+		// Same share twice does not count
+		status, err = sealer.Unseal(ctx, shares[4])
+		asserts.Nil(err)
+		asserts.Equal(1, status.Progress)
+
+		_, err = sealer.Unseal(ctx, shares[1])
+		asserts.Nil(err)
+		status, err = sealer.Unseal(ctx, shares[2])
+		asserts.Nil(err)
+		asserts.Equal(Status{Sealed: false, Threshold: 3}, status)
+		asserts.False(sealer.Sealed())
+
+		select {
+		case <-sealer.Unsealed():
+		default:
+			t.Fatal("unsealed channel is not closed")
+		}
+
+		encrypted, err := sealer.EncryptString("value")
+		asserts.Nil(err)
+		value, err := sealer.DecryptString(encrypted)
+		asserts.Nil(err)
+		asserts.Equal("value", value)
+		asserts.False(sealer.RotationInProgress())
+	})
+
+	t.Run("InvalidShares", func(t *testing.T) {
+		sealer, err := New(secretKeyPath, services.DefaultAlgorithm)
+		asserts.Nil(err)
+
+		other, err := Init(ctx, filepath.Join(path, "other.key"), 5, 3)
+		asserts.Nil(err)
+
+		_, err = sealer.Unseal(ctx, shares[0])
+		asserts.Nil(err)
+		_, err = sealer.Unseal(ctx, shares[1])
+		asserts.Nil(err)
+		status, err := sealer.Unseal(ctx, other[2])
+		asserts.Equal(ErrInvalidShares, err)
+		asserts.Equal(Status{Sealed: true, Threshold: 3}, status)
+
+		_, err = sealer.Unseal(ctx, nil)
+		asserts.Equal(ErrEmptyShare, err)
+	})
+
+	t.Run("PreviousKey", func(t *testing.T) {
+		rotatedPath := filepath.Join(path, "rotated.key")
+		shares, err := Init(ctx, config.PreviousSecretKeyPath(rotatedPath), 3, 2)
+		asserts.Nil(err)
+
+		// Current and previous key are wrapped with the same unseal key after rotation
+		data, err := ioutil.ReadFile(config.PreviousSecretKeyPath(rotatedPath))
+		asserts.Nil(err)
+		asserts.Nil(ioutil.WriteFile(rotatedPath, data, 0600))
+
+		sealer, err := New(rotatedPath, services.DefaultAlgorithm)
+		asserts.Nil(err)
+		_, err = sealer.Unseal(ctx, shares[0])
+		asserts.Nil(err)
+		_, err = sealer.Unseal(ctx, shares[2])
+		asserts.Nil(err)
+		asserts.False(sealer.Sealed())
+		asserts.True(sealer.RotationInProgress())
+	})
+}
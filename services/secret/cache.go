@@ -0,0 +1,261 @@
+package secret
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+)
+
+const (
+	DefaultCacheEntries = 8192
+	DefaultCacheBytes   = 64 << 20
+
+	// cacheEntryOverhead - Rough size of the entry bookkeeping (list element, map slot, dto fields)
+	cacheEntryOverhead = 128
+)
+
+// CacheConfig - Budget is global for all applications, zero TTL keeps entries until evicted
+type CacheConfig struct {
+	MaxEntries int
+	MaxBytes   int64
+	TTL        time.Duration
+}
+
+// CacheStats - Snapshot of the cache counters and current usage
+type CacheStats struct {
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Expirations  uint64 `json:"expirations"`
+	Entries      int    `json:"entries"`
+	Bytes        int64  `json:"bytes"`
+	Applications int    `json:"applications"`
+}
+
+// Cache - LRU of encrypted secrets shared by the SQL and MongoDB services.
+// Entries are indexed per application so a whole application can be dropped at once,
+// while recency and the entry/byte budget are tracked globally across all applications
+type Cache struct {
+	mutex        sync.Mutex
+	config       CacheConfig
+	applications map[interface{}]map[cacheKey]*list.Element
+	order        *list.List
+	bytes        int64
+	hits         uint64
+	misses       uint64
+	evictions    uint64
+	expirations  uint64
+	now          func() time.Time
+	onInvalidate func(applicationID interface{}, environment string, keys []string)
+}
+
+type cacheEntry struct {
+	applicationID interface{}
+	key           cacheKey
+	secret        models.SecretDto
+	size          int64
+	expiresAt     time.Time
+}
+
+// NewCache - Entry and byte budgets lower or equal to zero fall back to defaults
+func NewCache(config CacheConfig) *Cache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultCacheEntries
+	}
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultCacheBytes
+	}
+
+	return &Cache{
+		config:       config,
+		applications: make(map[interface{}]map[cacheKey]*list.Element),
+		order:        list.New(),
+		now:          time.Now,
+	}
+}
+
+func (c *Cache) Get(applicationID interface{}, environment, key string) (models.SecretDto, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.applications[applicationID][cacheKey{environment, key}]
+
+	if !ok {
+		c.misses++
+		return models.SecretDto{}, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		c.expirations++
+		c.misses++
+		return models.SecretDto{}, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+
+	return entry.secret, true
+}
+
+// Set - Adds or replaces secrets of the application, least recently used
+// secrets of any application are evicted until the budget is satisfied
+func (c *Cache) Set(applicationID interface{}, secrets ...models.SecretDto) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, secret := range secrets {
+		c.set(applicationID, secret)
+	}
+}
+
+// OnInvalidate - Hook called after secrets were changed in this process, environment
+// is empty when the whole application is invalidated. Used to notify other processes
+func (c *Cache) OnInvalidate(hook func(applicationID interface{}, environment string, keys []string)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onInvalidate = hook
+}
+
+// Replace - Stores the secret and drops the one stored under the old key (renamed or promoted secret)
+func (c *Cache) Replace(applicationID interface{}, environment, oldKey string, secret models.SecretDto) {
+	c.mutex.Lock()
+
+	if element, ok := c.applications[applicationID][cacheKey{environment, oldKey}]; ok {
+		c.remove(element)
+	}
+
+	c.set(applicationID, secret)
+	c.mutex.Unlock()
+
+	c.notify(applicationID, environment, []string{oldKey})
+
+	if environment != secret.Environment || oldKey != secret.Key {
+		c.notify(applicationID, secret.Environment, []string{secret.Key})
+	}
+}
+
+func (c *Cache) Remove(applicationID interface{}, environment string, keys ...string) {
+	c.Evict(applicationID, environment, keys...)
+	c.notify(applicationID, environment, keys)
+}
+
+func (c *Cache) InvalidateApplication(applicationID interface{}) {
+	c.EvictApplication(applicationID)
+	c.notify(applicationID, "", nil)
+}
+
+// Evict - Removes secrets without calling the hook, used for changes made by other processes
+func (c *Cache) Evict(applicationID interface{}, environment string, keys ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, key := range keys {
+		if element, ok := c.applications[applicationID][cacheKey{environment, key}]; ok {
+			c.remove(element)
+		}
+	}
+}
+
+// EvictApplication - Removes all secrets of the application without calling the hook
+func (c *Cache) EvictApplication(applicationID interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, element := range c.applications[applicationID] {
+		c.remove(element)
+	}
+}
+
+// Purge - Removes every secret from the cache, counters are kept
+func (c *Cache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.applications = make(map[interface{}]map[cacheKey]*list.Element)
+	c.order.Init()
+	c.bytes = 0
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:         c.hits,
+		Misses:       c.misses,
+		Evictions:    c.evictions,
+		Expirations:  c.expirations,
+		Entries:      c.order.Len(),
+		Bytes:        c.bytes,
+		Applications: len(c.applications),
+	}
+}
+
+func (c *Cache) notify(applicationID interface{}, environment string, keys []string) {
+	c.mutex.Lock()
+	hook := c.onInvalidate
+	c.mutex.Unlock()
+
+	if hook != nil {
+		hook(applicationID, environment, keys)
+	}
+}
+
+func (c *Cache) set(applicationID interface{}, secret models.SecretDto) {
+	key := cacheKey{secret.Environment, secret.Key}
+	size := int64(key.size()+len(secret.Value)) + cacheEntryOverhead
+
+	// Secret bigger than the whole budget would only flush everything else
+	if size > c.config.MaxBytes {
+		return
+	}
+
+	if element, ok := c.applications[applicationID][key]; ok {
+		c.remove(element)
+	}
+
+	for c.order.Len() > 0 && (c.order.Len() >= c.config.MaxEntries || c.bytes+size > c.config.MaxBytes) {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+
+	entry := &cacheEntry{
+		applicationID: applicationID,
+		key:           key,
+		secret:        secret,
+		size:          size,
+	}
+
+	if c.config.TTL > 0 {
+		entry.expiresAt = c.now().Add(c.config.TTL)
+	}
+
+	secrets, ok := c.applications[applicationID]
+
+	if !ok {
+		secrets = make(map[cacheKey]*list.Element)
+		c.applications[applicationID] = secrets
+	}
+
+	secrets[key] = c.order.PushFront(entry)
+	c.bytes += size
+}
+
+func (c *Cache) remove(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	c.order.Remove(element)
+	c.bytes -= entry.size
+
+	secrets := c.applications[entry.applicationID]
+	delete(secrets, entry.key)
+
+	if len(secrets) == 0 {
+		delete(c.applications, entry.applicationID)
+	}
+}
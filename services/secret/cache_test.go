@@ -0,0 +1,169 @@
+package secret
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/stretchr/testify/require"
+)
+
+func cacheSecret(key string, size int) models.SecretDto {
+	return models.SecretDto{Key: key, Environment: DefaultEnvironment, Value: make([]byte, size)}
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ApplicationsAreIsolated", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(CacheConfig{})
+
+		cache.Set(uint(1), cacheSecret("A", 1))
+		cache.Set(uint(2048), cacheSecret("A", 2))
+
+		secret, ok := cache.Get(uint(1), DefaultEnvironment, "A")
+		asserts.True(ok)
+		asserts.Len(secret.Value, 1)
+
+		secret, ok = cache.Get(uint(2048), DefaultEnvironment, "A")
+		asserts.True(ok)
+		asserts.Len(secret.Value, 2)
+
+		_, ok = cache.Get(uint(1), "production", "A")
+		asserts.False(ok)
+
+		cache.InvalidateApplication(uint(1))
+		_, ok = cache.Get(uint(1), DefaultEnvironment, "A")
+		asserts.False(ok)
+		_, ok = cache.Get(uint(2048), DefaultEnvironment, "A")
+		asserts.True(ok)
+
+		stats := cache.Stats()
+		asserts.Equal(uint64(3), stats.Hits)
+		asserts.Equal(uint64(2), stats.Misses)
+		asserts.Equal(1, stats.Applications)
+	})
+
+	t.Run("EntryBudgetEvictsLeastRecentlyUsed", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(CacheConfig{MaxEntries: 2})
+
+		cache.Set(uint(1), cacheSecret("A", 1))
+		cache.Set(uint(2), cacheSecret("B", 1))
+		_, _ = cache.Get(uint(1), DefaultEnvironment, "A")
+		cache.Set(uint(3), cacheSecret("C", 1))
+
+		_, ok := cache.Get(uint(2), DefaultEnvironment, "B")
+		asserts.False(ok)
+		_, ok = cache.Get(uint(1), DefaultEnvironment, "A")
+		asserts.True(ok)
+
+		stats := cache.Stats()
+		asserts.Equal(2, stats.Entries)
+		asserts.Equal(uint64(1), stats.Evictions)
+		asserts.Equal(2, stats.Applications)
+	})
+
+	t.Run("ByteBudget", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(CacheConfig{MaxBytes: 3 * (cacheEntryOverhead + 100)})
+
+		for i := 0; i < 5; i++ {
+			cache.Set(uint(1), cacheSecret(fmt.Sprintf("KEY%d", i), 80))
+		}
+
+		stats := cache.Stats()
+		asserts.Equal(3, stats.Entries)
+		asserts.LessOrEqual(stats.Bytes, int64(3*(cacheEntryOverhead+100)))
+
+		// Secret larger than the whole budget is not cached at all
+		cache.Set(uint(1), cacheSecret("HUGE", 4*(cacheEntryOverhead+100)))
+		_, ok := cache.Get(uint(1), DefaultEnvironment, "HUGE")
+		asserts.False(ok)
+		asserts.Equal(3, cache.Stats().Entries)
+	})
+
+	t.Run("EnvironmentAndKeyDoNotCollide", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(CacheConfig{})
+
+		cache.Set(uint(1), models.SecretDto{Environment: "prod", Key: "db/pass", Value: []byte("prod")})
+
+		_, ok := cache.Get(uint(1), "prod/db", "pass")
+		asserts.False(ok)
+
+		cache.Set(uint(1), models.SecretDto{Environment: "prod/db", Key: "pass", Value: []byte("prod/db")})
+
+		secret, ok := cache.Get(uint(1), "prod", "db/pass")
+		asserts.True(ok)
+		asserts.Equal("prod", string(secret.Value))
+		asserts.Equal(2, cache.Stats().Entries)
+	})
+
+	t.Run("ReplaceAndRemove", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(CacheConfig{})
+
+		cache.Set(uint(1), cacheSecret("OLD", 10))
+		cache.Replace(uint(1), DefaultEnvironment, "OLD", cacheSecret("NEW", 10))
+
+		_, ok := cache.Get(uint(1), DefaultEnvironment, "OLD")
+		asserts.False(ok)
+		_, ok = cache.Get(uint(1), DefaultEnvironment, "NEW")
+		asserts.True(ok)
+
+		cache.Set(uint(1), cacheSecret("NEW", 20))
+		asserts.Equal(int64(cacheKey{DefaultEnvironment, "NEW"}.size()+20+cacheEntryOverhead), cache.Stats().Bytes)
+
+		cache.Remove(uint(1), DefaultEnvironment, "NEW")
+		stats := cache.Stats()
+		asserts.Zero(stats.Entries)
+		asserts.Zero(stats.Bytes)
+		asserts.Zero(stats.Applications)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		asserts := require.New(t)
+		now := time.Now()
+		cache := NewCache(CacheConfig{TTL: time.Minute})
+		cache.now = func() time.Time { return now }
+
+		cache.Set(uint(1), cacheSecret("A", 1))
+		now = now.Add(time.Minute)
+
+		_, ok := cache.Get(uint(1), DefaultEnvironment, "A")
+		asserts.False(ok)
+		asserts.Equal(uint64(1), cache.Stats().Expirations)
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(CacheConfig{MaxEntries: 64})
+		wg := sync.WaitGroup{}
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for j := 0; j < 500; j++ {
+					application := uint(j % 4)
+					key := fmt.Sprintf("KEY%d", (worker+j)%100)
+					if _, ok := cache.Get(application, DefaultEnvironment, key); !ok {
+						cache.Set(application, cacheSecret(key, 16))
+					}
+					if j%50 == 0 {
+						cache.InvalidateApplication(application)
+					}
+				}
+			}(i)
+		}
+
+		wg.Wait()
+		stats := cache.Stats()
+		asserts.LessOrEqual(stats.Entries, 64)
+		asserts.Equal(uint64(4000), stats.Hits+stats.Misses)
+	})
+}
@@ -0,0 +1,292 @@
+package secret
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+)
+
+type Format string
+
+const (
+	FormatDotEnv Format = "dotenv"
+	FormatJSON   Format = "json"
+	FormatYAML   Format = "yaml"
+	FormatShell  Format = "shell"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported secrets format (dotenv, json, yaml, shell)")
+	ErrNotFlatMap        = errors.New("secrets file must be a flat map of keys and scalar values")
+	ErrShellNameConflict = errors.New("secret keys are exported as the same shell variable")
+)
+
+// ParseFormat - Format from its name, empty name defaults to dotenv
+func ParseFormat(format string) (Format, error) {
+	switch strings.ToLower(format) {
+	case "", "dotenv", "env":
+		return FormatDotEnv, nil
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "shell", "sh":
+		return FormatShell, nil
+	}
+
+	return "", ErrUnsupportedFormat
+}
+
+// FormatFromFilename - Detects format from file extension, .env and unknown extensions are dotenv
+func FormatFromFilename(filename string) Format {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".sh":
+		return FormatShell
+	}
+
+	return FormatDotEnv
+}
+
+// ContentType - MIME type of the exported secrets format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	case FormatYAML:
+		return "application/x-yaml; charset=utf-8"
+	}
+
+	return "text/plain; charset=utf-8"
+}
+
+// Parse - Reads secrets in the given format into the map of keys and values
+func Parse(format Format, r io.Reader) (map[string]string, error) {
+	switch format {
+	case FormatDotEnv:
+		return parseDotEnv(r)
+	case FormatJSON:
+		data := make(map[string]interface{})
+		if err := json.NewDecoder(r).Decode(&data); err != nil {
+			return nil, err
+		}
+		return flatMap(data)
+	case FormatYAML:
+		data := make(map[string]interface{})
+		if err := yaml.NewDecoder(r).Decode(&data); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return flatMap(data)
+	}
+
+	return nil, ErrUnsupportedFormat
+}
+
+// Writer - Streams secrets in one of the formats, Close must be called
+// after the last batch to finish the document
+type Writer interface {
+	Write(secrets []Secret) error
+	Close() error
+	// Abort - Ends the document with a marker which makes it fail to parse,
+	// export which failed midway must not be read as a complete one
+	Abort(err error) error
+}
+
+type formatWriter struct {
+	format Format
+	out    io.Writer
+	count  int
+	// names - Keys by their shell variable, different keys must not overwrite each other
+	names map[string]string
+}
+
+// NewWriter - Creates writer for the format, dotenv is written for unknown formats
+func NewWriter(format Format, w io.Writer) Writer {
+	return &formatWriter{format: format, out: w}
+}
+
+func (f *formatWriter) Write(secrets []Secret) error {
+	for _, s := range secrets {
+		var line string
+
+		switch f.format {
+		case FormatJSON:
+			key, _ := json.Marshal(s.Key)
+			value, _ := json.Marshal(s.Value)
+			separator := ","
+			if f.count == 0 {
+				separator = "{"
+			}
+			line = fmt.Sprintf("%s\n  %s: %s", separator, key, value)
+		case FormatYAML:
+			// JSON strings are valid YAML double quoted scalars
+			key, _ := json.Marshal(s.Key)
+			value, _ := json.Marshal(s.Value)
+			line = fmt.Sprintf("%s: %s\n", key, value)
+		case FormatShell:
+			name := shellName(s.Key)
+
+			if key, ok := f.names[name]; ok && key != s.Key {
+				return fmt.Errorf("%w: %s and %s as %s", ErrShellNameConflict, key, s.Key, name)
+			}
+
+			if f.names == nil {
+				f.names = make(map[string]string)
+			}
+
+			f.names[name] = s.Key
+			line = fmt.Sprintf("export %s='%s'\n", name, strings.ReplaceAll(s.Value, "'", `'\''`))
+		default:
+			line = fmt.Sprintf("%s=%s\n", s.Key, strconv.Quote(s.Value))
+		}
+
+		if _, err := io.WriteString(f.out, line); err != nil {
+			return err
+		}
+
+		f.count++
+	}
+
+	return nil
+}
+
+func (f *formatWriter) Close() error {
+	if f.format != FormatJSON {
+		return nil
+	}
+
+	end := "\n}\n"
+
+	if f.count == 0 {
+		end = "{}\n"
+	}
+
+	_, err := io.WriteString(f.out, end)
+
+	return err
+}
+
+func (f *formatWriter) Abort(err error) error {
+	// Comment is invalid JSON, the rest of the formats get a line which cannot be parsed
+	marker := "\n# export failed: " + strings.ReplaceAll(err.Error(), "\n", " ") + "\n"
+
+	switch f.format {
+	case FormatJSON:
+	case FormatShell:
+		marker += "echo 'vaulguard: export failed' >&2\nreturn 1 2>/dev/null || exit 1\n"
+	default:
+		marker += "\"export failed\n"
+	}
+
+	_, writeErr := io.WriteString(f.out, marker)
+
+	return writeErr
+}
+
+// shellName - Hierarchical keys are not valid shell variables, every
+// character which cannot be used in variable name is replaced with _
+func shellName(key string) string {
+	name := []byte(key)
+
+	for i, c := range name {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+
+	return string(name)
+}
+
+func flatMap(data map[string]interface{}) (map[string]string, error) {
+	secrets := make(map[string]string, len(data))
+
+	for key, value := range data {
+		switch v := value.(type) {
+		case string:
+			secrets[key] = v
+		case bool, int, int64, uint64, float64, json.Number:
+			secrets[key] = fmt.Sprint(v)
+		case nil:
+			secrets[key] = ""
+		default:
+			return nil, fmt.Errorf("%w: key %s", ErrNotFlatMap, key)
+		}
+	}
+
+	return secrets, nil
+}
+
+func parseDotEnv(r io.Reader) (map[string]string, error) {
+	secrets := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+		separator := strings.Index(line, "=")
+
+		if separator < 1 {
+			return nil, fmt.Errorf("invalid dotenv line %d: expected KEY=VALUE", lineNumber)
+		}
+
+		key := strings.TrimSpace(line[:separator])
+		value, err := dotEnvValue(strings.TrimSpace(line[separator+1:]))
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid dotenv line %d: %v", lineNumber, err)
+		}
+
+		secrets[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+func dotEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch value[0] {
+	case '"':
+		end := strings.LastIndex(value, `"`)
+		if end == 0 {
+			return "", errors.New("unterminated double quoted value")
+		}
+		return strconv.Unquote(value[:end+1])
+	case '\'':
+		end := strings.LastIndex(value, "'")
+		if end == 0 {
+			return "", errors.New("unterminated single quoted value")
+		}
+		return value[1:end], nil
+	}
+
+	// Unquoted value can be followed by an inline comment
+	if i := strings.Index(value, " #"); i != -1 {
+		value = strings.TrimSpace(value[:i])
+	}
+
+	return value, nil
+}
@@ -0,0 +1,139 @@
+package secret
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	t.Run("DotEnv", func(t *testing.T) {
+		data := `
+# Database
+export DB_HOST=localhost
+DB_PORT = 5432
+DB_PASSWORD="p@ss \"word\"\n"
+DB_USER='admin # not a comment'
+DB_NAME=vaulguard # inline comment
+EMPTY=
+`
+		secrets, err := Parse(FormatDotEnv, strings.NewReader(data))
+		asserts.Nil(err)
+		asserts.Equal(map[string]string{
+			"DB_HOST":     "localhost",
+			"DB_PORT":     "5432",
+			"DB_PASSWORD": "p@ss \"word\"\n",
+			"DB_USER":     "admin # not a comment",
+			"DB_NAME":     "vaulguard",
+			"EMPTY":       "",
+		}, secrets)
+	})
+
+	t.Run("DotEnvInvalidLine", func(t *testing.T) {
+		_, err := Parse(FormatDotEnv, strings.NewReader("VALID=1\nINVALID\n"))
+		asserts.NotNil(err)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		secrets, err := Parse(FormatJSON, strings.NewReader(`{"API_KEY": "key", "PORT": 8080, "DEBUG": true}`))
+		asserts.Nil(err)
+		asserts.Equal(map[string]string{"API_KEY": "key", "PORT": "8080", "DEBUG": "true"}, secrets)
+	})
+
+	t.Run("JSONNested", func(t *testing.T) {
+		_, err := Parse(FormatJSON, strings.NewReader(`{"db": {"password": "secret"}}`))
+		asserts.True(errors.Is(err, ErrNotFlatMap))
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		secrets, err := Parse(FormatYAML, strings.NewReader("API_KEY: key\nPORT: 8080\ndb/password: secret\n"))
+		asserts.Nil(err)
+		asserts.Equal(map[string]string{"API_KEY": "key", "PORT": "8080", "db/password": "secret"}, secrets)
+	})
+
+	t.Run("YAMLNested", func(t *testing.T) {
+		_, err := Parse(FormatYAML, strings.NewReader("db:\n  password: secret\n"))
+		asserts.True(errors.Is(err, ErrNotFlatMap))
+	})
+
+	t.Run("FormatDetection", func(t *testing.T) {
+		asserts.Equal(FormatJSON, FormatFromFilename("secrets.json"))
+		asserts.Equal(FormatYAML, FormatFromFilename("secrets.YML"))
+		asserts.Equal(FormatDotEnv, FormatFromFilename(".env"))
+		_, err := ParseFormat("xml")
+		asserts.True(errors.Is(err, ErrUnsupportedFormat))
+	})
+}
+
+func TestWriter(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	batches := [][]Secret{
+		{{Key: "API_KEY", Value: "it's \"key\""}},
+		{{Key: "db/password", Value: "line\nbreak"}},
+	}
+
+	write := func(format Format) string {
+		var buffer bytes.Buffer
+		writer := NewWriter(format, &buffer)
+		for _, batch := range batches {
+			asserts.Nil(writer.Write(batch))
+		}
+		asserts.Nil(writer.Close())
+		return buffer.String()
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		for _, format := range []Format{FormatDotEnv, FormatJSON, FormatYAML} {
+			secrets, err := Parse(format, strings.NewReader(write(format)))
+			asserts.Nil(err)
+			asserts.Equal(map[string]string{"API_KEY": "it's \"key\"", "db/password": "line\nbreak"}, secrets)
+		}
+	})
+
+	t.Run("Shell", func(t *testing.T) {
+		asserts.Equal("export API_KEY='it'\\''s \"key\"'\nexport db_password='line\nbreak'\n", write(FormatShell))
+	})
+
+	t.Run("ShellNameConflict", func(t *testing.T) {
+		writer := NewWriter(FormatShell, ioutil.Discard)
+		asserts.Nil(writer.Write([]Secret{{Key: "db/pass", Value: "first"}}))
+
+		err := writer.Write([]Secret{{Key: "db_pass", Value: "second"}})
+		asserts.True(errors.Is(err, ErrShellNameConflict))
+	})
+
+	t.Run("AbortedDocumentFailsToParse", func(t *testing.T) {
+		for _, format := range []Format{FormatDotEnv, FormatJSON, FormatYAML} {
+			for _, secrets := range [][]Secret{nil, {{Key: "A", Value: "1"}}} {
+				var buffer bytes.Buffer
+				writer := NewWriter(format, &buffer)
+				asserts.Nil(writer.Write(secrets))
+				asserts.Nil(writer.Abort(errors.New("connection\nlost")))
+				asserts.Contains(buffer.String(), "# export failed: connection lost\n")
+
+				_, err := Parse(format, &buffer)
+				asserts.NotNil(err, format)
+			}
+		}
+
+		var buffer bytes.Buffer
+		writer := NewWriter(FormatShell, &buffer)
+		asserts.Nil(writer.Abort(errors.New("connection lost")))
+		asserts.Contains(buffer.String(), "return 1 2>/dev/null || exit 1\n")
+	})
+
+	t.Run("EmptyJSON", func(t *testing.T) {
+		var buffer bytes.Buffer
+		writer := NewWriter(FormatJSON, &buffer)
+		asserts.Nil(writer.Close())
+		asserts.Equal("{}\n", buffer.String())
+	})
+}
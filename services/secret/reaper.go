@@ -0,0 +1,29 @@
+package secret
+
+import (
+	"context"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/log"
+)
+
+// Reap - Periodically hard deletes expired secrets until the context is cancelled
+func Reap(ctx context.Context, service Service, interval time.Duration, logger *log.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			deleted, err := service.DeleteExpired(ctx)
+
+			if err != nil {
+				logger.Errorf(err, "Error while deleting expired secrets\n")
+				continue
+			}
+
+			if deleted > 0 {
+				logger.Debug("Deleted %d expired secrets\n", deleted)
+			}
+		}
+	}
+}
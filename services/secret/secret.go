@@ -2,30 +2,394 @@ package secret
 
 import (
 	"context"
-	"sync"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/gofiber/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// DefaultEnvironment - Environment used when none is requested explicitly
+const DefaultEnvironment = "default"
+
+// DefaultReEncryptBatch - Secrets loaded at once by ReEncrypt when batch size is not set
+const DefaultReEncryptBatch = 500
+
+// MaxReEncryptAttempts - Reads of a secret modified concurrently while ReEncrypt seals it again
+const MaxReEncryptAttempts = 3
+
+// KeySeparator - Separates folders in hierarchical secret keys, e.g. db/primary/password
+const KeySeparator = "/"
+
+// ImportMode - Conflict policy when imported key already exists
+type ImportMode string
+
+const (
+	ImportSkip      ImportMode = "skip"
+	ImportOverwrite ImportMode = "overwrite"
+	ImportFail      ImportMode = "fail"
+)
+
+var (
+	ErrSameEnvironment       = errors.New("source and target environments must differ")
+	ErrInvalidKey            = errors.New("secret key must not start or end with / or contain empty folders")
+	ErrUnsupportedImportMode = errors.New("unsupported import mode (skip, overwrite, fail)")
+	ErrModified              = errors.New("secret was modified concurrently, try again")
+	ErrTransactionsRequired  = errors.New("import and promote require MongoDB replica set or sharded cluster")
+)
+
+type tokenIDKey struct{}
+
 type Secret struct {
 	Key   string
 	Value string
 }
 
+// KeyFilter - Limits listing to keys matching one of the patterns, pattern is an exact key or
+// a prefix ending with * like in token scopes. Nil filter lists every key, empty filter none
+type KeyFilter []string
+
+// Tree - One level of the secret hierarchy under the prefix, folders
+// are full paths ending with KeySeparator and secrets are leaf keys with values
+type Tree struct {
+	Prefix  string
+	Folders []string
+	Secrets map[string]string
+}
+
+// ImportResult - Sorted keys of imported secrets grouped by what happened to them
+type ImportResult struct {
+	Created []string
+	Updated []string
+	Skipped []string
+}
+
+// Version - Metadata of one stored secret version, value is never included
+type Version struct {
+	Version   uint
+	TokenID   interface{}
+	CreatedAt time.Time
+}
+
 type Service interface {
-	Paginate(ctx context.Context, applicationID interface{}, page, perPage int) (map[string]string, error)
-	Get(ctx context.Context, applicationID interface{}, key []string) (map[string]string, error)
-	GetOne(ctx context.Context, applicationID interface{}, key string) (Secret, error)
-	Create(ctx context.Context, applicationID interface{}, key, value string) (models.Secret, error)
-	Update(ctx context.Context, applicationID interface{}, key, newKey, value string) (models.Secret, error)
-	Delete(ctx context.Context, applicationID interface{}, key string) error
+	Paginate(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter KeyFilter, page, perPage int) (map[string]string, error)
+	Tree(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter KeyFilter, page, perPage int) (Tree, error)
+	Get(ctx context.Context, applicationID interface{}, environment string, key []string) (map[string]string, error)
+	GetOne(ctx context.Context, applicationID interface{}, environment, key string) (Secret, error)
+	Create(ctx context.Context, applicationID interface{}, environment, key, value string, expiresAt *time.Time) (models.SecretDto, error)
+	Update(ctx context.Context, applicationID interface{}, environment, key, newKey, value string) (models.SecretDto, error)
+	Delete(ctx context.Context, applicationID interface{}, environment, key string) error
+	Promote(ctx context.Context, applicationID interface{}, from, to string, keys []string) error
+	Import(ctx context.Context, applicationID interface{}, environment string, secrets map[string]string, mode ImportMode) (ImportResult, error)
+	Export(ctx context.Context, applicationID interface{}, environment string, batchSize int, cb func([]Secret) error) error
 	InvalidateCache(ctx context.Context, applicationID interface{}) error
+	Versions(ctx context.Context, applicationID interface{}, environment, key string) ([]Version, error)
+	GetVersion(ctx context.Context, applicationID interface{}, environment, key string, version uint) (Secret, error)
+	Rollback(ctx context.Context, applicationID interface{}, environment, key string, version uint) (models.SecretDto, error)
+	DeleteExpired(ctx context.Context) (int64, error)
+	// ReEncrypt - Seals every secret value and stored version again with the current key,
+	// returns number of re-encrypted values. Used after key rotation, fails with ErrModified
+	// when some secrets kept changing and may still be sealed with the previous key
+	ReEncrypt(ctx context.Context, batchSize int) (int64, error)
 }
 
+// baseService - Encryption and cache shared by the SQL and MongoDB services,
+// cache holds encrypted secrets per application ID
 type baseService struct {
-	mutex             *sync.RWMutex
-	cacheLimit        int
-	cache             [1024]map[string]models.Secret
+	cache             *Cache
+	keys              *datakey.KeyRing
 	encryptionService services.Encryption
+	requireAD         bool
+}
+
+// newBaseService - Nil cache creates private cache limited to cacheSize entries,
+// without key ring every application is encrypted with the master key
+func newBaseService(encryption services.Encryption, keys *datakey.KeyRing, cache *Cache, cacheSize int, requireAD bool) baseService {
+	if cache == nil {
+		cache = NewCache(CacheConfig{MaxEntries: cacheSize})
+	}
+
+	return baseService{
+		cache:             cache,
+		keys:              keys,
+		encryptionService: encryption,
+		requireAD:         requireAD,
+	}
+}
+
+// encryption - Encryption with the data key of the application
+func (b baseService) encryption(ctx context.Context, applicationID interface{}) (services.Encryption, error) {
+	if b.keys == nil {
+		return b.encryptionService, nil
+	}
+
+	return b.keys.Encryption(ctx, applicationID)
+}
+
+// seal - Value is bound to the application, environment and key, moving it to another row makes it undecryptable
+func (b baseService) seal(encryption services.Encryption, applicationID interface{}, environment, key, value string) ([]byte, error) {
+	return encryption.EncryptStringWithAD(value, associatedData(applicationID, environment, key))
+}
+
+// open - Values sealed before values were bound to their row are accepted until AD is required
+func (b baseService) open(encryption services.Encryption, applicationID interface{}, environment, key string, value []byte) (string, error) {
+	decrypted, err := b.openBytes(encryption, applicationID, environment, key, value)
+
+	if err != nil {
+		return "", err
+	}
+
+	return utils.GetString(decrypted), nil
+}
+
+// openBytes - Only values which were never bound are opened without associated data,
+// bound value copied from another row fails like in required mode
+func (b baseService) openBytes(encryption services.Encryption, applicationID interface{}, environment, key string, value []byte) ([]byte, error) {
+	decrypted, err := encryption.DecryptWithAD(nil, value, associatedData(applicationID, environment, key))
+
+	if err == nil || b.requireAD || services.IsBound(value) {
+		return decrypted, err
+	}
+
+	if legacy, legacyErr := encryption.Decrypt(nil, value); legacyErr == nil {
+		return legacy, nil
+	}
+
+	return nil, err
+}
+
+// reencrypt - Opens the value with any loaded key and seals it with the current key of the application
+func (b baseService) reencrypt(ctx context.Context, applicationID interface{}, environment, key string, value []byte) ([]byte, error) {
+	encryption, err := b.encryption(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return b.reseal(encryption, applicationID, environment, key, environment, key, value)
+}
+
+// reseal - Binds the value to another row, used when the secret is renamed or promoted
+func (b baseService) reseal(encryption services.Encryption, applicationID interface{}, fromEnvironment, fromKey, toEnvironment, toKey string, value []byte) ([]byte, error) {
+	decrypted, err := b.openBytes(encryption, applicationID, fromEnvironment, fromKey, value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Plain value exists only while it is sealed again
+	defer locked.Wipe(decrypted)
+
+	return b.seal(encryption, applicationID, toEnvironment, toKey, utils.GetString(decrypted))
+}
+
+func (b baseService) InvalidateCache(_ context.Context, applicationID interface{}) error {
+	b.cache.InvalidateApplication(applicationID)
+	return nil
+}
+
+func (b baseService) cached(applicationID interface{}, environment, key string) (models.SecretDto, bool) {
+	return b.cache.Get(applicationID, environment, key)
+}
+
+func (b baseService) updateCache(applicationID interface{}, secrets []models.SecretDto) {
+	b.cache.Set(applicationID, secrets...)
+}
+
+// replaceInCache - Replaces secret stored under the old key
+func (b baseService) replaceInCache(applicationID interface{}, environment, oldKey string, secret models.SecretDto) {
+	b.cache.Replace(applicationID, environment, oldKey, secret)
+}
+
+func (b baseService) removeFromCache(applicationID interface{}, environment string, keys ...string) {
+	b.cache.Remove(applicationID, environment, keys...)
+}
+
+// WithTokenID - Attaches ID of the token which performs the change,
+// it is recorded as the author of every secret version created with this context
+func WithTokenID(ctx context.Context, tokenID interface{}) context.Context {
+	return context.WithValue(ctx, tokenIDKey{}, tokenID)
+}
+
+func tokenIDFromContext(ctx context.Context) interface{} {
+	return ctx.Value(tokenIDKey{})
+}
+
+// associatedData - Neither application ID nor environment contains a colon, so key may contain anything
+func associatedData(applicationID interface{}, environment, key string) []byte {
+	var id string
+
+	switch v := applicationID.(type) {
+	case uint:
+		id = strconv.FormatUint(uint64(v), 10)
+	case primitive.ObjectID:
+		id = v.Hex()
+	default:
+		id = fmt.Sprint(v)
+	}
+
+	return []byte("vaulguard:secret:" + id + ":" + environment + ":" + key)
+}
+
+// cacheKey - Secret is identified by environment and key together, kept apart
+// so no environment and key pair can be mistaken for another one
+type cacheKey struct {
+	environment string
+	key         string
+}
+
+// size - Bytes of the key accounted in the cache budget
+func (k cacheKey) size() int {
+	return len(k.environment) + len(k.key)
+}
+
+// ValidKey - Reports whether key is a valid flat or hierarchical secret key
+func ValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for _, segment := range strings.Split(key, KeySeparator) {
+		if segment == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NormalizePrefix - Prefix always denotes a folder, so it has to end with KeySeparator
+func NormalizePrefix(prefix string) string {
+	prefix = strings.TrimPrefix(prefix, KeySeparator)
+
+	if prefix != "" && !strings.HasSuffix(prefix, KeySeparator) {
+		prefix += KeySeparator
+	}
+
+	return prefix
+}
+
+// treeLevel - Splits all keys under the prefix into direct child folders and leaf keys,
+// folders come first and both are sorted, only the requested page is returned
+func treeLevel(prefix string, keys []string, page, perPage int) (folders, leaves []string) {
+	seen := make(map[string]struct{})
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		rest := key[len(prefix):]
+
+		if i := strings.Index(rest, KeySeparator); i != -1 {
+			folder := prefix + rest[:i+1]
+			if _, ok := seen[folder]; !ok {
+				seen[folder] = struct{}{}
+				folders = append(folders, folder)
+			}
+		} else {
+			leaves = append(leaves, key)
+		}
+	}
+
+	sort.Strings(folders)
+	sort.Strings(leaves)
+
+	start, end := pageBounds(len(folders)+len(leaves), page, perPage)
+	entries := append(folders, leaves...)[start:end]
+	foldersLen := len(folders)
+
+	folders, leaves = nil, nil
+
+	for i, entry := range entries {
+		if start+i < foldersLen {
+			folders = append(folders, entry)
+		} else {
+			leaves = append(leaves, entry)
+		}
+	}
+
+	return folders, leaves
+}
+
+func pageBounds(total, page, perPage int) (int, int) {
+	if page < 0 {
+		page *= -1
+	}
+
+	if page == 0 {
+		page = 1
+	}
+
+	if perPage <= 0 {
+		return 0, total
+	}
+
+	start := (page - 1) * perPage
+
+	if start > total {
+		start = total
+	}
+
+	end := start + perPage
+
+	if end > total {
+		end = total
+	}
+
+	return start, end
+}
+
+// escapeLike - Escapes LIKE wildcards in prefix, used with ESCAPE '!'
+func escapeLike(prefix string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(prefix)
+}
+
+// ParseImportMode - Import mode from its name, empty name defaults to ImportFail
+func ParseImportMode(mode string) (ImportMode, error) {
+	switch ImportMode(strings.ToLower(mode)) {
+	case "", ImportFail:
+		return ImportFail, nil
+	case ImportSkip:
+		return ImportSkip, nil
+	case ImportOverwrite:
+		return ImportOverwrite, nil
+	}
+
+	return "", ErrUnsupportedImportMode
+}
+
+// uniqueKeys - Keys without repetitions, order of the first occurrence is kept
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]struct{}, len(keys))
+	unique := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
+
+func sortedKeys(secrets map[string]string) []string {
+	keys := make([]string, 0, len(secrets))
+
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
 }
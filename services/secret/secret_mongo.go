@@ -2,10 +2,19 @@ package secret
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"sync"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type mongoService struct {
@@ -13,54 +22,1030 @@ type mongoService struct {
 	client *mongo.Collection
 }
 
+// MongoDBConfig - Cache can be shared between services, CacheSize limits
+// entries of the private cache created when Cache is nil. Keys selects data key of
+// the application, Encryption (master key) is used directly when Keys is nil
 type MongoDBConfig struct {
 	Encryption services.Encryption
+	Keys       *datakey.KeyRing
 	CacheSize  int
-	Collection *mongo.Collection
+	Cache      *Cache
+	// RequireAssociatedData - Rejects values which are not bound to application, environment and key,
+	// enable after ReEncrypt bound all existing values
+	RequireAssociatedData bool
+	Collection            *mongo.Collection
 }
 
-func (m mongoService) Paginate(ctx context.Context, applicationID interface{}, page, perPage int) (map[string]string, error) {
-	panic("implement me")
+// mongoSecret - Document in the secrets collection, versions are embedded
+// so appending a version is atomic with the change of the value
+type mongoSecret struct {
+	ID            primitive.ObjectID   `bson:"_id,omitempty"`
+	Key           string               `bson:"Key"`
+	Environment   string               `bson:"Environment"`
+	ApplicationId primitive.ObjectID   `bson:"ApplicationId"`
+	Value         []byte               `bson:"Value"`
+	Version       uint                 `bson:"Version"`
+	ExpiresAt     *time.Time           `bson:"ExpiresAt"`
+	Versions      []mongoSecretVersion `bson:"Versions,omitempty"`
+	// resealed - Versions were sealed again (secret renamed), save replaces them instead of appending
+	resealed bool
 }
 
-func (m mongoService) Get(ctx context.Context, applicationID interface{}, key []string) (map[string]string, error) {
-	panic("implement me")
+type mongoSecretVersion struct {
+	Version   uint        `bson:"Version"`
+	Value     []byte      `bson:"Value"`
+	TokenId   interface{} `bson:"TokenId,omitempty"`
+	CreatedAt time.Time   `bson:"CreatedAt"`
 }
 
-func (m mongoService) GetOne(ctx context.Context, applicationID interface{}, key string) (Secret, error) {
-	panic("implement me")
+// withoutVersions - Projection used when only the current value is needed
+var withoutVersions = bson.M{"Versions": 0}
+
+func NewMongoClient(config MongoDBConfig) Service {
+	return &mongoService{
+		baseService: newBaseService(config.Encryption, config.Keys, config.Cache, config.CacheSize, config.RequireAssociatedData),
+		client:      config.Collection,
+	}
 }
 
-func (m mongoService) Create(ctx context.Context, applicationID interface{}, key, value string) (models.Secret, error) {
-	panic("implement me")
+func (m mongoService) Paginate(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter KeyFilter, page, perPage int) (map[string]string, error) {
+	var secrets []mongoSecret
+
+	if page < 0 {
+		page *= -1
+	}
+
+	if page == 0 {
+		page = 1
+	}
+
+	findOptions := options.Find().
+		SetProjection(withoutVersions).
+		SetSort(bson.M{"Key": 1})
+
+	if perPage > 0 {
+		findOptions.SetSkip(int64((page - 1) * perPage)).SetLimit(int64(perPage))
+	}
+
+	filter := mongoFilter(applicationID, environment, time.Now(), NormalizePrefix(prefix))
+	mongoKeyFilter(filter, keyFilter)
+
+	cursor, err := m.client.Find(ctx, filter, findOptions)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cursor.All(ctx, &secrets); err != nil {
+		return nil, err
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	secretsDto := make(map[string]string, len(secrets))
+
+	for _, s := range secrets {
+		decryptedValue, err := m.open(encryption, applicationID, environment, s.Key, s.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		secretsDto[s.Key] = decryptedValue
+	}
+
+	return secretsDto, nil
 }
 
-func (m mongoService) Update(ctx context.Context, applicationID interface{}, key, newKey, value string) (models.Secret, error) {
-	panic("implement me")
+func (m mongoService) Tree(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter KeyFilter, page, perPage int) (Tree, error) {
+	var secrets []mongoSecret
+	now := time.Now()
+	prefix = NormalizePrefix(prefix)
+
+	filter := mongoFilter(applicationID, environment, now, prefix)
+	mongoKeyFilter(filter, keyFilter)
+
+	values, err := m.client.Distinct(ctx, "Key", filter)
+
+	if err != nil {
+		return Tree{}, err
+	}
+
+	keys := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if key, ok := value.(string); ok {
+			keys = append(keys, key)
+		}
+	}
+
+	folders, leaves := treeLevel(prefix, keys, page, perPage)
+
+	if len(leaves) > 0 {
+		filter = mongoFilter(applicationID, environment, now, "")
+		filter["Key"] = bson.M{"$in": leaves}
+
+		cursor, err := m.client.Find(ctx, filter, options.Find().SetProjection(withoutVersions))
+
+		if err != nil {
+			return Tree{}, err
+		}
+
+		if err := cursor.All(ctx, &secrets); err != nil {
+			return Tree{}, err
+		}
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return Tree{}, err
+	}
+
+	tree := Tree{
+		Prefix:  prefix,
+		Folders: folders,
+		Secrets: make(map[string]string, len(secrets)),
+	}
+
+	for _, s := range secrets {
+		decryptedValue, err := m.open(encryption, applicationID, environment, s.Key, s.Value)
+		if err != nil {
+			return Tree{}, err
+		}
+
+		tree.Secrets[s.Key] = decryptedValue
+	}
+
+	return tree, nil
 }
 
-func (m mongoService) Delete(ctx context.Context, applicationID interface{}, key string) error {
-	panic("implement me")
+func (m mongoService) Get(ctx context.Context, applicationID interface{}, environment string, keys []string) (map[string]string, error) {
+	var keysToFetch []string
+	now := time.Now()
+	secrets := make([]models.SecretDto, 0, len(keys))
+
+	for _, key := range keys {
+		if s, ok := m.cached(applicationID, environment, key); ok {
+			if !s.Expired(now) {
+				secrets = append(secrets, s)
+			}
+		} else {
+			keysToFetch = append(keysToFetch, key)
+		}
+	}
+
+	if len(keysToFetch) > 0 {
+		var secretsFetch []mongoSecret
+		filter := mongoFilter(applicationID, environment, now, "")
+		filter["Key"] = bson.M{"$in": keysToFetch}
+
+		cursor, err := m.client.Find(ctx, filter, options.Find().SetProjection(withoutVersions))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := cursor.All(ctx, &secretsFetch); err != nil {
+			return nil, err
+		}
+
+		fetched := make([]models.SecretDto, 0, len(secretsFetch))
+		for _, s := range secretsFetch {
+			fetched = append(fetched, s.dto())
+		}
+
+		m.updateCache(applicationID, fetched)
+		secrets = append(secrets, fetched...)
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	dtoSecrets := make(map[string]string, len(keys))
+
+	for _, s := range secrets {
+		decrypted, err := m.open(encryption, applicationID, environment, s.Key, s.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		dtoSecrets[s.Key] = decrypted
+	}
+
+	return dtoSecrets, nil
 }
 
-func (m mongoService) InvalidateCache(ctx context.Context, applicationID interface{}) error {
-	panic("implement me")
+func (m mongoService) GetOne(ctx context.Context, applicationID interface{}, environment, key string) (Secret, error) {
+	now := time.Now()
+	secret, ok := m.cached(applicationID, environment, key)
+
+	if ok {
+		if secret.Expired(now) {
+			return Secret{}, mongo.ErrNoDocuments
+		}
+	} else {
+		var result mongoSecret
+		filter := mongoFilter(applicationID, environment, now, "")
+		filter["Key"] = key
+
+		err := m.client.
+			FindOne(ctx, filter, options.FindOne().SetProjection(withoutVersions)).
+			Decode(&result)
+
+		if err != nil {
+			return Secret{}, err
+		}
+
+		secret = result.dto()
+		m.updateCache(applicationID, []models.SecretDto{secret})
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	decryptedValue, err := m.open(encryption, applicationID, environment, key, secret.Value)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	return Secret{
+		Key:   key,
+		Value: decryptedValue,
+	}, nil
 }
 
-func NewMongoClient(config MongoDBConfig) Service {
-	cacheSize := config.CacheSize
+func (m mongoService) Create(ctx context.Context, applicationID interface{}, environment, key, value string, expiresAt *time.Time) (models.SecretDto, error) {
+	if !ValidKey(key) {
+		return models.SecretDto{}, ErrInvalidKey
+	}
+
+	existing, err := m.findSecret(ctx, applicationID, environment, key, false)
 
-	if cacheSize == 0 {
-		cacheSize = 8191
+	if err == nil {
+		if !existing.dto().Expired(time.Now()) {
+			return models.SecretDto{}, services.ErrAlreadyExists
+		}
+
+		// Expired secret which is not yet reaped is replaced with the new one
+		if _, err := m.client.DeleteOne(ctx, bson.M{"_id": existing.ID}); err != nil {
+			return models.SecretDto{}, err
+		}
+	} else if err != mongo.ErrNoDocuments {
+		return models.SecretDto{}, err
 	}
 
-	return &mongoService{
-		baseService: baseService{
-			mutex:             &sync.RWMutex{},
-			cacheLimit:        cacheSize,
-			cache:             [1024]map[string]models.Secret{},
-			encryptionService: config.Encryption,
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	encrypted, err := m.seal(encryption, applicationID, environment, key, value)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	secret := mongoSecret{
+		Key:           key,
+		Environment:   environment,
+		ApplicationId: applicationID.(primitive.ObjectID),
+		Value:         encrypted,
+		ExpiresAt:     expiresAt,
+	}
+
+	if err := m.save(ctx, &secret); err != nil {
+		return models.SecretDto{}, err
+	}
+
+	return secret.dto(), nil
+}
+
+func (m mongoService) Update(ctx context.Context, applicationID interface{}, environment, key, newKey, value string) (models.SecretDto, error) {
+	if !ValidKey(newKey) {
+		return models.SecretDto{}, ErrInvalidKey
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	encrypted, err := m.seal(encryption, applicationID, environment, newKey, value)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	// Versions are bound to the key as well, renamed secret keeps its history readable
+	secret, err := m.findSecret(ctx, applicationID, environment, key, newKey != key)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	if newKey != key {
+		for i := range secret.Versions {
+			if secret.Versions[i].Value, err = m.reseal(encryption, applicationID, environment, key, environment, newKey, secret.Versions[i].Value); err != nil {
+				return models.SecretDto{}, err
+			}
+		}
+
+		secret.resealed = true
+	}
+
+	secret.Key = newKey
+	secret.Value = encrypted
+
+	if err := m.save(ctx, &secret); err != nil {
+		return models.SecretDto{}, err
+	}
+
+	dto := secret.dto()
+	m.replaceInCache(applicationID, environment, key, dto)
+
+	return dto, nil
+}
+
+func (m mongoService) Delete(ctx context.Context, applicationID interface{}, environment, key string) error {
+	m.removeFromCache(applicationID, environment, key)
+
+	result, err := m.client.DeleteOne(ctx, bson.M{
+		"ApplicationId": applicationID,
+		"Environment":   environment,
+		"Key":           key,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// Promote - Runs in a transaction, fails with ErrTransactionsRequired on standalone MongoDB
+func (m mongoService) Promote(ctx context.Context, applicationID interface{}, from, to string, keys []string) error {
+	var promoted []mongoSecret
+
+	if from == to {
+		return ErrSameEnvironment
+	}
+
+	// Repeated key would be counted twice against the sources found
+	keys = uniqueKeys(keys)
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.transaction(ctx, func(ctx mongo.SessionContext) error {
+		var sources []mongoSecret
+		promoted = promoted[:0]
+
+		filter := mongoFilter(applicationID, from, time.Now(), "")
+		filter["Key"] = bson.M{"$in": keys}
+
+		cursor, err := m.client.Find(ctx, filter, options.Find().SetProjection(withoutVersions))
+
+		if err != nil {
+			return err
+		}
+
+		if err := cursor.All(ctx, &sources); err != nil {
+			return err
+		}
+
+		if len(sources) != len(keys) {
+			return mongo.ErrNoDocuments
+		}
+
+		for _, source := range sources {
+			// Values are bound to their environment, ciphertext of the source cannot be copied
+			value, err := m.reseal(encryption, applicationID, from, source.Key, to, source.Key, source.Value)
+
+			if err != nil {
+				return err
+			}
+
+			target, err := m.findSecret(ctx, applicationID, to, source.Key, false)
+
+			if err == mongo.ErrNoDocuments {
+				target = mongoSecret{
+					Key:           source.Key,
+					Environment:   to,
+					ApplicationId: source.ApplicationId,
+				}
+			} else if err != nil {
+				return err
+			}
+
+			target.Value = value
+			target.ExpiresAt = source.ExpiresAt
+
+			if err := m.save(ctx, &target); err != nil {
+				return err
+			}
+
+			promoted = append(promoted, target)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, target := range promoted {
+		m.replaceInCache(applicationID, to, target.Key, target.dto())
+	}
+
+	return nil
+}
+
+// Import - Runs in a transaction like Promote
+func (m mongoService) Import(ctx context.Context, applicationID interface{}, environment string, secrets map[string]string, mode ImportMode) (ImportResult, error) {
+	var result ImportResult
+	var imported []mongoSecret
+	keys := sortedKeys(secrets)
+
+	for _, key := range keys {
+		if !ValidKey(key) {
+			return ImportResult{}, ErrInvalidKey
+		}
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	err = m.transaction(ctx, func(ctx mongo.SessionContext) error {
+		var existing []mongoSecret
+		now := time.Now()
+		result = ImportResult{}
+		imported = imported[:0]
+
+		cursor, err := m.client.Find(ctx, bson.M{
+			"ApplicationId": applicationID,
+			"Environment":   environment,
+			"Key":           bson.M{"$in": keys},
+		}, options.Find().SetProjection(withoutVersions))
+
+		if err != nil {
+			return err
+		}
+
+		if err := cursor.All(ctx, &existing); err != nil {
+			return err
+		}
+
+		existingMap := make(map[string]mongoSecret, len(existing))
+		var expired []primitive.ObjectID
+
+		for _, s := range existing {
+			if s.dto().Expired(now) {
+				expired = append(expired, s.ID)
+				continue
+			}
+
+			if mode == ImportFail {
+				return services.ErrAlreadyExists
+			}
+
+			existingMap[s.Key] = s
+		}
+
+		// Expired secret which is not yet reaped is replaced like it does not exist
+		if len(expired) > 0 {
+			if _, err := m.client.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": expired}}); err != nil {
+				return err
+			}
+		}
+
+		for _, key := range keys {
+			secret, exists := existingMap[key]
+
+			if exists && mode == ImportSkip {
+				result.Skipped = append(result.Skipped, key)
+				continue
+			}
+
+			if !exists {
+				secret = mongoSecret{
+					Key:           key,
+					Environment:   environment,
+					ApplicationId: applicationID.(primitive.ObjectID),
+				}
+			}
+
+			encrypted, err := m.seal(encryption, applicationID, environment, key, secrets[key])
+
+			if err != nil {
+				return err
+			}
+
+			secret.Value = encrypted
+
+			if err := m.save(ctx, &secret); err != nil {
+				return err
+			}
+
+			if exists {
+				result.Updated = append(result.Updated, key)
+			} else {
+				result.Created = append(result.Created, key)
+			}
+
+			imported = append(imported, secret)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	for _, secret := range imported {
+		m.replaceInCache(applicationID, environment, secret.Key, secret.dto())
+	}
+
+	return result, nil
+}
+
+func (m mongoService) Export(ctx context.Context, applicationID interface{}, environment string, batchSize int, cb func([]Secret) error) error {
+	findOptions := options.Find().
+		SetProjection(withoutVersions).
+		SetSort(bson.M{"Key": 1}).
+		SetBatchSize(int32(batchSize))
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return err
+	}
+
+	cursor, err := m.client.Find(ctx, mongoFilter(applicationID, environment, time.Now(), ""), findOptions)
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+	secrets := make([]Secret, 0, batchSize)
+
+	for cursor.Next(ctx) {
+		var result mongoSecret
+
+		if err := cursor.Decode(&result); err != nil {
+			return err
+		}
+
+		decryptedValue, err := m.open(encryption, applicationID, environment, result.Key, result.Value)
+
+		if err != nil {
+			return err
+		}
+
+		secrets = append(secrets, Secret{Key: result.Key, Value: decryptedValue})
+
+		if len(secrets) == batchSize {
+			if err := cb(secrets); err != nil {
+				return err
+			}
+			secrets = secrets[:0]
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if len(secrets) > 0 {
+		return cb(secrets)
+	}
+
+	return nil
+}
+
+func (m mongoService) Versions(ctx context.Context, applicationID interface{}, environment, key string) ([]Version, error) {
+	secret, err := m.findSecret(ctx, applicationID, environment, key, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(secret.Versions, func(i, j int) bool {
+		return secret.Versions[i].Version > secret.Versions[j].Version
+	})
+
+	versionsDto := make([]Version, 0, len(secret.Versions))
+
+	for _, v := range secret.Versions {
+		versionsDto = append(versionsDto, Version{
+			Version:   v.Version,
+			TokenID:   v.TokenId,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+
+	return versionsDto, nil
+}
+
+func (m mongoService) GetVersion(ctx context.Context, applicationID interface{}, environment, key string, version uint) (Secret, error) {
+	secret, err := m.findSecret(ctx, applicationID, environment, key, true)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	secretVersion, err := secret.version(version)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	encryption, err := m.encryption(ctx, applicationID)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	decryptedValue, err := m.open(encryption, applicationID, environment, secret.Key, secretVersion.Value)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	return Secret{
+		Key:   secret.Key,
+		Value: decryptedValue,
+	}, nil
+}
+
+func (m mongoService) Rollback(ctx context.Context, applicationID interface{}, environment, key string, version uint) (models.SecretDto, error) {
+	secret, err := m.findSecret(ctx, applicationID, environment, key, true)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	secretVersion, err := secret.version(version)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	// Rollback never rewrites history, old value is appended as the newest version
+	secret.Value = secretVersion.Value
+
+	if err := m.save(ctx, &secret); err != nil {
+		return models.SecretDto{}, err
+	}
+
+	dto := secret.dto()
+	m.replaceInCache(applicationID, environment, key, dto)
+
+	return dto, nil
+}
+
+func (m mongoService) DeleteExpired(ctx context.Context) (int64, error) {
+	var expired []mongoSecret
+
+	cursor, err := m.client.Find(ctx, bson.M{
+		"ExpiresAt": bson.M{"$lte": time.Now()},
+	}, options.Find().SetProjection(bson.M{"ApplicationId": 1, "Environment": 1, "Key": 1}))
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := cursor.All(ctx, &expired); err != nil {
+		return 0, err
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(expired))
+
+	for _, s := range expired {
+		ids = append(ids, s.ID)
+	}
+
+	result, err := m.client.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range expired {
+		m.removeFromCache(s.ApplicationId, s.Environment, s.Key)
+	}
+
+	return result.DeletedCount, nil
+}
+
+// ReEncrypt - Value and embedded versions are rewritten at once, secret saved concurrently
+// is read again since its older versions are still sealed with the previous key
+func (m mongoService) ReEncrypt(ctx context.Context, batchSize int) (int64, error) {
+	var reencrypted, modified int64
+	var lastID primitive.ObjectID
+
+	if batchSize <= 0 {
+		batchSize = DefaultReEncryptBatch
+	}
+
+	applications := make(map[primitive.ObjectID]struct{})
+
+	// Cached ciphertexts may reference the retired key, they are dropped in every process
+	defer func() {
+		for applicationID := range applications {
+			m.cache.InvalidateApplication(applicationID)
+		}
+	}()
+
+	for {
+		var secrets []mongoSecret
+
+		findOptions := options.Find().
+			SetProjection(reencryptProjection).
+			SetSort(bson.M{"_id": 1}).
+			SetLimit(int64(batchSize))
+
+		cursor, err := m.client.Find(ctx, bson.M{"_id": bson.M{"$gt": lastID}}, findOptions)
+
+		if err != nil {
+			return reencrypted, err
+		}
+
+		if err := cursor.All(ctx, &secrets); err != nil {
+			return reencrypted, err
+		}
+
+		for _, secret := range secrets {
+			count, err := m.reencryptSecret(ctx, secret)
+
+			if err == ErrModified {
+				modified++
+			} else if err != nil {
+				return reencrypted, err
+			}
+
+			reencrypted += count
+			applications[secret.ApplicationId] = struct{}{}
+		}
+
+		if len(secrets) < batchSize {
+			break
+		}
+
+		lastID = secrets[len(secrets)-1].ID
+	}
+
+	// Rotation must not retire the previous key while any value may still be sealed with it
+	if modified > 0 {
+		return reencrypted, fmt.Errorf("%d secrets were not re-encrypted: %w", modified, ErrModified)
+	}
+
+	return reencrypted, nil
+}
+
+// reencryptProjection - Fields needed to seal the value and versions again
+var reencryptProjection = bson.M{"ApplicationId": 1, "Environment": 1, "Key": 1, "Value": 1, "Version": 1, "Versions": 1}
+
+// reencryptSecret - Fails with ErrModified when the secret keeps changing after MaxReEncryptAttempts reads
+func (m mongoService) reencryptSecret(ctx context.Context, secret mongoSecret) (int64, error) {
+	for attempt := 1; ; attempt++ {
+		value, err := m.reencrypt(ctx, secret.ApplicationId, secret.Environment, secret.Key, secret.Value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		for i := range secret.Versions {
+			if secret.Versions[i].Value, err = m.reencrypt(ctx, secret.ApplicationId, secret.Environment, secret.Key, secret.Versions[i].Value); err != nil {
+				return 0, err
+			}
+		}
+
+		result, err := m.client.UpdateOne(ctx, bson.M{
+			"_id":     secret.ID,
+			"Version": secret.Version,
+		}, bson.M{
+			"$set": bson.M{
+				"Value":    value,
+				"Versions": secret.Versions,
+			},
+		})
+
+		if err != nil {
+			return 0, err
+		}
+
+		if result.MatchedCount > 0 {
+			return int64(1 + len(secret.Versions)), nil
+		}
+
+		if attempt == MaxReEncryptAttempts {
+			return 0, ErrModified
+		}
+
+		var current mongoSecret
+		err = m.client.FindOne(ctx, bson.M{"_id": secret.ID}, options.FindOne().SetProjection(reencryptProjection)).Decode(&current)
+
+		// Deleted secret has nothing left to re-encrypt
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		secret = current
+	}
+}
+
+// transaction - Import and promote write many documents, transactions keep them atomic like in SQL.
+// Standalone MongoDB has no transactions, fn is run again on transient errors
+func (m mongoService) transaction(ctx context.Context, fn func(ctx mongo.SessionContext) error) error {
+	err := m.client.Database().Client().UseSession(ctx, func(session mongo.SessionContext) error {
+		_, err := session.WithTransaction(session, func(session mongo.SessionContext) (interface{}, error) {
+			return nil, fn(session)
+		})
+
+		return err
+	})
+
+	if services.IsTransactionNotSupportedError(err) {
+		return ErrTransactionsRequired
+	}
+
+	return err
+}
+
+func (m mongoService) findSecret(ctx context.Context, applicationID interface{}, environment, key string, versions bool) (mongoSecret, error) {
+	var secret mongoSecret
+	findOptions := options.FindOne()
+
+	if !versions {
+		findOptions.SetProjection(withoutVersions)
+	}
+
+	err := m.client.FindOne(ctx, bson.M{
+		"ApplicationId": applicationID,
+		"Environment":   environment,
+		"Key":           key,
+	}, findOptions).Decode(&secret)
+
+	return secret, err
+}
+
+// save - Inserts new or updates existing secret and appends its next version,
+// update fails with ErrModified when somebody else saved the secret in the meantime
+func (m mongoService) save(ctx context.Context, secret *mongoSecret) error {
+	secret.Version++
+	version := mongoSecretVersion{
+		Version:   secret.Version,
+		Value:     secret.Value,
+		CreatedAt: time.Now(),
+	}
+
+	if id, ok := tokenIDFromContext(ctx).(primitive.ObjectID); ok {
+		version.TokenId = id
+	}
+
+	if secret.ID.IsZero() {
+		secret.Versions = []mongoSecretVersion{version}
+		result, err := m.client.InsertOne(ctx, secret)
+
+		if services.IsDuplicateKeyError(err) {
+			return services.ErrAlreadyExists
+		}
+
+		if err != nil {
+			return err
+		}
+
+		secret.ID = result.InsertedID.(primitive.ObjectID)
+		return nil
+	}
+
+	set := bson.M{
+		"Key":       secret.Key,
+		"Value":     secret.Value,
+		"Version":   secret.Version,
+		"ExpiresAt": secret.ExpiresAt,
+	}
+	update := bson.M{"$set": set}
+
+	if secret.resealed {
+		set["Versions"] = append(secret.Versions, version)
+	} else {
+		update["$push"] = bson.M{"Versions": version}
+	}
+
+	result, err := m.client.UpdateOne(ctx, bson.M{
+		"_id":     secret.ID,
+		"Version": secret.Version - 1,
+	}, update)
+
+	if services.IsDuplicateKeyError(err) {
+		return services.ErrAlreadyExists
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrModified
+	}
+
+	secret.Versions = append(secret.Versions, version)
+
+	return nil
+}
+
+func (s mongoSecret) version(version uint) (mongoSecretVersion, error) {
+	for _, v := range s.Versions {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+
+	return mongoSecretVersion{}, mongo.ErrNoDocuments
+}
+
+func (s mongoSecret) dto() models.SecretDto {
+	return models.SecretDto{
+		ID:            s.ID,
+		Key:           s.Key,
+		Environment:   s.Environment,
+		ApplicationId: s.ApplicationId,
+		Value:         s.Value,
+		Version:       s.Version,
+		ExpiresAt:     s.ExpiresAt,
+	}
+}
+
+// mongoFilter - Filter of secrets in the environment which are not expired,
+// prefix is matched literally
+func mongoFilter(applicationID interface{}, environment string, now time.Time, prefix string) bson.M {
+	filter := bson.M{
+		"ApplicationId": applicationID,
+		"Environment":   environment,
+		"$or": bson.A{
+			bson.M{"ExpiresAt": nil},
+			bson.M{"ExpiresAt": bson.M{"$gt": now}},
 		},
-		client: config.Collection,
 	}
+
+	if prefix != "" {
+		filter["Key"] = bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}
+	}
+
+	return filter
+}
+
+// mongoKeyFilter - Adds condition matching keys of the filter, empty $in matches nothing
+func mongoKeyFilter(filter bson.M, keyFilter KeyFilter) {
+	if keyFilter == nil {
+		return
+	}
+
+	keys := make([]string, 0, len(keyFilter))
+	conditions := bson.A{}
+
+	for _, pattern := range keyFilter {
+		if strings.HasSuffix(pattern, "*") {
+			conditions = append(conditions, bson.M{"Key": bson.M{"$regex": "^" + regexp.QuoteMeta(strings.TrimSuffix(pattern, "*"))}})
+		} else {
+			keys = append(keys, pattern)
+		}
+	}
+
+	filter["$and"] = bson.A{bson.M{"$or": append(conditions, bson.M{"Key": bson.M{"$in": keys}})}}
 }
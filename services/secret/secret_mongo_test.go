@@ -0,0 +1,85 @@
+package secret
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/db"
+	"github.com/BrosSquad/vaulguard/services"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMongoSecretService(t *testing.T) {
+	ctx := context.Background()
+	mongoURI := os.Getenv("VAULGUARD_MONGO_TESTING")
+	if mongoURI == "" {
+		mongoURI = "mongodb://localhost:27017"
+	}
+
+	client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI).SetServerSelectionTimeout(5 * time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Disconnect(ctx)
+
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("MongoDB is not available on %s (set VAULGUARD_MONGO_TESTING): %v", mongoURI, err)
+	}
+
+	database := client.Database("vaulguard_secret_test")
+	defer database.Drop(ctx)
+
+	if err := db.MongoMigrate(ctx, database); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := database.Collection(db.ApplicationMongoCollection).InsertOne(ctx, bson.M{
+		"Name":      "Test Application",
+		"CreatedAt": time.Now(),
+		"UpdatedAt": time.Now(),
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	encryptionService, _ := services.NewSecretKeyEncryption(key)
+	service := NewMongoClient(MongoDBConfig{
+		Encryption: encryptionService,
+		Collection: database.Collection(db.SecretsMongoCollection),
+		CacheSize:  32,
+	})
+
+	var hello bson.M
+
+	if err := client.Database("admin").RunCommand(ctx, bson.M{"isMaster": 1}).Decode(&hello); err != nil {
+		t.Fatal(err)
+	}
+
+	// Import and promote run in transactions, standalone server rejects them
+	if _, ok := hello["setName"]; !ok && hello["msg"] != "isdbgrid" {
+		_, err := service.Import(ctx, result.InsertedID, DefaultEnvironment, map[string]string{"KEY": "value"}, ImportOverwrite)
+
+		if err != ErrTransactionsRequired {
+			t.Fatalf("Expected transactions to be required, GOT: %v", err)
+		}
+
+		t.Skipf("MongoDB on %s is standalone, secret service tests need a replica set", mongoURI)
+	}
+
+	testSecretService(t, service, result.InsertedID, primitive.NewObjectID())
+}
@@ -2,44 +2,50 @@ package secret
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/datakey"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// key is a reserved word in MySQL, so the column is never written into raw SQL,
+// conditions use maps and clauses which gorm quotes for the connected database
+var orderByKey = clause.OrderByColumn{Column: clause.Column{Name: "key"}}
+
 type gormSecretService struct {
 	baseService
 	db *gorm.DB
 }
 
+// GormSecretConfig - Cache can be shared between services, CacheSize limits
+// entries of the private cache created when Cache is nil. Keys selects data key of
+// the application, Encryption (master key) is used directly when Keys is nil
 type GormSecretConfig struct {
 	Encryption services.Encryption
+	Keys       *datakey.KeyRing
 	CacheSize  int
-	DB         *gorm.DB
+	Cache      *Cache
+	// RequireAssociatedData - Rejects values which are not bound to application, environment and key,
+	// enable after ReEncrypt bound all existing values
+	RequireAssociatedData bool
+	DB                    *gorm.DB
 }
 
 func NewGormSecretStorage(config GormSecretConfig) Service {
-	cacheSize := config.CacheSize
-
-	if cacheSize == 0 {
-		cacheSize = 8192
-	}
-
 	return &gormSecretService{
-		baseService: baseService{
-			mutex:             &sync.RWMutex{},
-			cache:             [1024]map[string]models.Secret{},
-			cacheLimit:        cacheSize,
-			encryptionService: config.Encryption,
-		},
-		db: config.DB,
+		baseService: newBaseService(config.Encryption, config.Keys, config.Cache, config.CacheSize, config.RequireAssociatedData),
+		db:          config.DB,
 	}
 }
 
-func (g gormSecretService) Paginate(ctx context.Context, applicationID interface{}, page, perPage int) (map[string]string, error) {
+func (g gormSecretService) Paginate(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter KeyFilter, page, perPage int) (map[string]string, error) {
 	var secrets []models.Secret
 
 	if page < 0 {
@@ -48,7 +54,9 @@ func (g gormSecretService) Paginate(ctx context.Context, applicationID interface
 
 	err := g.db.
 		WithContext(ctx).
-		Where("application_id = ?", applicationID).
+		Scopes(notExpired(time.Now()), withPrefix(NormalizePrefix(prefix)), withKeyFilter(keyFilter)).
+		Where("application_id = ? AND environment = ?", applicationID, environment).
+		Order(orderByKey).
 		Limit(perPage).
 		Offset((page - 1) * perPage).
 		Find(&secrets).Error
@@ -57,10 +65,16 @@ func (g gormSecretService) Paginate(ctx context.Context, applicationID interface
 		return nil, err
 	}
 
+	encryption, err := g.encryption(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
+	}
+
 	secretsDto := make(map[string]string, len(secrets))
 
 	for _, s := range secrets {
-		decryptedValue, err := g.encryptionService.DecryptString(s.Value)
+		decryptedValue, err := g.open(encryption, applicationID, environment, s.Key, s.Value)
 		if err != nil {
 			return nil, err
 		}
@@ -71,62 +85,112 @@ func (g gormSecretService) Paginate(ctx context.Context, applicationID interface
 	return secretsDto, nil
 }
 
-func (g gormSecretService) GetOne(ctx context.Context, applicationID interface{}, key string) (Secret, error) {
-	secret := models.Secret{}
-	value, ok := g.cache[applicationID.(uint)][key]
+func (g gormSecretService) Tree(ctx context.Context, applicationID interface{}, environment, prefix string, keyFilter KeyFilter, page, perPage int) (Tree, error) {
+	var keys []string
+	var secrets []models.Secret
+	now := time.Now()
+	prefix = NormalizePrefix(prefix)
+
+	db := g.db.WithContext(ctx)
+
+	err := db.
+		Model(&models.Secret{}).
+		Scopes(notExpired(now), withPrefix(prefix), withKeyFilter(keyFilter)).
+		Where("application_id = ? AND environment = ?", applicationID, environment).
+		Pluck("key", &keys).Error
+
+	if err != nil {
+		return Tree{}, err
+	}
+
+	folders, leaves := treeLevel(prefix, keys, page, perPage)
+
+	if len(leaves) > 0 {
+		err = db.
+			Scopes(notExpired(now)).
+			Where(map[string]interface{}{"application_id": applicationID, "environment": environment, "key": leaves}).
+			Find(&secrets).Error
 
-	if ok {
-		secret = value
-	} else {
-		err := g.db.WithContext(ctx).Where("key = ? AND application_id = ?", key, applicationID).First(&secret).Error
 		if err != nil {
-			return Secret{}, err
+			return Tree{}, err
 		}
-		go updateSecretCache(&g.baseService, []models.Secret{secret}, applicationID)
 	}
 
-	decryptedValue, err := g.encryptionService.DecryptString(secret.Value)
+	encryption, err := g.encryption(ctx, applicationID)
 
 	if err != nil {
-		return Secret{}, err
+		return Tree{}, err
 	}
 
-	return Secret{
-		Key:   key,
-		Value: decryptedValue,
-	}, nil
+	tree := Tree{
+		Prefix:  prefix,
+		Folders: folders,
+		Secrets: make(map[string]string, len(secrets)),
+	}
+
+	for _, s := range secrets {
+		decryptedValue, err := g.open(encryption, applicationID, environment, s.Key, s.Value)
+		if err != nil {
+			return Tree{}, err
+		}
+
+		tree.Secrets[s.Key] = decryptedValue
+	}
+
+	return tree, nil
 }
 
-func updateSecretCache(g *baseService, secrets []models.Secret, applicationID interface{}) {
+func (g gormSecretService) GetOne(ctx context.Context, applicationID interface{}, environment, key string) (Secret, error) {
+	now := time.Now()
+	secret, ok := g.cached(applicationID, environment, key)
 
-	if len(g.cache) >= g.cacheLimit {
-		return
+	if ok {
+		if secret.Expired(now) {
+			return Secret{}, gorm.ErrRecordNotFound
+		}
+	} else {
+		var result models.Secret
+		err := g.db.
+			WithContext(ctx).
+			Scopes(notExpired(now)).
+			Where(map[string]interface{}{"application_id": applicationID, "environment": environment, "key": key}).
+			First(&result).Error
+		if err != nil {
+			return Secret{}, err
+		}
+		secret = secretDto(result)
+		g.updateCache(applicationID, []models.SecretDto{secret})
 	}
 
-	appId := applicationID.(uint)
+	encryption, err := g.encryption(ctx, applicationID)
 
-	if m := g.cache[appId]; m == nil {
-		g.cache[appId] = make(map[string]models.Secret, g.cacheLimit)
+	if err != nil {
+		return Secret{}, err
 	}
 
-	secretsMap := g.cache[appId]
-	for _, s := range secrets {
-		if _, ok := secretsMap[s.Key]; !ok && len(secretsMap) < g.cacheLimit {
-			g.mutex.Lock()
-			secretsMap[s.Key] = s
-			g.mutex.Unlock()
-		}
+	decryptedValue, err := g.open(encryption, applicationID, environment, key, secret.Value)
+
+	if err != nil {
+		return Secret{}, err
 	}
+
+	return Secret{
+		Key:   key,
+		Value: decryptedValue,
+	}, nil
 }
 
-func (g gormSecretService) Get(ctx context.Context, applicationID interface{}, keys []string) (_ map[string]string, err error) {
+func (g gormSecretService) Get(ctx context.Context, applicationID interface{}, environment string, keys []string) (_ map[string]string, err error) {
 	var keysToFetch []string
+	now := time.Now()
 	keysLen := len(keys)
-	secrets := make([]models.Secret, 0, keysLen)
+	secrets := make([]models.SecretDto, 0, keysLen)
 
 	for _, key := range keys {
-		if s, ok := g.cache[applicationID.(uint)][key]; ok {
-			secrets = append(secrets, s)
+		if s, ok := g.cached(applicationID, environment, key); ok {
+			if !s.Expired(now) {
+				secrets = append(secrets, s)
+			}
 		} else {
 			keysToFetch = append(keysToFetch, key)
 		}
@@ -135,138 +199,817 @@ func (g gormSecretService) Get(ctx context.Context, applicationID interface{}, k
 	if len(keysToFetch) > 0 {
 		log.Printf("Keys to fetch: %d\n", len(keysToFetch))
 		var secretsFetch []models.Secret
-		result := g.db.WithContext(ctx).Where("application_id = ? AND key IN ?", applicationID, keysToFetch).Find(&secretsFetch)
+		result := g.db.
+			WithContext(ctx).
+			Scopes(notExpired(now)).
+			Where(map[string]interface{}{"application_id": applicationID, "environment": environment, "key": keysToFetch}).
+			Find(&secretsFetch)
 
 		if err = result.Error; err != nil {
 			return nil, err
 		}
 
-		go updateSecretCache(&g.baseService, secretsFetch, applicationID)
+		fetched := make([]models.SecretDto, 0, len(secretsFetch))
 		for _, s := range secretsFetch {
-			secrets = append(secrets, s)
+			fetched = append(fetched, secretDto(s))
 		}
+
+		g.updateCache(applicationID, fetched)
+		secrets = append(secrets, fetched...)
+	}
+
+	encryption, err := g.encryption(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
 	}
 
 	dtoSecrets := make(map[string]string, keysLen)
 
 	for i := 0; i < len(secrets); i++ {
-		decrypted, err := g.encryptionService.DecryptString(secrets[i].Value)
+		decrypted, err := g.open(encryption, applicationID, environment, secrets[i].Key, secrets[i].Value)
 		if err != nil {
 			return nil, err
 		}
 
-		dtoSecrets[keys[i]] = decrypted
+		dtoSecrets[secrets[i].Key] = decrypted
 	}
 
 	return dtoSecrets, err
 }
 
-func (g gormSecretService) Create(ctx context.Context, applicationID interface{}, key, value string) (models.Secret, error) {
-	var count int64
+func (g gormSecretService) Create(ctx context.Context, applicationID interface{}, environment, key, value string, expiresAt *time.Time) (models.SecretDto, error) {
+	var existing []models.Secret
 	var secret models.Secret
 
+	if !ValidKey(key) {
+		return models.SecretDto{}, ErrInvalidKey
+	}
+
 	err := g.db.
 		WithContext(ctx).
-		Model(&secret).
-		Where("key = ? AND application_id = ?", key, applicationID).
-		Count(&count).Error
+		Where(map[string]interface{}{"application_id": applicationID, "environment": environment, "key": key}).
+		Limit(1).
+		Find(&existing).Error
 
 	if err != nil {
-		return secret, err
+		return models.SecretDto{}, err
 	}
 
-	if count > 0 {
-		return models.Secret{}, services.ErrAlreadyExists
+	if len(existing) > 0 && !existing[0].Expired(time.Now()) {
+		return models.SecretDto{}, services.ErrAlreadyExists
+	}
+
+	encryption, err := g.encryption(ctx, applicationID)
+
+	if err != nil {
+		return models.SecretDto{}, err
 	}
 
-	encrypted, err := g.encryptionService.EncryptString(value)
+	encrypted, err := g.seal(encryption, applicationID, environment, key, value)
 
 	if err != nil {
-		return models.Secret{}, err
+		return models.SecretDto{}, err
 	}
 
 	secret.Key = key
+	secret.Environment = environment
 	secret.Value = encrypted
+	secret.Version = 1
+	secret.ExpiresAt = expiresAt
 	secret.ApplicationId = applicationID.(uint)
 
-	if err := g.db.Create(&secret).Error; err != nil {
-		return models.Secret{}, err
+	err = g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Expired secret which is not yet reaped is replaced with the new one
+		if len(existing) > 0 {
+			if err := deleteSecrets(tx, existing[0].ID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(&secret).Error; err != nil {
+			return err
+		}
+
+		return createSecretVersion(ctx, tx, secret)
+	})
+
+	if err != nil {
+		return models.SecretDto{}, err
 	}
 
-	return secret, nil
+	return secretDto(secret), nil
 }
 
-func (g gormSecretService) Update(ctx context.Context, applicationID interface{}, key, newKey, value string) (models.Secret, error) {
+func (g gormSecretService) Update(ctx context.Context, applicationID interface{}, environment, key, newKey, value string) (models.SecretDto, error) {
 	secret := models.Secret{}
 	appId := applicationID.(uint)
 
-	db := g.db.WithContext(ctx)
+	if !ValidKey(newKey) {
+		return models.SecretDto{}, ErrInvalidKey
+	}
 
-	db.Begin()
+	encryption, err := g.encryption(ctx, applicationID)
 
-	err := db.
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	encrypted, err := g.seal(encryption, applicationID, environment, newKey, value)
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	err = g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := findSecret(tx, appId, environment, key, &secret); err != nil {
+			return err
+		}
+
+		// Versions are bound to the key as well, renamed secret keeps its history readable
+		if newKey != key {
+			if err := g.resealVersions(tx, encryption, appId, secret.ID, environment, key, newKey); err != nil {
+				return err
+			}
+		}
+
+		secret.Value = encrypted
+		secret.Key = newKey
+		secret.Version++
+
+		if err := tx.Save(&secret).Error; err != nil {
+			return err
+		}
+
+		return createSecretVersion(ctx, tx, secret)
+	})
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	dto := secretDto(secret)
+	g.replaceInCache(applicationID, environment, key, dto)
+
+	return dto, nil
+}
+
+func (g gormSecretService) Delete(ctx context.Context, applicationID interface{}, environment, key string) error {
+	secret := models.Secret{}
+	appId := applicationID.(uint)
+
+	g.removeFromCache(applicationID, environment, key)
+
+	return g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := findSecret(tx, appId, environment, key, &secret); err != nil {
+			return err
+		}
+
+		return deleteSecrets(tx, secret.ID)
+	})
+}
+
+func (g gormSecretService) DeleteExpired(ctx context.Context) (int64, error) {
+	var expired []models.Secret
+
+	err := g.db.
 		WithContext(ctx).
-		Where("key = ? AND application_id = ?", key, appId).
-		Find(&secret).Error
+		Select("id", "application_id", "environment", "key").
+		Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).
+		Find(&expired).Error
 
 	if err != nil {
-		db.Rollback()
-		return secret, err
+		return 0, err
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uint, 0, len(expired))
+
+	for _, s := range expired {
+		ids = append(ids, s.ID)
+	}
+
+	if err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return deleteSecrets(tx, ids...)
+	}); err != nil {
+		return 0, err
+	}
+
+	for _, s := range expired {
+		g.removeFromCache(s.ApplicationId, s.Environment, s.Key)
+	}
+
+	return int64(len(expired)), nil
+}
+
+func (g gormSecretService) Promote(ctx context.Context, applicationID interface{}, from, to string, keys []string) error {
+	var sources []models.Secret
+	var promoted []models.Secret
+	appId := applicationID.(uint)
+
+	if from == to {
+		return ErrSameEnvironment
 	}
 
-	encrypted, err := g.encryptionService.EncryptString(value)
+	// Repeated key would be counted twice against the sources found
+	keys = uniqueKeys(keys)
+
+	encryption, err := g.encryption(ctx, applicationID)
 
 	if err != nil {
-		db.Rollback()
-		return models.Secret{}, err
+		return err
 	}
 
-	secret.Value = encrypted
-	secret.Key = newKey
+	err = g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Scopes(notExpired(time.Now())).
+			Where(map[string]interface{}{"application_id": appId, "environment": from, "key": keys}).
+			Find(&sources).Error
+
+		if err != nil {
+			return err
+		}
+
+		if len(sources) != len(keys) {
+			return gorm.ErrRecordNotFound
+		}
+
+		for _, source := range sources {
+			var targets []models.Secret
+
+			// Values are bound to their environment, ciphertext of the source cannot be copied
+			value, err := g.reseal(encryption, appId, from, source.Key, to, source.Key, source.Value)
 
-	if err := db.Save(&secret).Error; err != nil {
-		db.Rollback()
-		return models.Secret{}, err
+			if err != nil {
+				return err
+			}
+
+			err = tx.
+				Where(map[string]interface{}{"application_id": appId, "environment": to, "key": source.Key}).
+				Limit(1).
+				Find(&targets).Error
+
+			if err != nil {
+				return err
+			}
+
+			target := models.Secret{
+				Key:           source.Key,
+				Environment:   to,
+				ApplicationId: appId,
+			}
+
+			if len(targets) > 0 {
+				target = targets[0]
+			}
+
+			target.Value = value
+			target.ExpiresAt = source.ExpiresAt
+			target.Version++
+
+			if err := tx.Save(&target).Error; err != nil {
+				return err
+			}
+
+			if err := createSecretVersion(ctx, tx, target); err != nil {
+				return err
+			}
+
+			promoted = append(promoted, target)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range promoted {
+		g.replaceInCache(applicationID, to, s.Key, secretDto(s))
 	}
 
-	go func() {
-		// Invalidate the old cache and add the new value to the cache
-		if _, ok := g.cache[appId][key]; ok {
-			g.mutex.Lock()
-			delete(g.cache[appId], key)
-			g.cache[appId][key] = secret
-			g.mutex.Unlock()
+	return nil
+}
+
+func (g gormSecretService) Import(ctx context.Context, applicationID interface{}, environment string, secrets map[string]string, mode ImportMode) (ImportResult, error) {
+	var result ImportResult
+	var existing []models.Secret
+	var changed []models.Secret
+	appId := applicationID.(uint)
+	now := time.Now()
+	keys := sortedKeys(secrets)
+
+	for _, key := range keys {
+		if !ValidKey(key) {
+			return ImportResult{}, ErrInvalidKey
 		}
-	}()
+	}
+
+	encryption, err := g.encryption(ctx, applicationID)
+
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	err = g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Where(map[string]interface{}{"application_id": appId, "environment": environment, "key": keys}).
+			Find(&existing).Error
+
+		if err != nil {
+			return err
+		}
+
+		existingMap := make(map[string]models.Secret, len(existing))
+
+		for _, s := range existing {
+			// Expired secret which is not yet reaped is replaced like it does not exist
+			if s.Expired(now) {
+				if err := deleteSecrets(tx, s.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			existingMap[s.Key] = s
+		}
+
+		for _, key := range keys {
+			secret, exists := existingMap[key]
+
+			if exists {
+				switch mode {
+				case ImportSkip:
+					result.Skipped = append(result.Skipped, key)
+					continue
+				case ImportFail:
+					return services.ErrAlreadyExists
+				}
+			} else {
+				secret = models.Secret{
+					Key:           key,
+					Environment:   environment,
+					ApplicationId: appId,
+				}
+			}
+
+			encrypted, err := g.seal(encryption, applicationID, environment, key, secrets[key])
+
+			if err != nil {
+				return err
+			}
+
+			secret.Value = encrypted
+			secret.Version++
+
+			if err := tx.Save(&secret).Error; err != nil {
+				return err
+			}
+
+			if err := createSecretVersion(ctx, tx, secret); err != nil {
+				return err
+			}
+
+			if exists {
+				result.Updated = append(result.Updated, key)
+			} else {
+				result.Created = append(result.Created, key)
+			}
+
+			changed = append(changed, secret)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	for _, s := range changed {
+		g.replaceInCache(applicationID, environment, s.Key, secretDto(s))
+	}
+
+	return result, nil
+}
+
+func (g gormSecretService) Export(ctx context.Context, applicationID interface{}, environment string, batchSize int, cb func([]Secret) error) error {
+	results := make([]models.Secret, 0, batchSize)
+	secrets := make([]Secret, 0, batchSize)
+	encryption, err := g.encryption(ctx, applicationID)
 
-	if err := db.Commit().Error; err != nil {
-		return models.Secret{}, err
+	if err != nil {
+		return err
+	}
+
+	return g.db.
+		WithContext(ctx).
+		Scopes(notExpired(time.Now())).
+		Where("application_id = ? AND environment = ?", applicationID, environment).
+		Order(orderByKey).
+		FindInBatches(&results, batchSize, func(tx *gorm.DB, batch int) error {
+			secrets = secrets[:0]
+			for _, result := range results {
+				decryptedValue, err := g.open(encryption, applicationID, environment, result.Key, result.Value)
+				if err != nil {
+					return err
+				}
+
+				secrets = append(secrets, Secret{Key: result.Key, Value: decryptedValue})
+			}
+			results = results[:0]
+			return cb(secrets)
+		}).Error
+}
+
+func (g gormSecretService) Versions(ctx context.Context, applicationID interface{}, environment, key string) ([]Version, error) {
+	secret := models.Secret{}
+	var versions []models.SecretVersion
+
+	db := g.db.WithContext(ctx)
+
+	if err := findSecret(db, applicationID.(uint), environment, key, &secret); err != nil {
+		return nil, err
+	}
+
+	err := db.
+		Where("secret_id = ?", secret.ID).
+		Order("version DESC").
+		Find(&versions).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	versionsDto := make([]Version, 0, len(versions))
+
+	for _, v := range versions {
+		var tokenID interface{}
+
+		if v.TokenId != nil {
+			tokenID = *v.TokenId
+		}
+
+		versionsDto = append(versionsDto, Version{
+			Version:   v.Version,
+			TokenID:   tokenID,
+			CreatedAt: v.CreatedAt,
+		})
+	}
+
+	return versionsDto, nil
+}
+
+func (g gormSecretService) GetVersion(ctx context.Context, applicationID interface{}, environment, key string, version uint) (Secret, error) {
+	secret := models.Secret{}
+	secretVersion := models.SecretVersion{}
+
+	db := g.db.WithContext(ctx)
+
+	if err := findSecret(db, applicationID.(uint), environment, key, &secret); err != nil {
+		return Secret{}, err
+	}
+
+	if err := db.Where("secret_id = ? AND version = ?", secret.ID, version).First(&secretVersion).Error; err != nil {
+		return Secret{}, err
+	}
+
+	encryption, err := g.encryption(ctx, applicationID)
+
+	if err != nil {
+		return Secret{}, err
+	}
+
+	decryptedValue, err := g.open(encryption, applicationID, environment, secret.Key, secretVersion.Value)
+
+	if err != nil {
+		return Secret{}, err
 	}
 
-	return secret, nil
+	return Secret{
+		Key:   secret.Key,
+		Value: decryptedValue,
+	}, nil
 }
 
-func (g gormSecretService) Delete(ctx context.Context, applicationID interface{}, key string) error {
+func (g gormSecretService) Rollback(ctx context.Context, applicationID interface{}, environment, key string, version uint) (models.SecretDto, error) {
 	secret := models.Secret{}
 	appId := applicationID.(uint)
 
-	if _, ok := g.cache[appId][key]; ok {
-		g.mutex.Lock()
-		delete(g.cache[appId], key)
-		g.mutex.Unlock()
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		secretVersion := models.SecretVersion{}
+
+		if err := findSecret(tx, appId, environment, key, &secret); err != nil {
+			return err
+		}
+
+		if err := tx.Where("secret_id = ? AND version = ?", secret.ID, version).First(&secretVersion).Error; err != nil {
+			return err
+		}
+
+		// Rollback never rewrites history, old value is appended as the newest version
+		secret.Value = secretVersion.Value
+		secret.Version++
+
+		if err := tx.Save(&secret).Error; err != nil {
+			return err
+		}
+
+		return createSecretVersion(ctx, tx, secret)
+	})
+
+	if err != nil {
+		return models.SecretDto{}, err
+	}
+
+	dto := secretDto(secret)
+	g.replaceInCache(applicationID, environment, key, dto)
+
+	return dto, nil
+}
+
+// ReEncrypt - Secrets and versions are walked by ID, secret saved concurrently
+// is read again since the writer may still seal with the previous key
+func (g gormSecretService) ReEncrypt(ctx context.Context, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultReEncryptBatch
+	}
+
+	applications := make(map[uint]struct{})
+
+	// Cached ciphertexts may reference the retired key, they are dropped in every process
+	defer func() {
+		for applicationID := range applications {
+			g.cache.InvalidateApplication(applicationID)
+		}
+	}()
+
+	secrets, err := g.reencryptSecrets(ctx, batchSize, applications)
+
+	if err != nil {
+		return secrets, err
+	}
+
+	versions, err := g.reencryptVersions(ctx, batchSize)
+
+	return secrets + versions, err
+}
+
+func (g gormSecretService) reencryptSecrets(ctx context.Context, batchSize int, applications map[uint]struct{}) (int64, error) {
+	var reencrypted, modified int64
+	var lastID uint
+	db := g.db.WithContext(ctx)
+
+	for {
+		var secrets []models.Secret
+
+		err := db.
+			Select("id", "application_id", "environment", "key", "version", "value").
+			Where("id > ?", lastID).
+			Order("id").
+			Limit(batchSize).
+			Find(&secrets).Error
+
+		if err != nil {
+			return reencrypted, err
+		}
+
+		for _, s := range secrets {
+			count, err := g.reencryptSecret(ctx, s)
+
+			if err == ErrModified {
+				modified++
+			} else if err != nil {
+				return reencrypted, err
+			}
+
+			reencrypted += count
+			applications[s.ApplicationId] = struct{}{}
+		}
+
+		if len(secrets) < batchSize {
+			break
+		}
+
+		lastID = secrets[len(secrets)-1].ID
+	}
+
+	// Rotation must not retire the previous key while any value may still be sealed with it
+	if modified > 0 {
+		return reencrypted, fmt.Errorf("%d secrets were not re-encrypted: %w", modified, ErrModified)
+	}
+
+	return reencrypted, nil
+}
+
+// reencryptSecret - Fails with ErrModified when the secret keeps changing after MaxReEncryptAttempts reads
+func (g gormSecretService) reencryptSecret(ctx context.Context, secret models.Secret) (int64, error) {
+	db := g.db.WithContext(ctx)
+
+	for attempt := 1; ; attempt++ {
+		value, err := g.reencrypt(ctx, secret.ApplicationId, secret.Environment, secret.Key, secret.Value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		result := db.
+			Model(&models.Secret{}).
+			Where("id = ? AND version = ?", secret.ID, secret.Version).
+			Update("value", value)
+
+		if result.Error != nil {
+			return 0, result.Error
+		}
+
+		if result.RowsAffected > 0 {
+			return result.RowsAffected, nil
+		}
+
+		if attempt == MaxReEncryptAttempts {
+			return 0, ErrModified
+		}
+
+		var current models.Secret
+		err = db.
+			Select("id", "application_id", "environment", "key", "version", "value").
+			Where("id = ?", secret.ID).
+			Take(&current).Error
+
+		// Deleted secret has nothing left to re-encrypt
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		secret = current
+	}
+}
+
+// reencryptVersions - Versions are immutable, only ReEncrypt ever writes them
+func (g gormSecretService) reencryptVersions(ctx context.Context, batchSize int) (int64, error) {
+	type versionValue struct {
+		ID            uint
+		ApplicationId uint
+		Environment   string
+		Key           string
+		Value         []byte
+	}
+
+	var reencrypted int64
+	var lastID uint
+	db := g.db.WithContext(ctx)
+
+	for {
+		var versions []versionValue
+
+		err := db.
+			Model(&models.SecretVersion{}).
+			Select("secret_versions.id, secret_versions.value, secrets.application_id, secrets.environment, secrets.key").
+			Joins("JOIN secrets ON secrets.id = secret_versions.secret_id").
+			Where("secret_versions.id > ?", lastID).
+			Order("secret_versions.id").
+			Limit(batchSize).
+			Scan(&versions).Error
+
+		if err != nil {
+			return reencrypted, err
+		}
+
+		for _, v := range versions {
+			value, err := g.reencrypt(ctx, v.ApplicationId, v.Environment, v.Key, v.Value)
+
+			if err != nil {
+				return reencrypted, err
+			}
+
+			result := db.Model(&models.SecretVersion{}).Where("id = ?", v.ID).Update("value", value)
+
+			if result.Error != nil {
+				return reencrypted, result.Error
+			}
+
+			reencrypted += result.RowsAffected
+		}
+
+		if len(versions) < batchSize {
+			return reencrypted, nil
+		}
+
+		lastID = versions[len(versions)-1].ID
 	}
+}
+
+func (g gormSecretService) resealVersions(tx *gorm.DB, encryption services.Encryption, applicationID, secretID uint, environment, fromKey, toKey string) error {
+	var versions []models.SecretVersion
 
-	if err := g.db.WithContext(ctx).Where("key = ? AND application_id = ?", key, appId).Delete(&secret).Error; err != nil {
+	if err := tx.Where("secret_id = ?", secretID).Find(&versions).Error; err != nil {
 		return err
 	}
 
+	for _, v := range versions {
+		value, err := g.reseal(encryption, applicationID, environment, fromKey, environment, toKey, v.Value)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(&v).Update("value", value).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (g gormSecretService) InvalidateCache(_ context.Context, applicationID interface{}) error {
-	g.mutex.Lock()
-	defer g.mutex.Unlock()
-	appId := applicationID.(uint)
-	g.cache[appId] = nil
-	return nil
+func findSecret(db *gorm.DB, applicationID uint, environment, key string, secret *models.Secret) error {
+	return db.
+		Where(map[string]interface{}{"application_id": applicationID, "environment": environment, "key": key}).
+		First(secret).Error
+}
+
+func notExpired(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(expires_at IS NULL OR expires_at > ?)", now)
+	}
+}
+
+func withPrefix(prefix string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if prefix == "" {
+			return db
+		}
+
+		return db.Where(db.Statement.Quote("key")+" LIKE ? ESCAPE '!'", escapeLike(prefix)+"%")
+	}
+}
+
+// withKeyFilter - Keys are filtered in the query, so pages are filled with matching secrets only
+func withKeyFilter(keyFilter KeyFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if keyFilter == nil {
+			return db
+		}
+
+		if len(keyFilter) == 0 {
+			return db.Where("1 = 0")
+		}
+
+		column := db.Statement.Quote("key")
+		conditions := make([]string, 0, len(keyFilter))
+		args := make([]interface{}, 0, len(keyFilter))
+
+		for _, pattern := range keyFilter {
+			if strings.HasSuffix(pattern, "*") {
+				conditions = append(conditions, column+" LIKE ? ESCAPE '!'")
+				args = append(args, escapeLike(strings.TrimSuffix(pattern, "*"))+"%")
+			} else {
+				conditions = append(conditions, column+" = ?")
+				args = append(args, pattern)
+			}
+		}
+
+		return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+}
+
+func deleteSecrets(db *gorm.DB, ids ...uint) error {
+	if err := db.Where("secret_id IN ?", ids).Delete(&models.SecretVersion{}).Error; err != nil {
+		return err
+	}
+
+	return db.Where("id IN ?", ids).Delete(&models.Secret{}).Error
+}
+
+func createSecretVersion(ctx context.Context, db *gorm.DB, secret models.Secret) error {
+	var tokenID *uint
+
+	if id, ok := tokenIDFromContext(ctx).(uint); ok {
+		tokenID = &id
+	}
+
+	return db.Create(&models.SecretVersion{
+		SecretId: secret.ID,
+		Version:  secret.Version,
+		Value:    secret.Value,
+		TokenId:  tokenID,
+	}).Error
+}
+
+func secretDto(secret models.Secret) models.SecretDto {
+	return models.SecretDto{
+		ID:            secret.ID,
+		Key:           secret.Key,
+		Environment:   secret.Environment,
+		ApplicationId: secret.ApplicationId,
+		Value:         secret.Value,
+		Version:       secret.Version,
+		ExpiresAt:     secret.ExpiresAt,
+	}
 }
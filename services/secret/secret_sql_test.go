@@ -3,17 +3,19 @@ package secret
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"os"
 	"testing"
 
 	"github.com/BrosSquad/vaulguard/models"
 	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func TestNewGormSecretStorage(t *testing.T) {
-	ctx := context.Background()
 	conn, err := gorm.Open(sqlite.Open("secret_test.db"), &gorm.Config{})
 	db, _ := conn.DB()
 
@@ -24,7 +26,7 @@ func TestNewGormSecretStorage(t *testing.T) {
 		return
 	}
 
-	if err := conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}); err != nil {
+	if err := conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -40,87 +42,310 @@ func TestNewGormSecretStorage(t *testing.T) {
 		CacheSize:  32,
 	})
 
-	t.Run("CreateSecret", func(t *testing.T) {
-		value := "mysql://localhost:3306/database"
-		_, err := service.Create(ctx, application.ID, "DATABASE_CONNECTION", value)
+	testSecretService(t, service, application.ID, uint(5))
+}
 
-		if err != nil {
-			t.Fatalf("Error while inserting new secret: %v", err)
-		}
+func TestGormSecretStorageWithDataKeys(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open("secret_datakey_test.db"), &gorm.Config{})
+	db, _ := conn.DB()
 
-		secret, err := service.GetOne(ctx, application.ID, "DATABASE_CONNECTION")
+	defer os.Remove("secret_datakey_test.db")
+	defer db.Close()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
 
-		if err != nil {
-			t.Fatalf("Error while geting secret: %v", err)
-		}
+	if err := conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}); err != nil {
+		t.Fatal(err)
+	}
 
-		if secret.Value != value {
-			t.Fatalf("Expected: %s, GOT: %s", value, secret.Value)
-		}
+	application := models.Application{Name: "Test Application"}
+	conn.Create(&application)
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	encryptionService, _ := services.NewSecretKeyEncryption(key)
+	service := NewGormSecretStorage(GormSecretConfig{
+		Encryption: encryptionService,
+		Keys:       datakey.NewKeyRing(encryptionService, datakey.NewSqlStorage(conn), services.DefaultAlgorithm),
+		DB:         conn,
+		CacheSize:  32,
 	})
 
-	t.Run("MultipleSecretsReturned", func(t *testing.T) {
-		secretsMap := map[string]string{
-			"SECRET_1": "TEST",
-			"SECRET_2": "TEST",
-			"SECRET_3": "TEST",
-			"SECRET_4": "TEST",
-			"SECRET_5": "TEST",
-			"SECRET_6": "TEST",
-			"SECRET_7": "TEST",
-		}
+	testSecretService(t, service, application.ID, uint(5))
+}
 
-		for key, value := range secretsMap {
-			_, err := service.Create(ctx, application.ID, key, value)
-			if err != nil {
-				t.Fatal(err)
-			}
-		}
+func TestGormSecretReEncrypt(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
 
-		secrets, err := service.Get(ctx, application.ID, []string{"SECRET_1", "SECRET_2", "SECRET_6"})
+	conn, err := gorm.Open(sqlite.Open("secret_reencrypt_test.db"), &gorm.Config{})
+	asserts.Nil(err)
+	db, _ := conn.DB()
+	defer os.Remove("secret_reencrypt_test.db")
+	defer db.Close()
 
-		if err != nil {
-			t.Fatalf("Error while fetching secrets: %v\n", err)
-		}
+	asserts.Nil(conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}))
 
-		for key, secret := range secrets {
-			if _, ok := secretsMap[key]; !ok {
-				t.Fatalf("Secret %s does not exist\n", key)
-			}
+	application := models.Application{Name: "Test Application"}
+	asserts.Nil(conn.Create(&application).Error)
 
-			if secret != secretsMap[key] {
-				t.Fatalf("Secret %s does not have the same value as in MAP: %s\n", key, secret)
-			}
-		}
+	oldKey, newKey := make([]byte, 32), make([]byte, 32)
+	_, _ = rand.Read(oldKey)
+	_, _ = rand.Read(newKey)
+
+	oldMaster, err := services.NewKeyedEncryption(oldKey)
+	asserts.Nil(err)
 
+	service := NewGormSecretStorage(GormSecretConfig{
+		Encryption: oldMaster,
+		Keys:       datakey.NewKeyRing(oldMaster, datakey.NewSqlStorage(conn), services.DefaultAlgorithm),
+		DB:         conn,
 	})
 
-	t.Run("UpdateSecret", func(t *testing.T) {
-		value := "mysql://localhost:3306/database"
-		_, err := service.Create(ctx, application.ID, "DATABASE_CONNECTION_2", value)
-		if err != nil {
-			t.Fatalf("Error while inserting new secret: %v", err)
-		}
+	_, err = service.Create(ctx, application.ID, DefaultEnvironment, "DB_PASSWORD", "first", nil)
+	asserts.Nil(err)
+	_, err = service.Update(ctx, application.ID, DefaultEnvironment, "DB_PASSWORD", "DB_PASSWORD", "second")
+	asserts.Nil(err)
 
-		newValue := "postgres://localhost:5432/database"
-		_, err = service.Update(ctx, application.ID, "DATABASE_CONNECTION_2", "DATABASE_CONNECTION_2", newValue)
+	// Value written before data keys existed, sealed directly with the master key
+	legacy, err := oldMaster.EncryptString("legacy")
+	asserts.Nil(err)
+	asserts.Nil(conn.Create(&models.Secret{Key: "LEGACY", Environment: DefaultEnvironment, ApplicationId: application.ID, Value: legacy, Version: 1}).Error)
 
-		if err != nil {
-			t.Fatalf("Error while updating secret: %v", err)
-		}
+	rotatedMaster, err := services.NewKeyedEncryption(newKey, oldKey)
+	asserts.Nil(err)
+	rotatedKeys := datakey.NewKeyRing(rotatedMaster, datakey.NewSqlStorage(conn), services.DefaultAlgorithm)
 
-		secretDecrypted, err := service.GetOne(ctx, application.ID, "DATABASE_CONNECTION_2")
+	rewrapped, err := rotatedKeys.Rewrap(ctx, 1)
+	asserts.Nil(err)
+	asserts.Equal(1, rewrapped)
 
-		if err != nil {
-			t.Fatalf("Secret with name `DATABASE_CONNECTION_2` does not exist: %v", err)
-		}
+	reencrypted, err := NewGormSecretStorage(GormSecretConfig{
+		Encryption: rotatedMaster,
+		Keys:       rotatedKeys,
+		DB:         conn,
+	}).ReEncrypt(ctx, 1)
+	asserts.Nil(err)
+	asserts.Equal(int64(4), reencrypted)
+
+	// Previous key is retired, everything has to be readable with the new key only
+	newMaster, err := services.NewKeyedEncryption(newKey)
+	asserts.Nil(err)
+
+	rotated := NewGormSecretStorage(GormSecretConfig{
+		Encryption: newMaster,
+		Keys:       datakey.NewKeyRing(newMaster, datakey.NewSqlStorage(conn), services.DefaultAlgorithm),
+		DB:         conn,
+	})
+
+	secrets, err := rotated.Get(ctx, application.ID, DefaultEnvironment, []string{"DB_PASSWORD", "LEGACY"})
+	asserts.Nil(err)
+	asserts.Equal(map[string]string{"DB_PASSWORD": "second", "LEGACY": "legacy"}, secrets)
+
+	version, err := rotated.GetVersion(ctx, application.ID, DefaultEnvironment, "DB_PASSWORD", 1)
+	asserts.Nil(err)
+	asserts.Equal("first", version.Value)
+}
+
+func TestGormSecretReEncryptModified(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	conn, err := gorm.Open(sqlite.Open("secret_reencrypt_modified_test.db"), &gorm.Config{})
+	asserts.Nil(err)
+	db, _ := conn.DB()
+	defer os.Remove("secret_reencrypt_modified_test.db")
+	defer db.Close()
 
-		if secretDecrypted.Value != newValue {
-			t.Fatal("Updating secret failed")
+	asserts.Nil(conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}))
+
+	application := models.Application{Name: "Test Application"}
+	asserts.Nil(conn.Create(&application).Error)
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	master, err := services.NewKeyedEncryption(key)
+	asserts.Nil(err)
+
+	service := NewGormSecretStorage(GormSecretConfig{Encryption: master, DB: conn})
+	_, err = service.Create(ctx, application.ID, DefaultEnvironment, "DB_PASSWORD", "value", nil)
+	asserts.Nil(err)
+
+	// Concurrent writer saves the secret right before ReEncrypt writes it
+	saves := 0
+	asserts.Nil(conn.Callback().Update().Before("gorm:begin_transaction").Register("test:concurrent_save", func(tx *gorm.DB) {
+		if saves > 0 {
+			saves--
+			conn.Exec("UPDATE secrets SET version = version + 1")
 		}
+	}))
+
+	// Read again and sealed, value and its stored version
+	saves = 1
+	reencrypted, err := service.ReEncrypt(ctx, 10)
+	asserts.Nil(err)
+	asserts.Equal(int64(2), reencrypted)
+
+	saves = MaxReEncryptAttempts
+	reencrypted, err = service.ReEncrypt(ctx, 10)
+	asserts.True(errors.Is(err, ErrModified))
+	asserts.Equal(int64(0), reencrypted)
+
+	secret, err := service.GetOne(ctx, application.ID, DefaultEnvironment, "DB_PASSWORD")
+	asserts.Nil(err)
+	asserts.Equal("value", secret.Value)
+}
+
+func TestGormSecretAssociatedData(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	conn, err := gorm.Open(sqlite.Open("secret_associated_data_test.db"), &gorm.Config{})
+	asserts.Nil(err)
+	db, _ := conn.DB()
+	defer os.Remove("secret_associated_data_test.db")
+	defer db.Close()
+
+	asserts.Nil(conn.AutoMigrate(&models.Application{}, &models.Token{}, &models.Secret{}, &models.SecretVersion{}))
+
+	first := models.Application{Name: "First"}
+	second := models.Application{Name: "Second"}
+	asserts.Nil(conn.Create(&first).Error)
+	asserts.Nil(conn.Create(&second).Error)
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	master, err := services.NewKeyedEncryption(key)
+	asserts.Nil(err)
+
+	newService := func(requireAD bool) Service {
+		return NewGormSecretStorage(GormSecretConfig{
+			Encryption:            master,
+			DB:                    conn,
+			RequireAssociatedData: requireAD,
+		})
+	}
+
+	service := newService(false)
+
+	t.Run("SwappedValueIsRejected", func(t *testing.T) {
+		asserts := require.New(t)
+		_, err := service.Create(ctx, first.ID, DefaultEnvironment, "API_KEY", "first-api-key", nil)
+		asserts.Nil(err)
+		_, err = service.Create(ctx, first.ID, DefaultEnvironment, "DB_PASSWORD", "first-db-password", nil)
+		asserts.Nil(err)
+		_, err = service.Create(ctx, second.ID, DefaultEnvironment, "API_KEY", "second-api-key", nil)
+		asserts.Nil(err)
+
+		var apiKey models.Secret
+		asserts.Nil(findSecret(conn, first.ID, DefaultEnvironment, "API_KEY", &apiKey))
 
-		if secretDecrypted.Value == value {
-			t.Fatal("Secret remained the same value as before")
+		// Same key of another application and another key of the same application
+		asserts.Nil(conn.Model(&models.Secret{}).Where("application_id = ? AND key = ?", second.ID, "API_KEY").Update("value", apiKey.Value).Error)
+		asserts.Nil(conn.Model(&models.Secret{}).Where("application_id = ? AND key = ?", first.ID, "DB_PASSWORD").Update("value", apiKey.Value).Error)
+
+		_, err = newService(false).GetOne(ctx, second.ID, DefaultEnvironment, "API_KEY")
+		asserts.NotNil(err)
+		_, err = newService(false).GetOne(ctx, first.ID, DefaultEnvironment, "DB_PASSWORD")
+		asserts.NotNil(err)
+	})
+
+	t.Run("SwappedBoundRowsFailInOptionalMode", func(t *testing.T) {
+		asserts := require.New(t)
+		_, err := service.Create(ctx, first.ID, "staging", "API_KEY", "staging-api-key", nil)
+		asserts.Nil(err)
+		_, err = service.Create(ctx, first.ID, "staging", "DB_PASSWORD", "staging-db-password", nil)
+		asserts.Nil(err)
+
+		var apiKey, dbPassword models.Secret
+		asserts.Nil(findSecret(conn, first.ID, "staging", "API_KEY", &apiKey))
+		asserts.Nil(findSecret(conn, first.ID, "staging", "DB_PASSWORD", &dbPassword))
+		asserts.True(services.IsBound(apiKey.Value))
+		asserts.True(services.IsBound(dbPassword.Value))
+
+		apiKeyValue, dbPasswordValue := apiKey.Value, dbPassword.Value
+		asserts.Nil(conn.Model(&apiKey).Update("value", dbPasswordValue).Error)
+		asserts.Nil(conn.Model(&dbPassword).Update("value", apiKeyValue).Error)
+
+		// Bound values are never opened without their associated data, even before AD is required
+		for _, key := range []string{"API_KEY", "DB_PASSWORD"} {
+			_, err = newService(false).GetOne(ctx, first.ID, "staging", key)
+			asserts.NotNil(err, key)
 		}
 	})
+
+	t.Run("ValueMovedToAnotherEnvironmentIsRejected", func(t *testing.T) {
+		asserts := require.New(t)
+		_, err := service.Create(ctx, first.ID, DefaultEnvironment, "SMTP_PASSWORD", "default-smtp", nil)
+		asserts.Nil(err)
+		_, err = service.Create(ctx, first.ID, "staging", "SMTP_PASSWORD", "staging-smtp", nil)
+		asserts.Nil(err)
+
+		var smtp models.Secret
+		asserts.Nil(findSecret(conn, first.ID, DefaultEnvironment, "SMTP_PASSWORD", &smtp))
+		asserts.Nil(conn.Model(&models.Secret{}).Where("application_id = ? AND environment = ? AND key = ?", first.ID, "staging", "SMTP_PASSWORD").Update("value", smtp.Value).Error)
+
+		_, err = newService(false).GetOne(ctx, first.ID, "staging", "SMTP_PASSWORD")
+		asserts.NotNil(err)
+		asserts.Nil(service.Delete(ctx, first.ID, "staging", "SMTP_PASSWORD"))
+
+		// Promoted value is sealed again for the target environment
+		asserts.Nil(service.Promote(ctx, first.ID, DefaultEnvironment, "production", []string{"SMTP_PASSWORD"}))
+
+		secret, err := newService(true).GetOne(ctx, first.ID, "production", "SMTP_PASSWORD")
+		asserts.Nil(err)
+		asserts.Equal("default-smtp", secret.Value)
+
+		version, err := newService(true).GetVersion(ctx, first.ID, "production", "SMTP_PASSWORD", 1)
+		asserts.Nil(err)
+		asserts.Equal("default-smtp", version.Value)
+	})
+
+	t.Run("RenamedSecretKeepsVersions", func(t *testing.T) {
+		asserts := require.New(t)
+		_, err := service.Create(ctx, first.ID, DefaultEnvironment, "OLD_NAME", "first", nil)
+		asserts.Nil(err)
+		_, err = service.Update(ctx, first.ID, DefaultEnvironment, "OLD_NAME", "NEW_NAME", "second")
+		asserts.Nil(err)
+
+		version, err := service.GetVersion(ctx, first.ID, DefaultEnvironment, "NEW_NAME", 1)
+		asserts.Nil(err)
+		asserts.Equal("first", version.Value)
+
+		_, err = service.Rollback(ctx, first.ID, DefaultEnvironment, "NEW_NAME", 1)
+		asserts.Nil(err)
+
+		secret, err := newService(true).GetOne(ctx, first.ID, DefaultEnvironment, "NEW_NAME")
+		asserts.Nil(err)
+		asserts.Equal("first", secret.Value)
+	})
+
+	t.Run("LegacyValueMigration", func(t *testing.T) {
+		asserts := require.New(t)
+		legacy, err := master.EncryptString("legacy")
+		asserts.Nil(err)
+		asserts.Nil(conn.Create(&models.Secret{Key: "LEGACY", Environment: DefaultEnvironment, ApplicationId: second.ID, Value: legacy, Version: 1}).Error)
+
+		secret, err := newService(false).GetOne(ctx, second.ID, DefaultEnvironment, "LEGACY")
+		asserts.Nil(err)
+		asserts.Equal("legacy", secret.Value)
+
+		_, err = newService(true).GetOne(ctx, second.ID, DefaultEnvironment, "LEGACY")
+		asserts.NotNil(err)
+
+		// Swapped values from the first subtest cannot be bound either
+		asserts.Nil(conn.Where("key IN ?", []string{"API_KEY", "DB_PASSWORD"}).Delete(&models.Secret{}).Error)
+
+		_, err = newService(false).ReEncrypt(ctx, 2)
+		asserts.Nil(err)
+
+		secret, err = newService(true).GetOne(ctx, second.ID, DefaultEnvironment, "LEGACY")
+		asserts.Nil(err)
+		asserts.Equal("legacy", secret.Value)
+	})
 }
@@ -0,0 +1,518 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/services"
+	"go.mongodb.org/mongo-driver/mongo"
+	"gorm.io/gorm"
+)
+
+func isNotFound(err error) bool {
+	return errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// testSecretService - Scenarios every storage backend has to pass, tokenID is
+// an ID of the token in the same storage
+func testSecretService(t *testing.T, service Service, applicationID, tokenID interface{}) {
+	ctx := context.Background()
+
+	t.Run("CreateSecret", func(t *testing.T) {
+		value := "mysql://localhost:3306/database"
+		_, err := service.Create(ctx, applicationID, DefaultEnvironment, "DATABASE_CONNECTION", value, nil)
+
+		if err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		secret, err := service.GetOne(ctx, applicationID, DefaultEnvironment, "DATABASE_CONNECTION")
+
+		if err != nil {
+			t.Fatalf("Error while geting secret: %v", err)
+		}
+
+		if secret.Value != value {
+			t.Fatalf("Expected: %s, GOT: %s", value, secret.Value)
+		}
+	})
+
+	t.Run("MultipleSecretsReturned", func(t *testing.T) {
+		secretsMap := map[string]string{
+			"SECRET_1": "TEST",
+			"SECRET_2": "TEST",
+			"SECRET_3": "TEST",
+			"SECRET_4": "TEST",
+			"SECRET_5": "TEST",
+			"SECRET_6": "TEST",
+			"SECRET_7": "TEST",
+		}
+
+		for key, value := range secretsMap {
+			_, err := service.Create(ctx, applicationID, DefaultEnvironment, key, value, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		secrets, err := service.Get(ctx, applicationID, DefaultEnvironment, []string{"SECRET_1", "SECRET_2", "SECRET_6"})
+
+		if err != nil {
+			t.Fatalf("Error while fetching secrets: %v\n", err)
+		}
+
+		for key, secret := range secrets {
+			if _, ok := secretsMap[key]; !ok {
+				t.Fatalf("Secret %s does not exist\n", key)
+			}
+
+			if secret != secretsMap[key] {
+				t.Fatalf("Secret %s does not have the same value as in MAP: %s\n", key, secret)
+			}
+		}
+
+	})
+
+	t.Run("UpdateSecret", func(t *testing.T) {
+		value := "mysql://localhost:3306/database"
+		_, err := service.Create(ctx, applicationID, DefaultEnvironment, "DATABASE_CONNECTION_2", value, nil)
+		if err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		newValue := "postgres://localhost:5432/database"
+		_, err = service.Update(ctx, applicationID, DefaultEnvironment, "DATABASE_CONNECTION_2", "DATABASE_CONNECTION_2", newValue)
+
+		if err != nil {
+			t.Fatalf("Error while updating secret: %v", err)
+		}
+
+		secretDecrypted, err := service.GetOne(ctx, applicationID, DefaultEnvironment, "DATABASE_CONNECTION_2")
+
+		if err != nil {
+			t.Fatalf("Secret with name `DATABASE_CONNECTION_2` does not exist: %v", err)
+		}
+
+		if secretDecrypted.Value != newValue {
+			t.Fatal("Updating secret failed")
+		}
+
+		if secretDecrypted.Value == value {
+			t.Fatal("Secret remained the same value as before")
+		}
+	})
+
+	t.Run("VersionsAndRollback", func(t *testing.T) {
+		tokenCtx := WithTokenID(ctx, tokenID)
+		_, err := service.Create(tokenCtx, applicationID, DefaultEnvironment, "VERSIONED", "first", nil)
+		if err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		_, err = service.Update(tokenCtx, applicationID, DefaultEnvironment, "VERSIONED", "VERSIONED", "second")
+		if err != nil {
+			t.Fatalf("Error while updating secret: %v", err)
+		}
+
+		versions, err := service.Versions(ctx, applicationID, DefaultEnvironment, "VERSIONED")
+		if err != nil {
+			t.Fatalf("Error while listing versions: %v", err)
+		}
+
+		if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 1 {
+			t.Fatalf("Expected versions 2 and 1, GOT: %v", versions)
+		}
+
+		if versions[0].TokenID != tokenID {
+			t.Fatalf("Expected version author %v, GOT: %v", tokenID, versions[0].TokenID)
+		}
+
+		old, err := service.GetVersion(ctx, applicationID, DefaultEnvironment, "VERSIONED", 1)
+		if err != nil {
+			t.Fatalf("Error while getting version: %v", err)
+		}
+
+		if old.Value != "first" {
+			t.Fatalf("Expected: first, GOT: %s", old.Value)
+		}
+
+		rolledBack, err := service.Rollback(ctx, applicationID, DefaultEnvironment, "VERSIONED", 1)
+		if err != nil {
+			t.Fatalf("Error while rolling back secret: %v", err)
+		}
+
+		if rolledBack.Version != 3 {
+			t.Fatalf("Rollback should create version 3, GOT: %d", rolledBack.Version)
+		}
+
+		current, err := service.GetOne(ctx, applicationID, DefaultEnvironment, "VERSIONED")
+		if err != nil {
+			t.Fatalf("Error while geting secret: %v", err)
+		}
+
+		if current.Value != "first" {
+			t.Fatalf("Expected: first, GOT: %s", current.Value)
+		}
+
+		if _, err := service.GetVersion(ctx, applicationID, DefaultEnvironment, "VERSIONED", 10); !isNotFound(err) {
+			t.Fatalf("Expected record not found, GOT: %v", err)
+		}
+	})
+
+	t.Run("ExpiredSecrets", func(t *testing.T) {
+		expiresAt := time.Now().Add(-time.Minute)
+		_, err := service.Create(ctx, applicationID, DefaultEnvironment, "EXPIRED", "expired", &expiresAt)
+		if err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		if _, err := service.GetOne(ctx, applicationID, DefaultEnvironment, "EXPIRED"); !isNotFound(err) {
+			t.Fatalf("Expired secret should not be found, GOT: %v", err)
+		}
+
+		secrets, err := service.Get(ctx, applicationID, DefaultEnvironment, []string{"EXPIRED"})
+		if err != nil {
+			t.Fatalf("Error while fetching secrets: %v", err)
+		}
+
+		if _, ok := secrets["EXPIRED"]; ok {
+			t.Fatal("Expired secret returned from Get")
+		}
+
+		secrets, err = service.Paginate(ctx, applicationID, DefaultEnvironment, "", nil, 1, 100)
+		if err != nil {
+			t.Fatalf("Error while paginating secrets: %v", err)
+		}
+
+		if _, ok := secrets["EXPIRED"]; ok {
+			t.Fatal("Expired secret returned from Paginate")
+		}
+
+		deleted, err := service.DeleteExpired(ctx)
+		if err != nil {
+			t.Fatalf("Error while deleting expired secrets: %v", err)
+		}
+
+		if deleted != 1 {
+			t.Fatalf("Expected 1 deleted secret, GOT: %d", deleted)
+		}
+
+		if _, err := service.Versions(ctx, applicationID, DefaultEnvironment, "EXPIRED"); !isNotFound(err) {
+			t.Fatalf("Expired secret should be hard deleted, GOT: %v", err)
+		}
+	})
+
+	t.Run("CreateReplacesExpiredSecret", func(t *testing.T) {
+		expiresAt := time.Now().Add(-time.Minute)
+		_, err := service.Create(ctx, applicationID, DefaultEnvironment, "REPLACED", "old", &expiresAt)
+		if err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		expiresAt = time.Now().Add(time.Hour)
+		_, err = service.Create(ctx, applicationID, DefaultEnvironment, "REPLACED", "new", &expiresAt)
+		if err != nil {
+			t.Fatalf("Expired secret should be replaced: %v", err)
+		}
+
+		secret, err := service.GetOne(ctx, applicationID, DefaultEnvironment, "REPLACED")
+		if err != nil {
+			t.Fatalf("Error while geting secret: %v", err)
+		}
+
+		if secret.Value != "new" {
+			t.Fatalf("Expected: new, GOT: %s", secret.Value)
+		}
+	})
+
+	t.Run("SameKeyInDifferentEnvironments", func(t *testing.T) {
+		_, err := service.Create(ctx, applicationID, "dev", "API_KEY", "dev-key", nil)
+		if err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		_, err = service.Create(ctx, applicationID, "prod", "API_KEY", "prod-key", nil)
+		if err != nil {
+			t.Fatalf("Same key should be allowed in another environment: %v", err)
+		}
+
+		dev, err := service.GetOne(ctx, applicationID, "dev", "API_KEY")
+		if err != nil {
+			t.Fatalf("Error while geting secret: %v", err)
+		}
+
+		prod, err := service.GetOne(ctx, applicationID, "prod", "API_KEY")
+		if err != nil {
+			t.Fatalf("Error while geting secret: %v", err)
+		}
+
+		if dev.Value != "dev-key" || prod.Value != "prod-key" {
+			t.Fatalf("Environments are mixed up, dev: %s, prod: %s", dev.Value, prod.Value)
+		}
+
+		if _, err := service.GetOne(ctx, applicationID, DefaultEnvironment, "API_KEY"); !isNotFound(err) {
+			t.Fatalf("Secret should not exist in default environment, GOT: %v", err)
+		}
+	})
+
+	t.Run("Promote", func(t *testing.T) {
+		for key, value := range map[string]string{"PROMOTE_1": "staging-1", "PROMOTE_2": "staging-2"} {
+			if _, err := service.Create(ctx, applicationID, "staging", key, value, nil); err != nil {
+				t.Fatalf("Error while inserting new secret: %v", err)
+			}
+		}
+
+		if _, err := service.Create(ctx, applicationID, "production", "PROMOTE_1", "production-1", nil); err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		if err := service.Promote(ctx, applicationID, "staging", "production", []string{"PROMOTE_1", "PROMOTE_2"}); err != nil {
+			t.Fatalf("Error while promoting secrets: %v", err)
+		}
+
+		secrets, err := service.Get(ctx, applicationID, "production", []string{"PROMOTE_1", "PROMOTE_2"})
+		if err != nil {
+			t.Fatalf("Error while fetching secrets: %v", err)
+		}
+
+		if secrets["PROMOTE_1"] != "staging-1" || secrets["PROMOTE_2"] != "staging-2" {
+			t.Fatalf("Secrets are not promoted: %v", secrets)
+		}
+
+		versions, err := service.Versions(ctx, applicationID, "production", "PROMOTE_1")
+		if err != nil {
+			t.Fatalf("Error while listing versions: %v", err)
+		}
+
+		if len(versions) != 2 {
+			t.Fatalf("Promotion should append a version, GOT: %d versions", len(versions))
+		}
+	})
+
+	t.Run("PromoteDuplicateKeys", func(t *testing.T) {
+		if err := service.Promote(ctx, applicationID, "staging", "duplicates", []string{"PROMOTE_1", "PROMOTE_1"}); err != nil {
+			t.Fatalf("Repeated key should be promoted once, GOT: %v", err)
+		}
+
+		if _, err := service.GetOne(ctx, applicationID, "duplicates", "PROMOTE_1"); err != nil {
+			t.Fatalf("Secret should be promoted, GOT: %v", err)
+		}
+	})
+
+	t.Run("PromoteIsAtomic", func(t *testing.T) {
+		if _, err := service.Create(ctx, applicationID, "staging", "ATOMIC_1", "value", nil); err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		err := service.Promote(ctx, applicationID, "staging", "production", []string{"ATOMIC_1", "MISSING"})
+		if !isNotFound(err) {
+			t.Fatalf("Expected record not found, GOT: %v", err)
+		}
+
+		if _, err := service.GetOne(ctx, applicationID, "production", "ATOMIC_1"); !isNotFound(err) {
+			t.Fatalf("No secret should be promoted on failure, GOT: %v", err)
+		}
+	})
+
+	t.Run("HierarchicalKeys", func(t *testing.T) {
+		keys := map[string]string{
+			"db/primary/password": "primary-password",
+			"db/primary/user":     "primary-user",
+			"db/replica/password": "replica-password",
+			"db/url":              "postgres://localhost",
+			"db_flat":             "not in folder",
+		}
+
+		for key, value := range keys {
+			if _, err := service.Create(ctx, applicationID, "tree", key, value, nil); err != nil {
+				t.Fatalf("Error while inserting new secret: %v", err)
+			}
+		}
+
+		tree, err := service.Tree(ctx, applicationID, "tree", "db", nil, 1, 10)
+		if err != nil {
+			t.Fatalf("Error while listing tree: %v", err)
+		}
+
+		if tree.Prefix != "db/" {
+			t.Fatalf("Expected prefix db/, GOT: %s", tree.Prefix)
+		}
+
+		if len(tree.Folders) != 2 || tree.Folders[0] != "db/primary/" || tree.Folders[1] != "db/replica/" {
+			t.Fatalf("Expected folders db/primary/ and db/replica/, GOT: %v", tree.Folders)
+		}
+
+		if len(tree.Secrets) != 1 || tree.Secrets["db/url"] != "postgres://localhost" {
+			t.Fatalf("Expected only db/url leaf, GOT: %v", tree.Secrets)
+		}
+
+		root, err := service.Tree(ctx, applicationID, "tree", "", nil, 1, 10)
+		if err != nil {
+			t.Fatalf("Error while listing tree: %v", err)
+		}
+
+		if len(root.Folders) != 1 || root.Folders[0] != "db/" || root.Secrets["db_flat"] != "not in folder" {
+			t.Fatalf("Unexpected root level: %v %v", root.Folders, root.Secrets)
+		}
+
+		secondPage, err := service.Tree(ctx, applicationID, "tree", "db/", nil, 2, 2)
+		if err != nil {
+			t.Fatalf("Error while listing tree: %v", err)
+		}
+
+		if len(secondPage.Folders) != 0 || len(secondPage.Secrets) != 1 {
+			t.Fatalf("Second page should contain only db/url, GOT: %v %v", secondPage.Folders, secondPage.Secrets)
+		}
+
+		flat, err := service.Paginate(ctx, applicationID, "tree", "db/primary/", nil, 1, 10)
+		if err != nil {
+			t.Fatalf("Error while paginating secrets: %v", err)
+		}
+
+		if len(flat) != 2 || flat["db/primary/user"] != "primary-user" {
+			t.Fatalf("Expected both db/primary secrets, GOT: %v", flat)
+		}
+	})
+
+	t.Run("KeyFilter", func(t *testing.T) {
+		// Page is filled with matching keys, although db/primary/* sorts before them
+		flat, err := service.Paginate(ctx, applicationID, "tree", "", KeyFilter{"db/replica/*", "db_flat"}, 1, 2)
+		if err != nil {
+			t.Fatalf("Error while paginating secrets: %v", err)
+		}
+
+		if len(flat) != 2 || flat["db/replica/password"] != "replica-password" || flat["db_flat"] != "not in folder" {
+			t.Fatalf("Expected db/replica/password and db_flat, GOT: %v", flat)
+		}
+
+		tree, err := service.Tree(ctx, applicationID, "tree", "db/", KeyFilter{"db/replica/*", "db/url"}, 1, 1)
+		if err != nil {
+			t.Fatalf("Error while listing tree: %v", err)
+		}
+
+		if len(tree.Folders) != 1 || tree.Folders[0] != "db/replica/" || len(tree.Secrets) != 0 {
+			t.Fatalf("Expected only db/replica/ folder, GOT: %v %v", tree.Folders, tree.Secrets)
+		}
+
+		flat, err = service.Paginate(ctx, applicationID, "tree", "", KeyFilter{}, 1, 10)
+		if err != nil {
+			t.Fatalf("Error while paginating secrets: %v", err)
+		}
+
+		if len(flat) != 0 {
+			t.Fatalf("Empty filter should match nothing, GOT: %v", flat)
+		}
+	})
+
+	t.Run("PrefixWildcardsAreEscaped", func(t *testing.T) {
+		if _, err := service.Create(ctx, applicationID, "escape", "a_b/key", "underscore", nil); err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		if _, err := service.Create(ctx, applicationID, "escape", "axb/key", "other", nil); err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		flat, err := service.Paginate(ctx, applicationID, "escape", "a_b/", nil, 1, 10)
+		if err != nil {
+			t.Fatalf("Error while paginating secrets: %v", err)
+		}
+
+		if len(flat) != 1 || flat["a_b/key"] != "underscore" {
+			t.Fatalf("Expected only a_b/key, GOT: %v", flat)
+		}
+	})
+
+	t.Run("InvalidKeys", func(t *testing.T) {
+		for _, key := range []string{"", "/db", "db/", "db//password"} {
+			if _, err := service.Create(ctx, applicationID, DefaultEnvironment, key, "value", nil); !errors.Is(err, ErrInvalidKey) {
+				t.Fatalf("Key %q should be invalid, GOT: %v", key, err)
+			}
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		if _, err := service.Create(ctx, applicationID, "import", "EXISTING", "old", nil); err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		data := map[string]string{"EXISTING": "new", "NEW_1": "1", "NEW_2": "2"}
+
+		if _, err := service.Import(ctx, applicationID, "import", data, ImportFail); !errors.Is(err, services.ErrAlreadyExists) {
+			t.Fatalf("Expected already exists error, GOT: %v", err)
+		}
+
+		if _, err := service.GetOne(ctx, applicationID, "import", "NEW_1"); !isNotFound(err) {
+			t.Fatalf("Failed import must not write any secret, GOT: %v", err)
+		}
+
+		result, err := service.Import(ctx, applicationID, "import", data, ImportSkip)
+		if err != nil {
+			t.Fatalf("Error while importing secrets: %v", err)
+		}
+
+		if len(result.Created) != 2 || len(result.Skipped) != 1 || len(result.Updated) != 0 {
+			t.Fatalf("Unexpected import result: %v", result)
+		}
+
+		existing, err := service.GetOne(ctx, applicationID, "import", "EXISTING")
+		if err != nil || existing.Value != "old" {
+			t.Fatalf("Skipped secret should keep its value, GOT: %v %v", existing, err)
+		}
+
+		result, err = service.Import(ctx, applicationID, "import", data, ImportOverwrite)
+		if err != nil {
+			t.Fatalf("Error while importing secrets: %v", err)
+		}
+
+		if len(result.Updated) != 3 {
+			t.Fatalf("Unexpected import result: %v", result)
+		}
+
+		existing, err = service.GetOne(ctx, applicationID, "import", "EXISTING")
+		if err != nil || existing.Value != "new" {
+			t.Fatalf("Overwritten secret should have new value, GOT: %v %v", existing, err)
+		}
+
+		if _, err := service.Import(ctx, applicationID, "import", map[string]string{"bad//key": "1"}, ImportOverwrite); !errors.Is(err, ErrInvalidKey) {
+			t.Fatalf("Expected invalid key error, GOT: %v", err)
+		}
+	})
+	t.Run("Export", func(t *testing.T) {
+		expiredAt := time.Now().Add(-time.Minute)
+		keys := []string{"EXPORT_C", "EXPORT_A", "EXPORT_B"}
+
+		for _, key := range keys {
+			if _, err := service.Create(ctx, applicationID, "export", key, "value_"+key, nil); err != nil {
+				t.Fatalf("Error while inserting new secret: %v", err)
+			}
+		}
+
+		if _, err := service.Create(ctx, applicationID, "export", "EXPORT_EXPIRED", "value", &expiredAt); err != nil {
+			t.Fatalf("Error while inserting new secret: %v", err)
+		}
+
+		var batches [][]Secret
+
+		err := service.Export(ctx, applicationID, "export", 2, func(secrets []Secret) error {
+			batches = append(batches, append([]Secret(nil), secrets...))
+			return nil
+		})
+
+		if err != nil {
+			t.Fatalf("Error while exporting secrets: %v", err)
+		}
+
+		expected := [][]Secret{
+			{{Key: "EXPORT_A", Value: "value_EXPORT_A"}, {Key: "EXPORT_B", Value: "value_EXPORT_B"}},
+			{{Key: "EXPORT_C", Value: "value_EXPORT_C"}},
+		}
+
+		if !reflect.DeepEqual(expected, batches) {
+			t.Fatalf("Expected batches %v, GOT: %v", expected, batches)
+		}
+	})
+}
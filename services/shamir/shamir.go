@@ -0,0 +1,178 @@
+// Package shamir - Shamir's secret sharing over GF(2^8), every byte of the secret is split independently.
+// Share is the y coordinate of each byte followed by the x coordinate of the share
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+const (
+	MaxShares    = 255
+	MinThreshold = 2
+)
+
+var (
+	ErrThreshold     = errors.New("threshold must be between 2 and the number of shares")
+	ErrShares        = errors.New("number of shares must be between threshold and 255")
+	ErrEmptySecret   = errors.New("secret cannot be empty")
+	ErrInvalidShares = errors.New("shares are too short, of different length or duplicated")
+)
+
+var (
+	exp [510]byte
+	log [256]byte
+)
+
+func init() {
+	// 3 generates the multiplicative group of GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		exp[i+255] = x
+		log[x] = byte(i)
+		x = mul(x, 3)
+	}
+}
+
+// mul - Multiplication without tables, used only to build them
+func mul(a, b byte) byte {
+	var p byte
+
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+
+		carry := a & 0x80
+		a <<= 1
+
+		if carry != 0 {
+			a ^= 0x1b
+		}
+
+		b >>= 1
+	}
+
+	return p
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return exp[int(log[a])+int(log[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return exp[int(log[a])+255-int(log[b])]
+}
+
+// Split - Splits the secret into shares, any threshold of them recovers it
+func Split(secret []byte, shares, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+
+	if threshold < MinThreshold || threshold > MaxShares {
+		return nil, ErrThreshold
+	}
+
+	if shares < threshold || shares > MaxShares {
+		return nil, ErrShares
+	}
+
+	out := make([][]byte, shares)
+
+	for i := range out {
+		out[i] = make([]byte, len(secret)+1)
+		out[i][len(secret)] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+
+	for b, value := range secret {
+		coefficients[0] = value
+
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+
+		for _, share := range out {
+			share[b] = evaluate(coefficients, share[len(secret)])
+		}
+	}
+
+	for i := range coefficients {
+		coefficients[i] = 0
+	}
+
+	return out, nil
+}
+
+// Combine - Recovers the secret from at least threshold shares, with fewer shares result is garbage
+// which can only be detected by the caller (e.g. by authenticating data sealed with the secret)
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < MinThreshold {
+		return nil, ErrThreshold
+	}
+
+	length := len(shares[0])
+
+	if length < 2 {
+		return nil, ErrInvalidShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]struct{}, len(shares))
+
+	for i, share := range shares {
+		if len(share) != length {
+			return nil, ErrInvalidShares
+		}
+
+		x := share[length-1]
+
+		if _, ok := seen[x]; ok || x == 0 {
+			return nil, ErrInvalidShares
+		}
+
+		seen[x] = struct{}{}
+		xs[i] = x
+	}
+
+	secret := make([]byte, length-1)
+
+	for i, share := range shares {
+		// Lagrange basis polynomial of the share evaluated at x = 0
+		basis := byte(1)
+
+		for j, x := range xs {
+			if i != j {
+				basis = gfMul(basis, gfDiv(x, x^xs[i]))
+			}
+		}
+
+		for b := range secret {
+			secret[b] ^= gfMul(share[b], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+func evaluate(coefficients []byte, x byte) byte {
+	// Horner's method, addition in GF(2^8) is xor
+	var y byte
+
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coefficients[i]
+	}
+
+	return y
+}
@@ -0,0 +1,55 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestShamir(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	asserts.Nil(err)
+
+	shares, err := Split(secret, 5, 3)
+	asserts.Nil(err)
+	asserts.Len(shares, 5)
+
+	t.Run("AnyThresholdSharesRecover", func(t *testing.T) {
+		for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+			parts := make([][]byte, 0, len(subset))
+
+			for _, i := range subset {
+				parts = append(parts, shares[i])
+			}
+
+			combined, err := Combine(parts)
+			asserts.Nil(err)
+			asserts.Equal(secret, combined)
+		}
+	})
+
+	t.Run("BelowThreshold", func(t *testing.T) {
+		combined, err := Combine(shares[:2])
+		asserts.Nil(err)
+		asserts.NotEqual(secret, combined)
+	})
+
+	t.Run("InvalidShares", func(t *testing.T) {
+		_, err := Combine([][]byte{shares[0], shares[0]})
+		asserts.Equal(ErrInvalidShares, err)
+
+		_, err = Combine([][]byte{shares[0], shares[1][1:]})
+		asserts.Equal(ErrInvalidShares, err)
+
+		_, err = Split(secret, 2, 3)
+		asserts.Equal(ErrShares, err)
+
+		_, err = Split(secret, 5, 1)
+		asserts.Equal(ErrThreshold, err)
+	})
+}
@@ -0,0 +1,181 @@
+package token
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+)
+
+const (
+	DefaultCacheSize = 1024
+	DefaultCacheTTL  = time.Minute
+)
+
+// CacheStats - Snapshot of the cache counters
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Size      int    `json:"size"`
+}
+
+// Cache - Bounded verification cache shared by SQL and MongoDB storages,
+// entries live at most ttl and the least recently used entry is evicted when the cache is full.
+// Storages invalidate entries on every token change, ttl bounds how long a change made
+// by another process (CLI, other instance) stays unnoticed
+type Cache struct {
+	mutex     sync.Mutex
+	size      int
+	ttl       time.Duration
+	entries   map[interface{}]*list.Element
+	order     *list.List
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	now       func() time.Time
+	onChange  func(id interface{})
+}
+
+type cacheEntry struct {
+	id        interface{}
+	token     models.TokenDto
+	expiresAt time.Time
+}
+
+// NewCache - Size and ttl lower or equal to zero fall back to defaults
+func NewCache(size int, ttl time.Duration) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[interface{}]*list.Element, size),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *Cache) Get(id interface{}) (models.TokenDto, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[id]
+
+	if !ok {
+		c.misses++
+		return models.TokenDto{}, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+
+	if !c.now().Before(entry.expiresAt) {
+		c.remove(element)
+		c.misses++
+		return models.TokenDto{}, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+
+	return entry.token, true
+}
+
+func (c *Cache) Set(id interface{}, token models.TokenDto) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expiresAt := c.now().Add(c.ttl)
+
+	if element, ok := c.entries[id]; ok {
+		element.Value = &cacheEntry{id: id, token: token, expiresAt: expiresAt}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	for c.order.Len() >= c.size {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+
+	c.entries[id] = c.order.PushFront(&cacheEntry{id: id, token: token, expiresAt: expiresAt})
+}
+
+// OnInvalidate - Hook called after token was invalidated in this process, used to notify other processes
+func (c *Cache) OnInvalidate(hook func(id interface{})) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.onChange = hook
+}
+
+// Invalidate - Removes the token, called by storages when token is revoked or deleted
+func (c *Cache) Invalidate(id interface{}) {
+	c.Evict(id)
+
+	c.mutex.Lock()
+	hook := c.onChange
+	c.mutex.Unlock()
+
+	if hook != nil {
+		hook(id)
+	}
+}
+
+// Evict - Removes the token without calling the hook, used for changes made by other processes
+func (c *Cache) Evict(id interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.remove(element)
+	}
+}
+
+// InvalidateApplication - Removes all tokens of the application, used when application is deleted
+func (c *Cache) InvalidateApplication(applicationId interface{}) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+
+		if element.Value.(*cacheEntry).token.ApplicationId == applicationId {
+			c.remove(element)
+		}
+
+		element = next
+	}
+}
+
+// Purge - Removes every token from the cache, counters are kept
+func (c *Cache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[interface{}]*list.Element, c.size)
+	c.order.Init()
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Size:      c.order.Len(),
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).id)
+}
@@ -0,0 +1,115 @@
+package token
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	t.Run("HitAndMiss", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(2, time.Minute)
+
+		_, ok := cache.Get(uint(1))
+		asserts.False(ok)
+
+		cache.Set(uint(1), models.TokenDto{ID: uint(1)})
+		token, ok := cache.Get(uint(1))
+		asserts.True(ok)
+		asserts.Equal(uint(1), token.ID)
+
+		asserts.Equal(CacheStats{Hits: 1, Misses: 1, Size: 1}, cache.Stats())
+	})
+
+	t.Run("ExpiresAfterTTL", func(t *testing.T) {
+		asserts := require.New(t)
+		now := time.Now()
+		cache := NewCache(2, time.Minute)
+		cache.now = func() time.Time { return now }
+
+		cache.Set(uint(1), models.TokenDto{ID: uint(1)})
+		now = now.Add(59 * time.Second)
+		_, ok := cache.Get(uint(1))
+		asserts.True(ok)
+
+		now = now.Add(time.Second)
+		_, ok = cache.Get(uint(1))
+		asserts.False(ok)
+		asserts.Zero(cache.Stats().Size)
+	})
+
+	t.Run("EvictsLeastRecentlyUsed", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(2, time.Minute)
+
+		cache.Set(uint(1), models.TokenDto{ID: uint(1)})
+		cache.Set(uint(2), models.TokenDto{ID: uint(2)})
+		_, _ = cache.Get(uint(1))
+		cache.Set(uint(3), models.TokenDto{ID: uint(3)})
+
+		_, ok := cache.Get(uint(2))
+		asserts.False(ok)
+		_, ok = cache.Get(uint(1))
+		asserts.True(ok)
+		_, ok = cache.Get(uint(3))
+		asserts.True(ok)
+
+		stats := cache.Stats()
+		asserts.Equal(uint64(1), stats.Evictions)
+		asserts.Equal(2, stats.Size)
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(10, time.Minute)
+
+		cache.Set(uint(1), models.TokenDto{ID: uint(1), ApplicationId: uint(1)})
+		cache.Set(uint(2), models.TokenDto{ID: uint(2), ApplicationId: uint(1)})
+		cache.Set(uint(3), models.TokenDto{ID: uint(3), ApplicationId: uint(2)})
+
+		cache.Invalidate(uint(3))
+		_, ok := cache.Get(uint(3))
+		asserts.False(ok)
+
+		cache.InvalidateApplication(uint(1))
+		asserts.Zero(cache.Stats().Size)
+
+		cache.Set(uint(4), models.TokenDto{ID: uint(4)})
+		cache.Purge()
+		_, ok = cache.Get(uint(4))
+		asserts.False(ok)
+	})
+
+	t.Run("ConcurrentAccess", func(t *testing.T) {
+		asserts := require.New(t)
+		cache := NewCache(16, time.Minute)
+		wg := sync.WaitGroup{}
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(worker uint) {
+				defer wg.Done()
+				for j := uint(0); j < 1000; j++ {
+					id := (worker*1000 + j) % 32
+					if _, ok := cache.Get(id); !ok {
+						cache.Set(id, models.TokenDto{ID: id})
+					}
+					if j%10 == 0 {
+						cache.Invalidate(id)
+					}
+				}
+			}(uint(i))
+		}
+
+		wg.Wait()
+		stats := cache.Stats()
+		asserts.LessOrEqual(stats.Size, 16)
+		asserts.Equal(uint64(8000), stats.Hits+stats.Misses)
+	})
+}
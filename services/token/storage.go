@@ -2,69 +2,92 @@ package token
 
 import (
 	"context"
+	"time"
 
+	"github.com/BrosSquad/vaulguard/db"
 	"github.com/BrosSquad/vaulguard/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"gorm.io/gorm"
 )
 
 type Storage interface {
 	Get(context.Context, interface{}) (models.TokenDto, error)
 	Create(context.Context, *models.TokenDto) (*models.TokenDto, error)
+	Revoke(context.Context, interface{}) error
+	List(context.Context, interface{}) ([]models.TokenDto, error)
+	Delete(context.Context, interface{}) error
 }
 
-func NewSqlStorage(db *gorm.DB) Storage {
+// NewSqlStorage - Nil cache creates cache with default size and ttl
+func NewSqlStorage(db *gorm.DB, cache *Cache) Storage {
+	if cache == nil {
+		cache = NewCache(DefaultCacheSize, DefaultCacheTTL)
+	}
+
 	return sqlStorage{
 		db:    db,
-		cache: make(map[uint]models.Token),
+		cache: cache,
 	}
 }
 
-func NewMongoStorage(client *mongo.Collection) Storage {
+// NewMongoStorage - Nil cache creates cache with default size and ttl
+func NewMongoStorage(client *mongo.Collection, cache *Cache) Storage {
+	if cache == nil {
+		cache = NewCache(DefaultCacheSize, DefaultCacheTTL)
+	}
+
 	return mongoStorage{
 		client: client,
-		cache:  make(map[primitive.ObjectID]models.Token),
+		cache:  cache,
 	}
 }
 
 type sqlStorage struct {
 	db    *gorm.DB
-	cache map[uint]models.Token
+	cache *Cache
+}
+
+// sqlID - Token ID parsed from the token string is uint64, ID from the database is uint
+func sqlID(id interface{}) uint {
+	switch v := id.(type) {
+	case uint64:
+		return uint(v)
+	case uint:
+		return v
+	}
+
+	return 0
 }
 
 func (s sqlStorage) Get(ctx context.Context, idOrObjectId interface{}) (models.TokenDto, error) {
-	id := uint(idOrObjectId.(uint64))
+	id := sqlID(idOrObjectId)
+
+	if tokenDto, ok := s.cache.Get(id); ok {
+		return tokenDto, nil
+	}
+
 	var token models.Token
-	if _, ok := s.cache[id]; !ok {
-		tx := s.db.WithContext(ctx).Joins("Application").First(&token, id)
-		if err := tx.Error; err != nil {
-			return models.TokenDto{}, err
-		}
-		s.cache[id] = token
-	} else {
-		token = s.cache[id]
+
+	if err := s.db.WithContext(ctx).Joins("Application").First(&token, id).Error; err != nil {
+		return models.TokenDto{}, err
 	}
-	return models.TokenDto{
-		ID:            token.ID,
-		Value:         token.Value,
-		ApplicationId: token.ApplicationId,
-		CreatedAt:     token.CreatedAt,
-		UpdatedAt:     token.UpdatedAt,
-		Application: models.ApplicationDto{
-			ID:        token.Application.ID,
-			Name:      token.Application.Name,
-			CreatedAt: token.Application.CreatedAt,
-			UpdatedAt: token.Application.UpdatedAt,
-		},
-	}, nil
+
+	tokenDto := sqlTokenDto(token)
+	s.cache.Set(id, tokenDto)
+
+	return tokenDto, nil
 }
 
 func (s sqlStorage) Create(ctx context.Context, tokenDto *models.TokenDto) (*models.TokenDto, error) {
 	token := models.Token{
 		Value:         tokenDto.Value,
 		ApplicationId: tokenDto.ApplicationId.(uint),
+		Environments:  models.JoinEnvironments(tokenDto.Environments),
+		Scopes:        models.JoinEnvironments(tokenDto.Scopes),
+		ExpiresAt:     tokenDto.ExpiresAt,
 		CreatedAt:     tokenDto.CreatedAt,
 		UpdatedAt:     tokenDto.UpdatedAt,
 	}
@@ -77,69 +100,153 @@ func (s sqlStorage) Create(ctx context.Context, tokenDto *models.TokenDto) (*mod
 	return tokenDto, nil
 }
 
+// Revoke - Marks the token as revoked, revoking already revoked token keeps the original time
+func (s sqlStorage) Revoke(ctx context.Context, idOrObjectId interface{}) error {
+	id := sqlID(idOrObjectId)
+	var token models.Token
+
+	// Invalidated after the write, so concurrent Get cannot cache the token before it is revoked
+	defer s.cache.Invalidate(id)
+
+	if err := s.db.WithContext(ctx).First(&token, id).Error; err != nil {
+		return err
+	}
+
+	if token.RevokedAt != nil {
+		return nil
+	}
+
+	return s.db.WithContext(ctx).Model(&token).Update("revoked_at", time.Now()).Error
+}
+
+func (s sqlStorage) List(ctx context.Context, applicationId interface{}) ([]models.TokenDto, error) {
+	var tokens []models.Token
+
+	err := s.db.
+		WithContext(ctx).
+		Joins("Application").
+		Where("tokens.application_id = ?", applicationId).
+		Order("tokens.id").
+		Find(&tokens).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokensDto := make([]models.TokenDto, 0, len(tokens))
+
+	for _, token := range tokens {
+		tokensDto = append(tokensDto, sqlTokenDto(token))
+	}
+
+	return tokensDto, nil
+}
+
+func (s sqlStorage) Delete(ctx context.Context, idOrObjectId interface{}) error {
+	id := sqlID(idOrObjectId)
+	defer s.cache.Invalidate(id)
+
+	result := s.db.WithContext(ctx).Delete(&models.Token{}, id)
+
+	if err := result.Error; err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func sqlTokenDto(token models.Token) models.TokenDto {
+	return models.TokenDto{
+		ID:            token.ID,
+		Value:         token.Value,
+		ApplicationId: token.ApplicationId,
+		Environments:  models.SplitEnvironments(token.Environments),
+		Scopes:        models.SplitEnvironments(token.Scopes),
+		ExpiresAt:     token.ExpiresAt,
+		RevokedAt:     token.RevokedAt,
+		CreatedAt:     token.CreatedAt,
+		UpdatedAt:     token.UpdatedAt,
+		Application: models.ApplicationDto{
+			ID:        token.Application.ID,
+			Name:      token.Application.Name,
+			CreatedAt: token.Application.CreatedAt,
+			UpdatedAt: token.Application.UpdatedAt,
+		},
+	}
+}
+
 type mongoStorage struct {
-	ctx    context.Context
 	client *mongo.Collection
-	cache  map[primitive.ObjectID]models.Token
+	cache  *Cache
 }
 
-func (m mongoStorage) Get(ctx context.Context, idOrObjectID interface{}) (models.TokenDto, error) {
-	objectID := idOrObjectID.(primitive.ObjectID)
-	filter := bson.A{
-		bson.D{
-			{Key: "$lookup", Value: bson.D{
-				{Key: "from", Value: "applications"},
-				{Key: "localField", Value: "ApplicationId"},
-				{Key: "foreignField", Value: "_id"},
-				{Key: "as", Value: "app"},
-			}},
-		},
-		bson.D{
-			{Key: "$match", Value: bson.D{{Key: "_id", Value: objectID}}},
-		},
-		bson.D{
-			{Key: "$unwind", Value: "$app"},
-		},
-		bson.D{
-			{Key: "$project", Value: bson.D{
-				{Key: "ID", Value: "$_id"},
-				{Key: "Value", Value: "$Value"},
-				{Key: "ApplicationId", Value: "$ApplicationId"},
-				{Key: "Application", Value: bson.D{
-					{Key: "Id", Value: "$app._id"},
-					{Key: "Name", Value: "$app.Name"},
-					{Key: "CreatedAt", Value: "$app.CreatedAt"},
-					{Key: "UpdatedAt", Value: "$app.UpdatedAt"},
-				}},
-				{Key: "CreatedAt", Value: "$CreatedAt"},
-				{Key: "UpdatedAt", Value: "$UpdatedAt"},
-			}},
-		},
+// mongoToken - Document in the tokens collection, application is joined on read
+type mongoToken struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	Value         []byte             `bson:"Value"`
+	ApplicationId primitive.ObjectID `bson:"ApplicationId"`
+	Environments  []string           `bson:"Environments"`
+	Scopes        []string           `bson:"Scopes"`
+	ExpiresAt     *time.Time         `bson:"ExpiresAt"`
+	RevokedAt     *time.Time         `bson:"RevokedAt"`
+	CreatedAt     time.Time          `bson:"CreatedAt"`
+	UpdatedAt     time.Time          `bson:"UpdatedAt"`
+	Application   struct {
+		ID        primitive.ObjectID `bson:"_id"`
+		Name      string             `bson:"Name"`
+		CreatedAt time.Time          `bson:"CreatedAt"`
+		UpdatedAt time.Time          `bson:"UpdatedAt"`
+	} `bson:"Application,omitempty"`
+}
+
+// mongoID - Token ID parsed from SQL token string never matches a document
+func mongoID(id interface{}) (primitive.ObjectID, error) {
+	objectID, ok := id.(primitive.ObjectID)
+
+	if !ok {
+		return primitive.NilObjectID, mongo.ErrNoDocuments
 	}
 
-	cursor, err := m.client.Aggregate(ctx, filter)
+	return objectID, nil
+}
+
+func (m mongoStorage) Get(ctx context.Context, idOrObjectID interface{}) (models.TokenDto, error) {
+	objectID, err := mongoID(idOrObjectID)
 
 	if err != nil {
 		return models.TokenDto{}, err
 	}
 
-	defer cursor.Close(ctx)
-	token := models.TokenDto{}
+	if tokenDto, ok := m.cache.Get(objectID); ok {
+		return tokenDto, nil
+	}
 
-	for cursor.Next(ctx) {
-		err := cursor.Decode(&token)
-		if err != nil {
-			return models.TokenDto{}, err
-		}
+	tokens, err := m.find(ctx, bson.D{{Key: "_id", Value: objectID}})
+
+	if err != nil {
+		return models.TokenDto{}, err
 	}
 
-	return token, nil
+	if len(tokens) == 0 {
+		return models.TokenDto{}, mongo.ErrNoDocuments
+	}
+
+	m.cache.Set(objectID, tokens[0])
+
+	return tokens[0], nil
 }
 
 func (m mongoStorage) Create(ctx context.Context, token *models.TokenDto) (*models.TokenDto, error) {
 	inserted, err := m.client.InsertOne(ctx, bson.M{
 		"Value":         token.Value,
 		"ApplicationId": token.ApplicationId.(primitive.ObjectID),
+		"Environments":  token.Environments,
+		"Scopes":        token.Scopes,
+		"ExpiresAt":     token.ExpiresAt,
 		"CreatedAt":     token.CreatedAt,
 		"UpdatedAt":     token.UpdatedAt,
 	})
@@ -152,3 +259,121 @@ func (m mongoStorage) Create(ctx context.Context, token *models.TokenDto) (*mode
 
 	return token, nil
 }
+
+// Revoke - Marks the token as revoked, revoking already revoked token keeps the original time
+func (m mongoStorage) Revoke(ctx context.Context, idOrObjectID interface{}) error {
+	objectID, err := mongoID(idOrObjectID)
+
+	if err != nil {
+		return err
+	}
+
+	defer m.cache.Invalidate(objectID)
+
+	result, err := m.client.UpdateOne(ctx, bson.M{"_id": objectID, "RevokedAt": nil}, bson.M{
+		"$set": bson.M{"RevokedAt": time.Now(), "UpdatedAt": time.Now()},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := m.client.CountDocuments(ctx, bson.M{"_id": objectID})
+
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return mongo.ErrNoDocuments
+		}
+	}
+
+	return nil
+}
+
+func (m mongoStorage) List(ctx context.Context, applicationId interface{}) ([]models.TokenDto, error) {
+	return m.find(ctx, bson.D{{Key: "ApplicationId", Value: applicationId}})
+}
+
+func (m mongoStorage) Delete(ctx context.Context, idOrObjectID interface{}) error {
+	objectID, err := mongoID(idOrObjectID)
+
+	if err != nil {
+		return err
+	}
+
+	defer m.cache.Invalidate(objectID)
+
+	result, err := m.client.DeleteOne(ctx, bson.M{"_id": objectID})
+
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+
+	return nil
+}
+
+// find - Tokens matching the filter joined with their application
+func (m mongoStorage) find(ctx context.Context, match bson.D) ([]models.TokenDto, error) {
+	pipeline := bson.A{
+		bson.D{
+			{Key: "$match", Value: match},
+		},
+		bson.D{
+			{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}},
+		},
+		bson.D{
+			{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: db.ApplicationMongoCollection},
+				{Key: "localField", Value: "ApplicationId"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "Application"},
+			}},
+		},
+		bson.D{
+			{Key: "$unwind", Value: "$Application"},
+		},
+	}
+
+	cursor, err := m.client.Aggregate(ctx, pipeline, options.Aggregate())
+
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []mongoToken
+
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+
+	tokensDto := make([]models.TokenDto, 0, len(tokens))
+
+	for _, token := range tokens {
+		tokensDto = append(tokensDto, models.TokenDto{
+			ID:            token.ID,
+			Value:         token.Value,
+			ApplicationId: token.ApplicationId,
+			Environments:  token.Environments,
+			Scopes:        token.Scopes,
+			ExpiresAt:     token.ExpiresAt,
+			RevokedAt:     token.RevokedAt,
+			CreatedAt:     token.CreatedAt,
+			UpdatedAt:     token.UpdatedAt,
+			Application: models.ApplicationDto{
+				ID:        token.Application.ID,
+				Name:      token.Application.Name,
+				CreatedAt: token.Application.CreatedAt,
+				UpdatedAt: token.Application.UpdatedAt,
+			},
+		})
+	}
+
+	return tokensDto, nil
+}
@@ -5,7 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/BrosSquad/vaulguard/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,9 +15,22 @@ import (
 	"time"
 )
 
+var ErrInvalidID = errors.New("token ID is not valid")
+
+// GenerateOptions - Restrictions of the generated token, zero value
+// creates token for all environments and all keys which never expires
+type GenerateOptions struct {
+	Environments []string
+	Scopes       []string
+	ExpiresAt    *time.Time
+}
+
 type Service interface {
-	Generate(context.Context, interface{}) string
-	Verify(context.Context, string) (models.ApplicationDto, bool)
+	Generate(ctx context.Context, applicationId interface{}, options GenerateOptions) string
+	Verify(context.Context, string) (models.TokenDto, bool)
+	Revoke(ctx context.Context, id interface{}) error
+	List(ctx context.Context, applicationId interface{}) ([]models.TokenDto, error)
+	Delete(ctx context.Context, id interface{}) error
 }
 
 type service struct {
@@ -28,7 +41,21 @@ func NewService(storage Storage) Service {
 	return service{storage}
 }
 
-func (s service) Generate(ctx context.Context, applicationId interface{}) string {
+// Generate - Creates new token for the application, token without
+// environments is allowed to access secrets in all environments
+func (s service) Generate(ctx context.Context, applicationId interface{}, options GenerateOptions) string {
+	for _, scope := range options.Scopes {
+		if models.ValidateScope(scope) != nil {
+			return ""
+		}
+	}
+
+	for _, environment := range options.Environments {
+		if models.ValidateEnvironment(environment) != nil {
+			return ""
+		}
+	}
+
 	tokenBytes := make([]byte, 64)
 	_, err := rand.Read(tokenBytes)
 
@@ -40,6 +67,9 @@ func (s service) Generate(ctx context.Context, applicationId interface{}) string
 
 	token, err := s.storage.Create(ctx, &models.TokenDto{
 		ApplicationId: applicationId,
+		Environments:  options.Environments,
+		Scopes:        options.Scopes,
+		ExpiresAt:     options.ExpiresAt,
 		Value:         hashed[:],
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
@@ -61,44 +91,57 @@ func (s service) Generate(ctx context.Context, applicationId interface{}) string
 	return fmt.Sprintf("VaulGuard.%s.%s", id, base64.RawURLEncoding.EncodeToString(tokenBytes))
 }
 
-func (s service) Verify(ctx context.Context, token string) (models.ApplicationDto, bool) {
+func (s service) Verify(ctx context.Context, token string) (models.TokenDto, bool) {
 	values := strings.Split(token, ".")
 
 	if len(values) != 3 || values[0] != "VaulGuard" {
-		return models.ApplicationDto{}, false
+		return models.TokenDto{}, false
 	}
 
-	var id interface{}
-
-	id, err := strconv.ParseUint(values[1], 10, 64)
+	id, err := ParseID(values[1])
 
 	if err != nil {
-		h, err := hex.DecodeString(values[1])
-
-		if err != nil {
-			return models.ApplicationDto{}, false
-		}
-
-		idObject := primitive.ObjectID{}
-		if err := idObject.UnmarshalJSON(h); err != nil {
-			return models.ApplicationDto{}, false
-		}
-
-		id = idObject
+		return models.TokenDto{}, false
 	}
 
 	t, err := s.storage.Get(ctx, id)
 
-	if err != nil {
-		return models.ApplicationDto{}, false
+	// Expired and revoked tokens are rejected before the value is compared
+	if err != nil || !t.Active(time.Now()) {
+		return models.TokenDto{}, false
 	}
 
 	decodedValue, err := base64.RawURLEncoding.DecodeString(values[2])
 	hashedToken := blake3.Sum512(decodedValue)
 
 	if err != nil {
-		return models.ApplicationDto{}, false
+		return models.TokenDto{}, false
+	}
+
+	return t, subtle.ConstantTimeCompare(hashedToken[:], t.Value) == 1
+}
+
+func (s service) Revoke(ctx context.Context, id interface{}) error {
+	return s.storage.Revoke(ctx, id)
+}
+
+func (s service) List(ctx context.Context, applicationId interface{}) ([]models.TokenDto, error) {
+	return s.storage.List(ctx, applicationId)
+}
+
+func (s service) Delete(ctx context.Context, id interface{}) error {
+	return s.storage.Delete(ctx, id)
+}
+
+// ParseID - Token ID as it is written in the token, number for SQL storage and hex ObjectID for MongoDB
+func ParseID(id string) (interface{}, error) {
+	if sqlID, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return sqlID, nil
+	}
+
+	if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+		return objectID, nil
 	}
 
-	return t.Application, subtle.ConstantTimeCompare(hashedToken[:], t.Value) == 1
+	return nil, ErrInvalidID
 }
@@ -2,6 +2,7 @@ package token
 
 import (
 	"context"
+	"errors"
 	"os"
 	"strings"
 	"testing"
@@ -40,18 +41,155 @@ func TestSqliteToken(t *testing.T) {
 	conn.Create(&app)
 
 	t.Run("Generate", func(t *testing.T) {
-		s := NewService(NewSqlStorage(conn))
-		_ = s.Generate(ctx, app.ID)
+		s := NewService(NewSqlStorage(conn, nil))
+		_ = s.Generate(ctx, app.ID, GenerateOptions{})
 	})
 
 	t.Run("Verify", func(t *testing.T) {
-		s := NewService(NewSqlStorage(conn))
-		token := s.Generate(ctx, app.ID)
+		s := NewService(NewSqlStorage(conn, nil))
+		token := s.Generate(ctx, app.ID, GenerateOptions{})
 
 		if _, ok := s.Verify(ctx, token); !ok {
 			t.Fatal("Token is not valid")
 		}
 	})
+
+	t.Run("VerifyReturnsScopes", func(t *testing.T) {
+		s := NewService(NewSqlStorage(conn, nil))
+		token := s.Generate(ctx, app.ID, GenerateOptions{Scopes: []string{"read:db/*", "admin:cache"}})
+
+		dto, ok := s.Verify(ctx, token)
+		if !ok {
+			t.Fatal("Token is not valid")
+		}
+
+		if strings.Join(dto.Scopes, " ") != "read:db/* admin:cache" {
+			t.Fatalf("Expected scopes read:db/* admin:cache, got %v", dto.Scopes)
+		}
+
+		if token := s.Generate(ctx, app.ID, GenerateOptions{Scopes: []string{"delete:db/*"}}); token != "" {
+			t.Fatal("Token with invalid scope should not be generated")
+		}
+
+		if token := s.Generate(ctx, app.ID, GenerateOptions{Environments: []string{"prod/db"}}); token != "" {
+			t.Fatal("Token with invalid environment should not be generated")
+		}
+	})
+
+	t.Run("VerifyExpiredToken", func(t *testing.T) {
+		s := NewService(NewSqlStorage(conn, nil))
+		expiresAt := time.Now().Add(-time.Minute)
+		token := s.Generate(ctx, app.ID, GenerateOptions{ExpiresAt: &expiresAt})
+
+		if _, ok := s.Verify(ctx, token); ok {
+			t.Fatal("Expired token should not be valid")
+		}
+
+		expiresAt = time.Now().Add(time.Hour)
+		token = s.Generate(ctx, app.ID, GenerateOptions{ExpiresAt: &expiresAt})
+
+		if _, ok := s.Verify(ctx, token); !ok {
+			t.Fatal("Token is not valid")
+		}
+	})
+
+	t.Run("RevokeListAndDelete", func(t *testing.T) {
+		s := NewService(NewSqlStorage(conn, nil))
+		token := s.Generate(ctx, app.ID, GenerateOptions{})
+
+		dto, ok := s.Verify(ctx, token)
+		if !ok {
+			t.Fatal("Token is not valid")
+		}
+
+		if err := s.Revoke(ctx, dto.ID); err != nil {
+			t.Fatalf("Error while revoking token: %v", err)
+		}
+
+		if _, ok := s.Verify(ctx, token); ok {
+			t.Fatal("Revoked token should not be valid")
+		}
+
+		tokens, err := s.List(ctx, app.ID)
+		if err != nil {
+			t.Fatalf("Error while listing tokens: %v", err)
+		}
+
+		revoked := false
+		for _, listed := range tokens {
+			if listed.ID == dto.ID {
+				revoked = listed.RevokedAt != nil
+			}
+		}
+
+		if !revoked {
+			t.Fatalf("Revoked token is not listed as revoked: %v", tokens)
+		}
+
+		if err := s.Delete(ctx, dto.ID); err != nil {
+			t.Fatalf("Error while deleting token: %v", err)
+		}
+
+		if err := s.Revoke(ctx, dto.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("Expected record not found, GOT: %v", err)
+		}
+	})
+
+	t.Run("SharedCacheIsInvalidatedOnRevoke", func(t *testing.T) {
+		cache := NewCache(DefaultCacheSize, time.Hour)
+		verifier := NewService(NewSqlStorage(conn, cache))
+		admin := NewService(NewSqlStorage(conn, cache))
+		token := verifier.Generate(ctx, app.ID, GenerateOptions{})
+
+		dto, ok := verifier.Verify(ctx, token)
+		if !ok {
+			t.Fatal("Token is not valid")
+		}
+
+		if _, ok := verifier.Verify(ctx, token); !ok || cache.Stats().Hits == 0 {
+			t.Fatalf("Token is not served from cache: %+v", cache.Stats())
+		}
+
+		if err := admin.Revoke(ctx, dto.ID); err != nil {
+			t.Fatalf("Error while revoking token: %v", err)
+		}
+
+		if _, ok := verifier.Verify(ctx, token); ok {
+			t.Fatal("Revoked token should not be valid")
+		}
+	})
+
+	t.Run("VerifyScopedToEnvironments", func(t *testing.T) {
+		s := NewService(NewSqlStorage(conn, nil))
+		token := s.Generate(ctx, app.ID, GenerateOptions{Environments: []string{"dev", "staging"}})
+
+		dto, ok := s.Verify(ctx, token)
+		if !ok {
+			t.Fatal("Token is not valid")
+		}
+
+		if !dto.AllowsEnvironment("staging") || dto.AllowsEnvironment("production") {
+			t.Fatalf("Token environments are not stored: %v", dto.Environments)
+		}
+	})
+}
+
+func TestMongoStorageSqlID(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	service := NewService(NewMongoStorage(nil, nil))
+
+	if _, ok := service.Verify(ctx, "VaulGuard.1.value"); ok {
+		t.Fatal("Token with SQL ID should not be verified")
+	}
+
+	if err := service.Revoke(ctx, uint64(1)); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("Expected no documents, GOT: %v", err)
+	}
+
+	if err := service.Delete(ctx, uint64(1)); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Fatalf("Expected no documents, GOT: %v", err)
+	}
 }
 
 func TestMongoToken(t *testing.T) {
@@ -84,10 +222,10 @@ func TestMongoToken(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	service := NewService(NewMongoStorage(db.Collection("tokens")))
+	service := NewService(NewMongoStorage(db.Collection("tokens"), nil))
 
 	t.Run("Generate", func(t *testing.T) {
-		token := service.Generate(ctx, result.InsertedID)
+		token := service.Generate(ctx, result.InsertedID, GenerateOptions{})
 
 		if token == "" {
 			t.Fatal("Token is not generated")
@@ -101,7 +239,7 @@ func TestMongoToken(t *testing.T) {
 	})
 
 	t.Run("Verify", func(t *testing.T) {
-		token := service.Generate(ctx, result.InsertedID)
+		token := service.Generate(ctx, result.InsertedID, GenerateOptions{})
 		if token == "" {
 			t.Fatal("Token is not generated")
 		}
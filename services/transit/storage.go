@@ -0,0 +1,107 @@
+package transit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gorm.io/gorm"
+)
+
+type sqlStorage struct {
+	db *gorm.DB
+}
+
+type mongoStorage struct {
+	collection *mongo.Collection
+}
+
+type mongoTransitKey struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	ApplicationId primitive.ObjectID `bson:"ApplicationId"`
+	Name          string             `bson:"Name"`
+	Version       uint               `bson:"Version"`
+	Key           []byte             `bson:"Key"`
+	CreatedAt     time.Time          `bson:"CreatedAt"`
+}
+
+func NewSqlStorage(db *gorm.DB) Storage {
+	return sqlStorage{db: db}
+}
+
+func NewMongoStorage(collection *mongo.Collection) Storage {
+	return mongoStorage{collection: collection}
+}
+
+func (s sqlStorage) Latest(ctx context.Context, applicationID interface{}, name string) (Key, error) {
+	return s.first(s.db.WithContext(ctx).Where("application_id = ? AND name = ?", applicationID, name).Order("version DESC"))
+}
+
+func (s sqlStorage) Get(ctx context.Context, applicationID interface{}, name string, version uint) (Key, error) {
+	return s.first(s.db.WithContext(ctx).Where("application_id = ? AND name = ? AND version = ?", applicationID, name, version))
+}
+
+func (s sqlStorage) first(tx *gorm.DB) (Key, error) {
+	key := models.TransitKey{}
+
+	if err := tx.First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Key{}, ErrKeyNotFound
+		}
+
+		return Key{}, err
+	}
+
+	return Key{Version: key.Version, Wrapped: key.Key}, nil
+}
+
+func (s sqlStorage) Create(ctx context.Context, applicationID interface{}, name string, key Key) error {
+	return s.db.WithContext(ctx).Create(&models.TransitKey{
+		ApplicationId: applicationID.(uint),
+		Name:          name,
+		Version:       key.Version,
+		Key:           key.Wrapped,
+	}).Error
+}
+
+func (m mongoStorage) Latest(ctx context.Context, applicationID interface{}, name string) (Key, error) {
+	findOptions := options.FindOne().SetSort(bson.M{"Version": -1})
+
+	return m.first(ctx, bson.M{"ApplicationId": applicationID, "Name": name}, findOptions)
+}
+
+func (m mongoStorage) Get(ctx context.Context, applicationID interface{}, name string, version uint) (Key, error) {
+	return m.first(ctx, bson.M{"ApplicationId": applicationID, "Name": name, "Version": version})
+}
+
+func (m mongoStorage) first(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (Key, error) {
+	var key mongoTransitKey
+
+	if err := m.collection.FindOne(ctx, filter, opts...).Decode(&key); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Key{}, ErrKeyNotFound
+		}
+
+		return Key{}, err
+	}
+
+	return Key{Version: key.Version, Wrapped: key.Key}, nil
+}
+
+// Create - Unique index on application, name and version rejects concurrently created version
+func (m mongoStorage) Create(ctx context.Context, applicationID interface{}, name string, key Key) error {
+	_, err := m.collection.InsertOne(ctx, mongoTransitKey{
+		ApplicationId: applicationID.(primitive.ObjectID),
+		Name:          name,
+		Version:       key.Version,
+		Key:           key.Wrapped,
+		CreatedAt:     time.Now(),
+	})
+
+	return err
+}
@@ -0,0 +1,296 @@
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/BrosSquad/vaulguard/services/locked"
+	"github.com/gofiber/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ciphertextPrefix - Ciphertexts are vaulguard:v<version>:<base64 envelope>
+const ciphertextPrefix = "vaulguard:v"
+
+var (
+	ErrKeyNotFound       = errors.New("transit key not found")
+	ErrInvalidName       = errors.New("transit key name must be 1-255 letters, digits, -, _ or .")
+	ErrInvalidCiphertext = errors.New("ciphertext is not valid for the transit key")
+)
+
+// Key - Version of the transit key, Wrapped is sealed with the application data key
+type Key struct {
+	Version uint
+	Wrapped []byte
+}
+
+type Storage interface {
+	// Latest - Newest version of the key, ErrKeyNotFound when the key does not exist
+	Latest(ctx context.Context, applicationID interface{}, name string) (Key, error)
+	Get(ctx context.Context, applicationID interface{}, name string, version uint) (Key, error)
+	// Create - Fails when the version already exists
+	Create(ctx context.Context, applicationID interface{}, name string, key Key) error
+}
+
+// Service - Encryption as a service, applications encrypt their own data with keys held by the server
+type Service interface {
+	// Encrypt - Encrypts with the latest version of the key, key is created on first use
+	Encrypt(ctx context.Context, applicationID interface{}, name string, plaintext []byte) (string, error)
+	// Decrypt - Version of the key is read from the ciphertext
+	Decrypt(ctx context.Context, applicationID interface{}, name, ciphertext string) ([]byte, error)
+	// Rotate - Adds new version of the key, existing ciphertexts stay decryptable
+	Rotate(ctx context.Context, applicationID interface{}, name string) (uint, error)
+}
+
+type keyVersion struct {
+	applicationID interface{}
+	name          string
+	version       uint
+}
+
+type service struct {
+	keys    *datakey.KeyRing
+	storage Storage
+
+	mutex     sync.RWMutex
+	unwrapped map[keyVersion]services.Encryption
+}
+
+func NewService(keys *datakey.KeyRing, storage Storage) Service {
+	return &service{
+		keys:      keys,
+		storage:   storage,
+		unwrapped: make(map[keyVersion]services.Encryption),
+	}
+}
+
+func (s *service) Encrypt(ctx context.Context, applicationID interface{}, name string, plaintext []byte) (string, error) {
+	if !ValidName(name) {
+		return "", ErrInvalidName
+	}
+
+	key, err := s.storage.Latest(ctx, applicationID, name)
+
+	if errors.Is(err, ErrKeyNotFound) {
+		key, err = s.create(ctx, applicationID, name, 1)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	encryption, err := s.encryption(ctx, applicationID, name, key)
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := encryption.EncryptStringWithAD(utils.GetString(plaintext), associatedData(applicationID, name, key.Version))
+
+	if err != nil {
+		return "", err
+	}
+
+	return ciphertextPrefix + strconv.FormatUint(uint64(key.Version), 10) + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *service) Decrypt(ctx context.Context, applicationID interface{}, name, ciphertext string) ([]byte, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+
+	version, sealed, err := parseCiphertext(ciphertext)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.storage.Get(ctx, applicationID, name, version)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryption, err := s.encryption(ctx, applicationID, name, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := encryption.DecryptWithAD(nil, sealed, associatedData(applicationID, name, version))
+
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func (s *service) Rotate(ctx context.Context, applicationID interface{}, name string) (uint, error) {
+	if !ValidName(name) {
+		return 0, ErrInvalidName
+	}
+
+	var version uint = 1
+	latest, err := s.storage.Latest(ctx, applicationID, name)
+
+	switch {
+	case err == nil:
+		version = latest.Version + 1
+	case !errors.Is(err, ErrKeyNotFound):
+		return 0, err
+	}
+
+	key, err := s.create(ctx, applicationID, name, version)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return key.Version, nil
+}
+
+// create - Concurrent request may create the same version first, its key is used then
+func (s *service) create(ctx context.Context, applicationID interface{}, name string, version uint) (Key, error) {
+	dataKey, err := s.keys.Encryption(ctx, applicationID)
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	key := make([]byte, services.SecretKeyLength)
+
+	if _, err := rand.Read(key); err != nil {
+		return Key{}, err
+	}
+
+	wrapped, err := dataKey.EncryptStringWithAD(utils.GetString(key), keyAssociatedData(applicationID, name, version))
+	locked.Wipe(key)
+
+	if err != nil {
+		return Key{}, err
+	}
+
+	created := Key{Version: version, Wrapped: wrapped}
+
+	if err := s.storage.Create(ctx, applicationID, name, created); err != nil {
+		existing, getErr := s.storage.Get(ctx, applicationID, name, version)
+
+		if getErr != nil {
+			return Key{}, err
+		}
+
+		return existing, nil
+	}
+
+	return created, nil
+}
+
+func (s *service) encryption(ctx context.Context, applicationID interface{}, name string, key Key) (services.Encryption, error) {
+	id := keyVersion{applicationID: applicationID, name: name, version: key.Version}
+
+	s.mutex.RLock()
+	encryption, ok := s.unwrapped[id]
+	s.mutex.RUnlock()
+
+	if ok {
+		return encryption, nil
+	}
+
+	dataKey, err := s.keys.Encryption(ctx, applicationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := dataKey.DecryptWithAD(nil, key.Wrapped, keyAssociatedData(applicationID, name, key.Version))
+
+	if err != nil {
+		return nil, err
+	}
+
+	encryption, err = services.NewSecretKeyEncryptionWithAlgorithm(raw, s.keys.Algorithm())
+	locked.Wipe(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.unwrapped[id] = encryption
+	s.mutex.Unlock()
+
+	return encryption, nil
+}
+
+// ValidName - Key names are used in scopes and URLs, so they are kept simple
+func ValidName(name string) bool {
+	if name == "" || len(name) > 255 {
+		return false
+	}
+
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseCiphertext(ciphertext string) (uint, []byte, error) {
+	if !strings.HasPrefix(ciphertext, ciphertextPrefix) {
+		return 0, nil, ErrInvalidCiphertext
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(ciphertext, ciphertextPrefix), ":", 2)
+
+	if len(parts) != 2 {
+		return 0, nil, ErrInvalidCiphertext
+	}
+
+	version, err := strconv.ParseUint(parts[0], 10, 32)
+
+	if err != nil || version == 0 {
+		return 0, nil, ErrInvalidCiphertext
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return 0, nil, ErrInvalidCiphertext
+	}
+
+	return uint(version), sealed, nil
+}
+
+func applicationKey(applicationID interface{}) string {
+	switch v := applicationID.(type) {
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case primitive.ObjectID:
+		return v.Hex()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// associatedData - Binds the ciphertext to application, key and version, so it cannot be
+// decrypted as ciphertext of another key or with version prefix changed
+func associatedData(applicationID interface{}, name string, version uint) []byte {
+	return []byte("vaulguard:transit:" + applicationKey(applicationID) + ":" + name + ":" + strconv.FormatUint(uint64(version), 10))
+}
+
+func keyAssociatedData(applicationID interface{}, name string, version uint) []byte {
+	return []byte("vaulguard:transit-key:" + applicationKey(applicationID) + ":" + name + ":" + strconv.FormatUint(uint64(version), 10))
+}
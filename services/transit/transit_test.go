@@ -0,0 +1,108 @@
+package transit
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/BrosSquad/vaulguard/models"
+	"github.com/BrosSquad/vaulguard/services"
+	"github.com/BrosSquad/vaulguard/services/datakey"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTransit(t *testing.T) {
+	t.Parallel()
+	asserts := require.New(t)
+	ctx := context.Background()
+
+	conn, err := gorm.Open(sqlite.Open("transit_test.db"), &gorm.Config{})
+	asserts.Nil(err)
+	db, _ := conn.DB()
+	defer os.Remove("transit_test.db")
+	defer db.Close()
+
+	asserts.Nil(conn.AutoMigrate(&models.Application{}, &models.TransitKey{}))
+
+	first := models.Application{Name: "First"}
+	second := models.Application{Name: "Second"}
+	asserts.Nil(conn.Create(&first).Error)
+	asserts.Nil(conn.Create(&second).Error)
+
+	key := make([]byte, services.SecretKeyLength)
+	_, _ = rand.Read(key)
+	master, err := services.NewSecretKeyEncryption(key)
+	asserts.Nil(err)
+
+	service := NewService(datakey.NewKeyRing(master, datakey.NewSqlStorage(conn), services.DefaultAlgorithm), NewSqlStorage(conn))
+
+	t.Run("KeyIsCreatedOnFirstEncrypt", func(t *testing.T) {
+		asserts := require.New(t)
+		ciphertext, err := service.Encrypt(ctx, first.ID, "pii", []byte("john@example.com"))
+		asserts.Nil(err)
+		asserts.True(strings.HasPrefix(ciphertext, "vaulguard:v1:"))
+		asserts.NotContains(ciphertext, "john")
+
+		plaintext, err := service.Decrypt(ctx, first.ID, "pii", ciphertext)
+		asserts.Nil(err)
+		asserts.Equal([]byte("john@example.com"), plaintext)
+
+		var stored models.TransitKey
+		asserts.Nil(conn.Where("application_id = ? AND name = ?", first.ID, "pii").First(&stored).Error)
+		asserts.Greater(len(stored.Key), services.SecretKeyLength, "key is stored wrapped")
+	})
+
+	t.Run("RotateKeepsOldVersionsReadable", func(t *testing.T) {
+		asserts := require.New(t)
+		old, err := service.Encrypt(ctx, first.ID, "rotated", []byte("old"))
+		asserts.Nil(err)
+
+		version, err := service.Rotate(ctx, first.ID, "rotated")
+		asserts.Nil(err)
+		asserts.Equal(uint(2), version)
+
+		current, err := service.Encrypt(ctx, first.ID, "rotated", []byte("new"))
+		asserts.Nil(err)
+		asserts.True(strings.HasPrefix(current, "vaulguard:v2:"))
+
+		plaintext, err := service.Decrypt(ctx, first.ID, "rotated", old)
+		asserts.Nil(err)
+		asserts.Equal([]byte("old"), plaintext)
+
+		plaintext, err = service.Decrypt(ctx, first.ID, "rotated", current)
+		asserts.Nil(err)
+		asserts.Equal([]byte("new"), plaintext)
+	})
+
+	t.Run("CiphertextIsBoundToKey", func(t *testing.T) {
+		asserts := require.New(t)
+		ciphertext, err := service.Encrypt(ctx, first.ID, "bound", []byte("value"))
+		asserts.Nil(err)
+		_, err = service.Encrypt(ctx, first.ID, "other", []byte("value"))
+		asserts.Nil(err)
+		_, err = service.Encrypt(ctx, second.ID, "bound", []byte("value"))
+		asserts.Nil(err)
+
+		_, err = service.Decrypt(ctx, first.ID, "other", ciphertext)
+		asserts.Equal(ErrInvalidCiphertext, err)
+
+		_, err = service.Decrypt(ctx, second.ID, "bound", ciphertext)
+		asserts.Equal(ErrInvalidCiphertext, err)
+
+		_, err = service.Decrypt(ctx, first.ID, "bound", strings.Replace(ciphertext, ":v1:", ":v2:", 1))
+		asserts.Equal(ErrKeyNotFound, err)
+
+		_, err = service.Decrypt(ctx, first.ID, "bound", "not a ciphertext")
+		asserts.Equal(ErrInvalidCiphertext, err)
+
+		_, err = service.Decrypt(ctx, first.ID, "missing", ciphertext)
+		asserts.Equal(ErrKeyNotFound, err)
+
+		_, err = service.Encrypt(ctx, first.ID, "no/slashes", []byte("value"))
+		asserts.Equal(ErrInvalidName, err)
+	})
+}